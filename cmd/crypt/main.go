@@ -4,29 +4,101 @@ import (
 	"encoding/base64"
 	"flag"
 	"os"
+	"strings"
 
 	. "github.com/0xor1/tlbx/pkg/core"
 	"github.com/0xor1/tlbx/pkg/crypt"
+	"github.com/0xor1/tlbx/pkg/json"
 )
 
 func main() {
 	fs := flag.NewFlagSet("tlbxcrypt", flag.ExitOnError)
 	var t string
-	fs.StringVar(&t, "t", "b", "b for url base64 encoded bytes array or s for ASCII string")
+	fs.StringVar(&t, "t", "b", "b for url base64 encoded bytes array, s for ASCII string, h to benchmark a pwd hasher or r for a rotated session key block")
 	var nTmp uint
-	fs.UintVar(&nTmp, "n", 1, "number of crypt bytes or ASCII characters to generate")
+	fs.UintVar(&nTmp, "n", 1, "number of crypt bytes or ASCII characters to generate, or pwd hashes to time")
 	var lTmp uint
 	fs.UintVar(&lTmp, "l", 64, "length of each crypt byte array or ASCII string")
+	var alg string
+	fs.StringVar(&alg, "alg", crypt.AlgArgon2id, "pwd hasher alg to benchmark, argon2id or scrypt")
+	var hn, hr, hp uint
+	fs.UintVar(&hn, "hn", 64*1024, "argon2id memory KiB or scrypt N")
+	fs.UintVar(&hr, "hr", 3, "argon2id time or scrypt r")
+	fs.UintVar(&hp, "hp", 2, "argon2id threads or scrypt p")
+	var auth, encr string
+	fs.StringVar(&auth, "auth", "", "comma separated current web.session.authKey64s, newest first, to rotate")
+	fs.StringVar(&encr, "encr", "", "comma separated current web.session.encrKey32s, newest first, to rotate")
+	var keepTmp uint
+	fs.UintVar(&keepTmp, "keep", 1, "number of current session key pairs to keep after the new pair when rotating")
 	PanicOn(fs.Parse(os.Args[1:]))
 	n := int(nTmp)
 	l := int(lTmp)
-	if t == "s" {
+	switch t {
+	case "s":
 		for i := 0; i < n; i++ {
 			Println(crypt.UrlSafeString(l))
 		}
-	} else {
+	case "r":
+		Println(rotatedSessionKeys(split(auth), split(encr), int(keepTmp)))
+	case "h":
+		var h crypt.PwdHasher
+		switch alg {
+		case crypt.AlgArgon2id:
+			h = crypt.NewArgon2idHasher(uint32(hr), uint32(hn), uint8(hp), 16, 32)
+		case crypt.AlgScrypt:
+			h = crypt.NewScryptHasher(int(hn), int(hr), int(hp), 256, 256)
+		default:
+			PanicOn(Err("unknown alg %s", alg))
+		}
+		Println(Strf("%s n=%d r=%d p=%d avg hash time %s", alg, hn, hr, hp, crypt.BenchmarkPwdHasher(h, n)))
+	default:
 		for i := 0; i < n; i++ {
 			Println(Strf("%s", base64.RawURLEncoding.EncodeToString(crypt.Bytes(l))))
 		}
 	}
 }
+
+// rotatedSessionKeys returns a config json block with a new session key
+// pair followed by up to keep of the current pairs, and the equivalent
+// env vars, so cookies encoded with the current keys remain valid and are
+// reissued with the new keys.
+func rotatedSessionKeys(auth, encr []string, keep int) string {
+	PanicIf(len(auth) != len(encr), "auth and encr must have the same number of keys")
+	for i := range auth {
+		bs, err := base64.RawURLEncoding.DecodeString(auth[i])
+		PanicOn(err)
+		PanicIf(len(bs) != 64, "auth key %d length is not 64", i)
+		bs, err = base64.RawURLEncoding.DecodeString(encr[i])
+		PanicOn(err)
+		PanicIf(len(bs) != 32, "encr key %d length is not 32", i)
+	}
+	if keep > len(auth) {
+		keep = len(auth)
+	}
+	newAuth := append([]string{base64.RawURLEncoding.EncodeToString(crypt.Bytes(64))}, auth[:keep]...)
+	newEncr := append([]string{base64.RawURLEncoding.EncodeToString(crypt.Bytes(32))}, encr[:keep]...)
+	block := map[string]interface{}{
+		"web": map[string]interface{}{
+			"session": map[string]interface{}{
+				"authKey64s": newAuth,
+				"encrKey32s": newEncr,
+			},
+		},
+	}
+	return Strf(
+		"%s\n\nWEB_SESSION_AUTHKEY64S='%s'\nWEB_SESSION_ENCRKEY32S='%s'",
+		json.MustMarshalIndent(block, "", "  "),
+		json.MustMarshal(newAuth),
+		json.MustMarshal(newEncr))
+}
+
+func split(keys string) []string {
+	res := []string{}
+	for _, k := range strings.Split(keys, ",") {
+		k = strings.TrimSpace(k)
+		if k != "" {
+			res = append(res, k)
+		}
+	}
+	return res
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"os"
+
+	"github.com/0xor1/tlbx/pkg/web/app/user/usermail"
+)
+
+// renders the built in templates, to preview an apps overrides give it
+// its own preview cmd calling usermail.Set.PreviewCmd on its Set.
+func main() {
+	usermail.Default().PreviewCmd(os.Args[1:]...)
+}
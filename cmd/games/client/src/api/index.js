@@ -1,5 +1,12 @@
 import axios from 'axios'
 
+// the csrf token the server sets for the session, it must be sent back in
+// the X-Csrf-Token header on every api request
+let csrfToken = () => {
+  let m = document.cookie.match(/(?:^|;\s*)csrf=([^;]*)/)
+  return m != null ? decodeURIComponent(m[1]) : ''
+}
+
 let newApi = (isMDoApi) => {
   let mDoSending = false
   let mDoSent = false
@@ -10,7 +17,7 @@ let newApi = (isMDoApi) => {
       return axios({
         method: 'put',
         url: path,
-        headers: {"X-Client": "tlbx-web-client"},
+        headers: {"X-Client": "tlbx-web-client", "X-Csrf-Token": csrfToken()},
         data: args
       }).then((res) => {
         return res.data
@@ -241,6 +241,46 @@ func DeleteOutdated(exec func(query string, args ...interface{}), delay time.Dur
 	lastDeleteOutdatedCalledOn = Now()
 }
 
+// OnUpgrade moves anons active game to me when an anonymous player logs
+// in, set it as me.Config.OnUpgrade. If me is already in an active game
+// anons game is left as it is.
+func OnUpgrade(tlbx app.Tlbx, anon, me ID) {
+	tx := service.Get(tlbx).Data().BeginWrite()
+	defer tx.Rollback()
+	var gameType string
+	serialized := make([]byte, 0, 5*app.KB)
+	err := tx.QueryRow(qryGameGetActive(true), anon).Scan(&gameType, &serialized)
+	if sqlh.IsNoRows(err) {
+		return
+	}
+	PanicOn(err)
+	var existingType string
+	existing := make([]byte, 0, 5*app.KB)
+	err = tx.QueryRow(qryGameGetActive(true), me).Scan(&existingType, &existing)
+	if !sqlh.IsNoRows(err) {
+		PanicOn(err)
+		return
+	}
+	b := &Base{}
+	json.MustUnmarshal(serialized, b)
+	for i, p := range b.Players {
+		if p.Equal(anon) {
+			b.Players[i] = me
+		}
+	}
+	b.UpdatedOn = NowMilli()
+	// only the base fields change so the game specific fields are left
+	// as they are
+	js := json.MustFromBytes(serialized)
+	PanicOn(js.Set("players", b.Players))
+	PanicOn(js.Set("updatedOn", b.UpdatedOn))
+	serialized = json.MustMarshal(js)
+	tx.MustExec(qryPlayerUpdateID(), me, anon, b.ID)
+	tx.MustExec(qryGameUpdate(), b.UpdatedOn, b.IsActive(), serialized, b.ID, gameType)
+	tx.Commit()
+	cacheSerializedGame(tlbx, gameType, b.ID, serialized)
+}
+
 func getUsersActiveGame(tlbx app.Tlbx, tx sql.Tx, forUpdate bool, gameType string, dst Game) (Game, string) {
 	PanicIf(forUpdate && tx == nil, "tx required forUpdate get call")
 	PanicIf(!forUpdate && tx != nil, "tx must be nil if it is a not forUpdate get call")
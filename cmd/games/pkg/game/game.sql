@@ -70,4 +70,13 @@ INSERT INTO players (
     ?
 )
 {%- endcollapsespace -%}
+{%- endfunc -%}
+
+{%- func qryPlayerUpdateID() -%}
+{%- collapsespace -%}
+UPDATE players
+SET id=?
+WHERE id=?
+AND game=?
+{%- endcollapsespace -%}
 {%- endfunc -%}
\ No newline at end of file
@@ -127,3 +127,21 @@ func qryPlayerInsert() string {
 	qt422016.ReleaseByteBuffer(qb422016)
 	return qs422016
 }
+
+func streamqryPlayerUpdateID(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`UPDATE players SET id=? WHERE id=? AND game=? `)
+}
+
+func writeqryPlayerUpdateID(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryPlayerUpdateID(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryPlayerUpdateID() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryPlayerUpdateID(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
@@ -1,14 +1,20 @@
 package main
 
 import (
+	"net/http"
+
 	"github.com/0xor1/tlbx/cmd/todo/pkg/config"
 	"github.com/0xor1/tlbx/cmd/todo/pkg/item/itemeps"
 	"github.com/0xor1/tlbx/cmd/todo/pkg/list/listeps"
+	"github.com/0xor1/tlbx/pkg/pwdpolicy"
 	"github.com/0xor1/tlbx/pkg/web/app"
+	"github.com/0xor1/tlbx/pkg/web/app/csrf"
 	"github.com/0xor1/tlbx/pkg/web/app/ratelimit"
 	"github.com/0xor1/tlbx/pkg/web/app/service"
 	"github.com/0xor1/tlbx/pkg/web/app/session"
+	"github.com/0xor1/tlbx/pkg/web/app/session/me"
 	"github.com/0xor1/tlbx/pkg/web/app/user/usereps"
+	"github.com/0xor1/tlbx/pkg/web/server"
 )
 
 func main() {
@@ -17,18 +23,72 @@ func main() {
 	app.Run(func(c *app.Config) {
 		c.StaticDir = config.Web.StaticDir
 		c.ContentSecurityPolicies = config.Web.ContentSecurityPolicies
+		c.TrustedProxies = config.Web.TrustedProxies
 		c.Name = "Todo"
 		c.Description = "A simple Todo list application, create multiple lists with many items which can be marked complete or uncomplete"
 		c.TlbxSetup = app.TlbxMwares{
-			session.BasicMware(
-				config.Web.Session.AuthKey64s,
-				config.Web.Session.EncrKey32s,
-				config.Web.Session.Secure),
-			ratelimit.MeMware(config.Redis.RateLimit, config.Web.RateLimit),
+			session.Mware(func(c *session.Config) {
+				c.AuthKey64s = config.Web.Session.AuthKey64s
+				c.EncrKey32s = config.Web.Session.EncrKey32s
+				c.Secure = config.Web.Session.Secure
+				c.AbsoluteTimeout = config.Web.Session.AbsoluteTimeout
+				c.IdleTimeout = config.Web.Session.IdleTimeout
+			}),
+			csrf.Mware(func(c *csrf.Config) {
+				c.AllowedHosts = config.Web.StaticHostWhiteList
+			}),
+			me.Mware(config.Redis.Cache, func(c *me.Config) {
+				c.IsDisabled = usereps.IsDisabled(config.SQL.User)
+			}),
+			ratelimit.Mware(func(c *ratelimit.Config) {
+				c.KeyGen = ratelimit.MeKeyGen
+				c.Pool = config.Redis.RateLimit
+				c.PerMinute = config.Web.RateLimit
+				c.GCRA = config.Web.RateLimitGCRA
+				c.Rules = append(usereps.RateLimitRules(), ratelimit.PingRule())
+			}),
 			service.Mware(config.Redis.Cache, config.SQL.User, config.SQL.Pwd, config.SQL.Data, config.Email, config.Store, config.FCM),
+			usereps.ImpersonationAuditMware,
 		}
 		c.Version = config.Version
 		c.Log = config.Log
+		c.Serve = func(h http.HandlerFunc, onShutdown func()) {
+			server.Run(func(c *server.Config) {
+				c.AppBindTo = config.Web.AppBindTo
+				c.Log = config.Log
+				c.Handler = h
+				c.ReadHeaderTimeout = config.Web.ReadHeaderTimeout
+				c.ReadTimeout = config.Web.ReadTimeout
+				c.WriteTimeout = config.Web.WriteTimeout
+				c.IdleTimeout = config.Web.IdleTimeout
+				c.MaxHeaderBytes = config.Web.MaxHeaderBytes
+				c.DrainPeriod = config.Web.DrainPeriod
+				c.OnShutdown = onShutdown
+				c.H2C = config.Web.H2C
+				c.MaxConns = config.Web.MaxConns
+				c.UseHttps = config.Web.TLS.CertFile != ""
+				c.CertFile = config.Web.TLS.CertFile
+				c.KeyFile = config.Web.TLS.KeyFile
+				c.CertBindTo = config.Web.TLS.CertBindTo
+				c.ClientCAFile = config.Web.TLS.ClientCAFile
+				c.ClientAuth = config.Web.TLS.ClientAuth
+				c.MinTLSVersion = config.Web.TLS.MinVersion
+				c.CipherSuites = config.Web.TLS.CipherSuites
+			})
+		}
+		userConfig := func(c *usereps.Config) {
+			c.UnlockFmtLink = config.App.UnlockFmtLink
+			c.RestoreFmtLink = config.App.RestoreFmtLink
+			c.InviteFmtLink = config.App.InviteFmtLink
+			c.RevertChangeEmailFmtLink = config.App.RevertChangeEmailFmtLink
+			c.RegistrationMode = config.App.RegistrationMode
+			c.RequirePow = config.App.RequirePow
+			c.PwdPolicy.MinEntropy = float64(config.App.PwdMinEntropy)
+			if config.App.BreachedPwdsDir != "" {
+				c.PwdPolicy.Corpus = pwdpolicy.NewDirCorpus(config.App.BreachedPwdsDir)
+			}
+		}
+		c.Tickers = usereps.Tickers(listeps.OnDelete, userConfig)
 		c.Endpoints = append(
 			append(
 				append(
@@ -38,10 +98,12 @@ func main() {
 						config.App.ActivateFmtLink,
 						config.App.LoginLinkFmtLink,
 						config.App.ConfirmChangeEmailFmtLink,
+						config.App.ResetPwdFmtLink,
 						listeps.OnDelete,
 						nil,
 						nil,
-						false)...),
+						false,
+						userConfig)...),
 				listeps.Eps...),
 			itemeps.Eps...)
 	})
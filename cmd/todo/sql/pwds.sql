@@ -7,6 +7,7 @@ USE todo_pwds;
 DROP TABLE IF EXISTS pwds;
 CREATE TABLE pwds(
 	id BINARY(16) NOT NULL,
+	alg    VARCHAR(20) NOT NULL DEFAULT 'scrypt',
 	salt   VARBINARY(256) NOT NULL,
 	pwd    VARBINARY(256) NOT NULL,
 	n      MEDIUMINT UNSIGNED NOT NULL,
@@ -71,6 +71,13 @@ fcm.onMessage((msg) => {
   }
 })
 
+// the csrf token the server sets for the session, it must be sent back in
+// the X-Csrf-Token header on every api request
+let csrfToken = () => {
+  let m = document.cookie.match(/(?:^|;\s*)csrf=([^;]*)/)
+  return m != null ? decodeURIComponent(m[1]) : ''
+}
+
 let notAuthed = false
 let memCache = {}
 let meInFlight = false
@@ -78,9 +85,20 @@ let userGetInFlight = {}
 let globalErrorHandler = null
 let fcmUnregisterFnCalled = false
 let fcmUnregisterFn = () => {
-  if (memCache.me != null && fcmUnregisterFnCalled == false && fcmClientId != null && navigator.sendBeacon != null) {
+  if (memCache.me != null && fcmUnregisterFnCalled == false && fcmClientId != null && window.fetch != null) {
     fcmUnregisterFnCalled = true
-    navigator.sendBeacon(`/api/user/unregisterFromFCM?args={"client":"${fcmClientId}"}`)
+    // keepalive lets the request outlive the page like sendBeacon, but
+    // unlike sendBeacon it can send the X-Client and X-Csrf-Token headers
+    fetch('/api/user/unregisterFromFCM', {
+      method: 'PUT',
+      keepalive: true,
+      headers: {
+        "Content-Type": "application/json",
+        "X-Client": "tlbx-web-client",
+        "X-Csrf-Token": csrfToken()
+      },
+      body: JSON.stringify({ client: fcmClientId })
+    })
   }
 }
 window.addEventListener("unload", fcmUnregisterFn);
@@ -111,6 +129,7 @@ function newApi(isMDoApi) {
     if (!isMDoApi || (isMDoApi && mDoSending && !mDoSent)) {
       headers = headers || {}
       headers["X-Client"] = "tlbx-web-client"
+      headers["X-Csrf-Token"] = csrfToken()
       if (fcmClientId != null) {
         headers["X-Fcm-Client"] = fcmClientId
       }
@@ -1,7 +1,9 @@
 package projecteps
 
 import (
+	"archive/zip"
 	"bytes"
+	"io"
 	"net/http"
 	"strings"
 	"time"
@@ -16,6 +18,7 @@ import (
 	"github.com/0xor1/tlbx/pkg/json"
 	"github.com/0xor1/tlbx/pkg/ptr"
 	"github.com/0xor1/tlbx/pkg/sqlh"
+	"github.com/0xor1/tlbx/pkg/store"
 	"github.com/0xor1/tlbx/pkg/web/app"
 	"github.com/0xor1/tlbx/pkg/web/app/service"
 	"github.com/0xor1/tlbx/pkg/web/app/service/sql"
@@ -758,6 +761,93 @@ func OnDelete(tlbx app.Tlbx, me ID) {
 	tx.Commit()
 }
 
+// OnExport adds every row hosted or authored by me to the users data
+// export as trees/<table>.json and the content of each of those files as
+// trees/files/<host>/<project>/<task>/<id>_<name>.
+func OnExport(tlbx app.Tlbx, me ID, zw *zip.Writer) {
+	srv := service.Get(tlbx)
+	tx := srv.Data().BeginRead()
+	defer tx.Rollback()
+	for _, t := range []struct {
+		name string
+		// the column identifying the user in projects hosted by others
+		author string
+	}{
+		{"projects", ""},
+		{"users", "id"},
+		{"activities", "user"},
+		{"tasks", "createdBy"},
+		{"vitems", "createdBy"},
+		{"files", "createdBy"},
+		{"comments", "createdBy"},
+	} {
+		qry := Strf(`SELECT * FROM %s WHERE host=?`, t.name)
+		args := []interface{}{me}
+		if t.author != "" {
+			qry += Strf(` OR %s=?`, t.author)
+			args = append(args, me)
+		}
+		f, err := zw.Create(Strf("trees/%s.json", t.name))
+		PanicOn(err)
+		write := func(bs []byte) {
+			_, err := f.Write(bs)
+			PanicOn(err)
+		}
+		// rows are streamed into the json array rather than held in
+		// memory as tables may be large
+		write([]byte("["))
+		empty := true
+		tx.MustQuery(func(rs *sqlx.Rows) {
+			cts, err := rs.ColumnTypes()
+			PanicOn(err)
+			for rs.Next() {
+				row := map[string]interface{}{}
+				PanicOn(rs.MapScan(row))
+				for _, ct := range cts {
+					if bs, ok := row[ct.Name()].([]byte); ok {
+						if ct.DatabaseTypeName() == "BINARY" {
+							id := ID{}
+							PanicOn(id.UnmarshalBinary(bs))
+							row[ct.Name()] = id
+						} else {
+							row[ct.Name()] = string(bs)
+						}
+					}
+				}
+				if !empty {
+					write([]byte(","))
+				}
+				empty = false
+				write([]byte("\n  "))
+				write(json.MustMarshalIndent(row, "  ", "  "))
+			}
+		}, qry, args...)
+		if !empty {
+			write([]byte("\n"))
+		}
+		write([]byte("]"))
+	}
+	files := make([]*struct {
+		Host    ID
+		Project ID
+		Task    ID
+		ID      ID
+		Name    string
+	}, 0, 100)
+	tx.MustGetN(&files, `SELECT host, project, task, id, name FROM files WHERE host=? OR createdBy=?`, me, me)
+	tx.Commit()
+	for _, file := range files {
+		func() {
+			_, _, _, content := srv.Store().MustGet(cnsts.FileBucket, store.GenKey("", file.Host, file.Project, file.Task, file.ID))
+			defer content.Close()
+			f, err := zw.Create(Strf("trees/files/%s/%s/%s/%s_%s", file.Host, file.Project, file.Task, file.ID, file.Name))
+			PanicOn(err)
+			_, err = io.Copy(f, content)
+			PanicOn(err)
+		}()
+	}
+}
+
 func OnSetSocials(tlbx app.Tlbx, user *user.User) {
 	srv := service.Get(tlbx)
 	tx := srv.Data().BeginWrite()
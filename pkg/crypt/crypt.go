@@ -2,10 +2,13 @@ package crypt
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
 	"io"
 	"math/big"
+	"time"
 
 	. "github.com/0xor1/tlbx/pkg/core"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/scrypt"
 )
 
@@ -34,3 +37,156 @@ func ScryptKey(password, salt []byte, N, r, p, keyLen int) []byte {
 	PanicOn(err)
 	return key
 }
+
+// PwdHash is a hashed pwd along with everything needed to verify it,
+// N, R and P are algorithm specific parameters, see each PwdHasher.
+type PwdHash struct {
+	Alg  string
+	Salt []byte
+	Pwd  []byte
+	N    int
+	R    int
+	P    int
+}
+
+type PwdHasher interface {
+	// Alg is the identifier stored with each hash
+	Alg() string
+	// Hash hashes pwd with a new random salt using the hashers current params
+	Hash(pwd []byte) *PwdHash
+	// Verify checks pwd against hash using the params stored in hash
+	Verify(pwd []byte, hash *PwdHash) bool
+	// NeedsRehash is true if hash was not created with this hashers current
+	// alg and params
+	NeedsRehash(hash *PwdHash) bool
+}
+
+const (
+	AlgScrypt   = "scrypt"
+	AlgArgon2id = "argon2id"
+)
+
+// VerifyPwd checks pwd against hash using whichever of hashers
+// matches the hashes alg, returns false if none match.
+func VerifyPwd(pwd []byte, hash *PwdHash, hashers ...PwdHasher) bool {
+	if hash == nil {
+		return false
+	}
+	for _, h := range hashers {
+		if h.Alg() == hash.Alg {
+			return h.Verify(pwd, hash)
+		}
+	}
+	return false
+}
+
+// BenchmarkPwdHasher returns the mean duration of n calls to h.Hash
+// so operators can tune hasher params to their machines.
+func BenchmarkPwdHasher(h PwdHasher, n int) time.Duration {
+	PanicIf(n < 1, "n must be >= 1")
+	pwd := Bytes(16)
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		h.Hash(pwd)
+	}
+	return time.Since(start) / time.Duration(n)
+}
+
+// NewScryptHasher stores N, r and p in PwdHash N, R and P.
+func NewScryptHasher(n, r, p, saltLen, keyLen int) PwdHasher {
+	return &scryptHasher{
+		n:       n,
+		r:       r,
+		p:       p,
+		saltLen: saltLen,
+		keyLen:  keyLen,
+	}
+}
+
+type scryptHasher struct {
+	n       int
+	r       int
+	p       int
+	saltLen int
+	keyLen  int
+}
+
+func (h *scryptHasher) Alg() string {
+	return AlgScrypt
+}
+
+func (h *scryptHasher) Hash(pwd []byte) *PwdHash {
+	salt := Bytes(h.saltLen)
+	return &PwdHash{
+		Alg:  AlgScrypt,
+		Salt: salt,
+		Pwd:  ScryptKey(pwd, salt, h.n, h.r, h.p, h.keyLen),
+		N:    h.n,
+		R:    h.r,
+		P:    h.p,
+	}
+}
+
+func (h *scryptHasher) Verify(pwd []byte, hash *PwdHash) bool {
+	return hash.Alg == AlgScrypt &&
+		subtle.ConstantTimeCompare(hash.Pwd, ScryptKey(pwd, hash.Salt, hash.N, hash.R, hash.P, len(hash.Pwd))) == 1
+}
+
+func (h *scryptHasher) NeedsRehash(hash *PwdHash) bool {
+	return hash.Alg != AlgScrypt ||
+		len(hash.Salt) != h.saltLen ||
+		len(hash.Pwd) != h.keyLen ||
+		hash.N != h.n ||
+		hash.R != h.r ||
+		hash.P != h.p
+}
+
+// NewArgon2idHasher stores memory (KiB), time and threads in
+// PwdHash N, R and P.
+func NewArgon2idHasher(time, memory uint32, threads uint8, saltLen, keyLen int) PwdHasher {
+	return &argon2idHasher{
+		time:    time,
+		memory:  memory,
+		threads: threads,
+		saltLen: saltLen,
+		keyLen:  keyLen,
+	}
+}
+
+type argon2idHasher struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+	saltLen int
+	keyLen  int
+}
+
+func (h *argon2idHasher) Alg() string {
+	return AlgArgon2id
+}
+
+func (h *argon2idHasher) Hash(pwd []byte) *PwdHash {
+	salt := Bytes(h.saltLen)
+	return &PwdHash{
+		Alg:  AlgArgon2id,
+		Salt: salt,
+		Pwd:  argon2.IDKey(pwd, salt, h.time, h.memory, h.threads, uint32(h.keyLen)),
+		N:    int(h.memory),
+		R:    int(h.time),
+		P:    int(h.threads),
+	}
+}
+
+func (h *argon2idHasher) Verify(pwd []byte, hash *PwdHash) bool {
+	return hash.Alg == AlgArgon2id &&
+		subtle.ConstantTimeCompare(hash.Pwd, argon2.IDKey(pwd, hash.Salt, uint32(hash.R), uint32(hash.N), uint8(hash.P), uint32(len(hash.Pwd)))) == 1
+}
+
+func (h *argon2idHasher) NeedsRehash(hash *PwdHash) bool {
+	return hash.Alg != AlgArgon2id ||
+		len(hash.Salt) != h.saltLen ||
+		len(hash.Pwd) != h.keyLen ||
+		hash.N != int(h.memory) ||
+		hash.R != int(h.time) ||
+		hash.P != int(h.threads)
+}
@@ -36,3 +36,54 @@ func Test_ScryptKey(t *testing.T) {
 	scryptPwd = ScryptKey(pwd, salt, l, l, l, l)
 	assert.Equal(t, l, len(scryptPwd))
 }
+
+func Test_ScryptHasher(t *testing.T) {
+	a := assert.New(t)
+	h := NewScryptHasher(16, 8, 1, 8, 16)
+	hash := h.Hash([]byte("pwd"))
+	a.Equal(AlgScrypt, hash.Alg)
+	a.Equal(8, len(hash.Salt))
+	a.Equal(16, len(hash.Pwd))
+	a.True(h.Verify([]byte("pwd"), hash))
+	a.False(h.Verify([]byte("not pwd"), hash))
+	a.False(h.NeedsRehash(hash))
+	a.True(NewScryptHasher(32, 8, 1, 8, 16).NeedsRehash(hash))
+	// verify uses the params stored in the hash not the hashers current params
+	a.True(NewScryptHasher(32, 8, 1, 8, 16).Verify([]byte("pwd"), hash))
+}
+
+func Test_Argon2idHasher(t *testing.T) {
+	a := assert.New(t)
+	h := NewArgon2idHasher(1, 64, 1, 16, 32)
+	hash := h.Hash([]byte("pwd"))
+	a.Equal(AlgArgon2id, hash.Alg)
+	a.Equal(16, len(hash.Salt))
+	a.Equal(32, len(hash.Pwd))
+	a.Equal(64, hash.N)
+	a.Equal(1, hash.R)
+	a.Equal(1, hash.P)
+	a.True(h.Verify([]byte("pwd"), hash))
+	a.False(h.Verify([]byte("not pwd"), hash))
+	a.False(h.NeedsRehash(hash))
+	a.True(NewArgon2idHasher(2, 64, 1, 16, 32).NeedsRehash(hash))
+	a.True(NewArgon2idHasher(2, 64, 1, 16, 32).Verify([]byte("pwd"), hash))
+}
+
+func Test_VerifyPwd(t *testing.T) {
+	a := assert.New(t)
+	s := NewScryptHasher(16, 8, 1, 8, 16)
+	ar := NewArgon2idHasher(1, 64, 1, 16, 32)
+	sHash := s.Hash([]byte("pwd"))
+	arHash := ar.Hash([]byte("pwd"))
+	a.True(VerifyPwd([]byte("pwd"), sHash, ar, s))
+	a.True(VerifyPwd([]byte("pwd"), arHash, ar, s))
+	a.False(VerifyPwd([]byte("pwd"), sHash, ar))
+	a.False(VerifyPwd([]byte("pwd"), nil, ar, s))
+	a.True(ar.NeedsRehash(sHash))
+	a.True(s.NeedsRehash(arHash))
+}
+
+func Test_BenchmarkPwdHasher(t *testing.T) {
+	a := assert.New(t)
+	a.True(BenchmarkPwdHasher(NewArgon2idHasher(1, 64, 1, 16, 32), 2) > 0)
+}
@@ -292,6 +292,40 @@ func (j *Json) Scan(src interface{}) error {
 	return Err("unexpected scan value: %v, type: %T", src, src)
 }
 
+// MergePatch returns the result of applying patch to target as defined
+// by RFC 7396, target and patch are not modified but the result may share
+// values with them.
+func MergePatch(target, patch *Json) *Json {
+	var t, p interface{}
+	if target != nil {
+		t = target.data
+	}
+	if patch != nil {
+		p = patch.data
+	}
+	return &Json{data: mergePatch(t, p)}
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, _ := target.(map[string]interface{})
+	res := make(map[string]interface{}, len(t))
+	for k, v := range t {
+		res[k] = v
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(res, k)
+		} else {
+			res[k] = mergePatch(res[k], v)
+		}
+	}
+	return res
+}
+
 func (j *Json) Exists(path ...interface{}) bool {
 	_, err := j.Get(path...)
 	return ToError(err) == nil
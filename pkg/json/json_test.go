@@ -1921,3 +1921,32 @@ func Test_MustUint64Slice(t *testing.T) {
 	val := obj.MustUint64Slice()
 	a.Equal([]uint64{0, 1, 2}, val, "val is correct")
 }
+
+func Test_MergePatch(t *testing.T) {
+	a := assert.New(t)
+	// examples from RFC 7396 appendix A
+	for _, tc := range [][3]string{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	} {
+		target := MustFromString(tc[0])
+		targetStr := target.MustToString()
+		res := MergePatch(target, MustFromString(tc[1]))
+		a.Equal(tc[2], res.MustToString())
+		a.Equal(targetStr, target.MustToString())
+	}
+	a.Equal(`{"a":1}`, MergePatch(nil, MustFromString(`{"a":1}`)).MustToString())
+}
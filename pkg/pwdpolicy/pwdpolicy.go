@@ -0,0 +1,160 @@
+package pwdpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	. "github.com/0xor1/tlbx/pkg/core"
+)
+
+// Reason is why a pwd was rejected, OK means it was not.
+type Reason string
+
+const (
+	OK             Reason = ""
+	Breached       Reason = "breached"
+	LowEntropy     Reason = "lowEntropy"
+	ContainsEmail  Reason = "containsEmail"
+	ContainsHandle Reason = "containsHandle"
+
+	// identifiers shorter than this are not checked for, e.g. a handle
+	// of "jo" would reject too many reasonable pwds.
+	minIdentifierLen = 3
+)
+
+// Corpus is a set of known breached pwds.
+type Corpus interface {
+	Contains(pwd string) bool
+}
+
+// NewDirCorpus returns a Corpus stored in dir in the k-anonymity range
+// format, the uppercase hex sha1 of each pwd is split into a 5 char
+// prefix, which names the file, and a 35 char suffix which is written on
+// its own line in that file optionally followed by ":count". Missing
+// prefix files are treated as empty so a partial corpus may be used.
+func NewDirCorpus(dir string) Corpus {
+	return &dirCorpus{dir: dir}
+}
+
+type dirCorpus struct {
+	dir string
+}
+
+func (c *dirCorpus) Contains(pwd string) bool {
+	hash := sha1.Sum([]byte(pwd))
+	hexHash := strings.ToUpper(hex.EncodeToString(hash[:]))
+	prefix, suffix := hexHash[:5], hexHash[5:]
+	f, err := os.Open(filepath.Join(c.dir, prefix))
+	if os.IsNotExist(err) {
+		return false
+	}
+	PanicOn(err)
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, ":"); i > -1 {
+			line = line[:i]
+		}
+		if strings.EqualFold(line, suffix) {
+			return true
+		}
+	}
+	PanicOn(scanner.Err())
+	return false
+}
+
+// Policy is the set of checks a new pwd must pass, the zero value
+// accepts every pwd.
+type Policy struct {
+	// Corpus if not nil rejects any pwd it contains.
+	Corpus Corpus
+	// MinEntropy is the minimum number of bits of entropy as estimated
+	// by Entropy.
+	MinEntropy float64
+	// DisallowEmail rejects pwds containing the local part of the email.
+	DisallowEmail bool
+	// DisallowHandle rejects pwds containing the handle.
+	DisallowHandle bool
+}
+
+// Check returns the first Reason pwd fails p, or OK, identifier checks
+// are case insensitive.
+func (p *Policy) Check(pwd, email string, handle *string) Reason {
+	lowerPwd := strings.ToLower(pwd)
+	if p.DisallowEmail {
+		local := email
+		if i := strings.LastIndex(local, "@"); i > -1 {
+			local = local[:i]
+		}
+		if containsIdentifier(lowerPwd, local) {
+			return ContainsEmail
+		}
+	}
+	if p.DisallowHandle && handle != nil && containsIdentifier(lowerPwd, *handle) {
+		return ContainsHandle
+	}
+	if p.MinEntropy > 0 && Entropy(pwd) < p.MinEntropy {
+		return LowEntropy
+	}
+	if p.Corpus != nil && p.Corpus.Contains(pwd) {
+		return Breached
+	}
+	return OK
+}
+
+func containsIdentifier(lowerPwd, identifier string) bool {
+	identifier = strings.ToLower(identifier)
+	return StrLen(identifier) >= minIdentifierLen && strings.Contains(lowerPwd, identifier)
+}
+
+// Entropy estimates the bits of entropy in pwd from the size of the
+// character classes it uses, characters that repeat or continue a
+// sequence from the previous character, e.g. "aa" or "ab", only add 1 bit.
+func Entropy(pwd string) float64 {
+	pool := 0
+	var lower, upper, digit, symbol, other bool
+	for _, r := range pwd {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	perChar := math.Log2(float64(pool))
+	bits := 0.0
+	prev := rune(-10)
+	for _, r := range pwd {
+		if d := r - prev; d >= -1 && d <= 1 {
+			bits++
+		} else {
+			bits += perChar
+		}
+		prev = r
+	}
+	return bits
+}
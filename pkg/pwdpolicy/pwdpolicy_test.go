@@ -0,0 +1,62 @@
+package pwdpolicy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/0xor1/tlbx/pkg/core"
+	"github.com/0xor1/tlbx/pkg/ptr"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DirCorpus(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "pwdpolicy")
+	PanicOn(err)
+	defer os.RemoveAll(dir)
+
+	hash := sha1.Sum([]byte("password1"))
+	hexHash := strings.ToUpper(hex.EncodeToString(hash[:]))
+	PanicOn(ioutil.WriteFile(filepath.Join(dir, hexHash[:5]), []byte("0000000000000000000000000000000000A:1\n"+strings.ToLower(hexHash[5:])+":123\n"), 0600))
+
+	c := NewDirCorpus(dir)
+	a.True(c.Contains("password1"))
+	a.False(c.Contains("password2"))
+}
+
+type corpus map[string]bool
+
+func (c corpus) Contains(pwd string) bool {
+	return c[pwd]
+}
+
+func Test_Check(t *testing.T) {
+	a := assert.New(t)
+	p := &Policy{}
+	a.Equal(OK, p.Check("aaaa", "joe@bloggs.example", ptr.String("joe")))
+
+	p = &Policy{
+		Corpus:         corpus{"1aA$_t;3Breached": true},
+		MinEntropy:     40,
+		DisallowEmail:  true,
+		DisallowHandle: true,
+	}
+	a.Equal(ContainsEmail, p.Check("1aA$_t;3JOEB", "joeb@bloggs.example", nil))
+	a.Equal(ContainsHandle, p.Check("1aA$_t;3Bloe_Joggs", "joe@bloggs.example", ptr.String("bloe_joggs")))
+	a.Equal(OK, p.Check("1aA$_t;3jo", "jo@bloggs.example", ptr.String("jo")))
+	a.Equal(LowEntropy, p.Check("aaaaaaaaaaaaaaaaaaaa", "joe@bloggs.example", nil))
+	a.Equal(Breached, p.Check("1aA$_t;3Breached", "joe@bloggs.example", nil))
+	a.Equal(OK, p.Check("1aA$_t;3Unbreached", "joe@bloggs.example", nil))
+}
+
+func Test_Entropy(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(0.0, Entropy(""))
+	a.InDelta(4.7+7, Entropy("abcdefgh"), 0.01)
+	a.True(Entropy("1aA$_t;3") > 50)
+}
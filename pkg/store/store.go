@@ -35,6 +35,8 @@ type Client interface {
 	MustGet(bucket, key string) (string, string, int64, io.ReadCloser)
 	PresignedGetUrl(bucket, key string, name string, isAttachment bool) (string, error)
 	MustPresignedGetUrl(bucket, key string, name string, isAttachment bool) string
+	PresignedGetUrlExpires(bucket, key string, name string, isAttachment bool, expires time.Duration) (string, error)
+	MustPresignedGetUrlExpires(bucket, key string, name string, isAttachment bool, expires time.Duration) string
 	Delete(bucket, key string) error
 	MustDelete(bucket, key string)
 	DeletePrefix(bucket, prefix string) error
@@ -111,7 +113,7 @@ func (c *client) StreamUp(bucket, key, name, mimeType string, size int64, isPubl
 	if resp != nil && resp.Body != nil {
 		defer resp.Body.Close()
 	}
-	if err != err {
+	if err != nil {
 		return ToError(err)
 	}
 	body, err := ioutil.ReadAll(resp.Body)
@@ -182,9 +184,7 @@ func (c *client) MustGet(bucket, key string) (string, string, int64, io.ReadClos
 }
 
 func (c *client) PresignedGetUrl(bucket, key string, name string, isAttachment bool) (string, error) {
-	req, _ := c.getReq(bucket, key, name, isAttachment)
-	url, err := req.Presign(10 * time.Minute)
-	return url, ToError(err)
+	return c.PresignedGetUrlExpires(bucket, key, name, isAttachment, 10*time.Minute)
 }
 
 func (c *client) MustPresignedGetUrl(bucket, key string, name string, isAttachment bool) string {
@@ -193,6 +193,18 @@ func (c *client) MustPresignedGetUrl(bucket, key string, name string, isAttachme
 	return str
 }
 
+func (c *client) PresignedGetUrlExpires(bucket, key string, name string, isAttachment bool, expires time.Duration) (string, error) {
+	req, _ := c.getReq(bucket, key, name, isAttachment)
+	url, err := req.Presign(expires)
+	return url, ToError(err)
+}
+
+func (c *client) MustPresignedGetUrlExpires(bucket, key string, name string, isAttachment bool, expires time.Duration) string {
+	str, err := c.PresignedGetUrlExpires(bucket, key, name, isAttachment, expires)
+	PanicOn(err)
+	return str
+}
+
 func (c *client) Delete(bucket, key string) error {
 	_, err := c.s3.DeleteObject(&s3.DeleteObjectInput{
 		Bucket: ptr.String(bucket),
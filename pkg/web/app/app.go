@@ -20,6 +20,7 @@ import (
 	"github.com/0xor1/tlbx/pkg/log"
 	"github.com/0xor1/tlbx/pkg/ptr"
 	"github.com/0xor1/tlbx/pkg/web/server"
+	"github.com/0xor1/tlbx/pkg/web/server/realip"
 )
 
 const (
@@ -29,6 +30,10 @@ const (
 
 	ApiPathPrefix        = "/api"
 	ApiPathPrefixSegment = ApiPathPrefix + "/"
+	// CSRFCookie is the default cookie name the session csrf token is
+	// written to and CSRFHeader is the header Client sends it back in.
+	CSRFCookie = "csrf"
+	CSRFHeader = "X-Csrf-Token"
 )
 
 type SelfValidator interface {
@@ -41,6 +46,9 @@ type Config struct {
 	StaticDir               string
 	ProvideApiDocs          bool
 	ContentSecurityPolicies []string
+	// TrustedProxies are the CIDRs of proxies whose forwarding headers
+	// are trusted when resolving Tlbx.IP, by default none are.
+	TrustedProxies []string
 	// id
 	IDGenPoolSize int
 	// mdo
@@ -53,7 +61,12 @@ type Config struct {
 	Name        string
 	Description string
 	Endpoints   []*Endpoint
-	Serve       func(http.HandlerFunc)
+	Tickers     []*Ticker
+	// Serve must call onShutdown when the server starts shutting down,
+	// e.g. by passing it as server.Config.OnShutdown, it closes
+	// Tlbx.ShuttingDown so long lived responses, e.g. SSE, can end
+	// cleanly rather than being cut off when the drain period ends.
+	Serve func(h http.HandlerFunc, onShutdown func())
 }
 
 func JoinEps(epss ...[]*Endpoint) []*Endpoint {
@@ -82,6 +95,10 @@ func Run(configs ...func(*Config)) {
 	csps := strings.Join(append([]string{"default-src 'self'"}, c.ContentSecurityPolicies...), ";")
 	// id pool
 	idGenPool := NewIDGenPool(c.IDGenPoolSize)
+	// real ip
+	ipResolver := realip.MustNew(c.TrustedProxies...)
+	// closed when the server starts shutting down
+	shuttingDown := make(chan struct{})
 	// endpoints
 	c.Endpoints = JoinEps(defaultEps, c.Endpoints)
 	router := make(map[string]*Endpoint, len(c.Endpoints))
@@ -160,6 +177,7 @@ func Run(configs ...func(*Config)) {
 			root:           root,
 			resp:           &responseWrapper{w: w},
 			req:            r,
+			ip:             ipResolver.FromRequest(r),
 			start:          NowMilli(),
 			idGenPool:      idGenPool,
 			isSubMDo:       isSubMDo(r),
@@ -168,6 +186,9 @@ func Run(configs ...func(*Config)) {
 			actionStats:    make([]*ActionStats, 0, 10),
 			storeMtx:       &sync.RWMutex{},
 			store:          map[interface{}]interface{}{},
+			setup:          c.TlbxSetup,
+			cleanup:        c.TlbxCleanup,
+			shuttingDown:   shuttingDown,
 		}
 		tlbx.startMilli = tlbx.start.UnixNano() / 1000000
 		// close body
@@ -183,6 +204,7 @@ func Run(configs ...func(*Config)) {
 				Status:  tlbx.resp.status,
 				Method:  tlbx.req.Method,
 				Path:    tlbx.req.URL.Path,
+				IP:      tlbx.ip,
 				Queries: tlbx.actionStats,
 			})
 		}()
@@ -235,6 +257,13 @@ func Run(configs ...func(*Config)) {
 		// endpoints
 		ep, exists := router[tlbx.req.URL.Path]
 		ReturnIf(!exists, http.StatusNotFound, "")
+		// only downloads may be GET, lax session cookies are sent on cross
+		// site top level GETs which can't carry the csrf header, so GETs
+		// must never change state.
+		if method == http.MethodGet {
+			_, isDownload := ep.GetExampleResponse().(*DownStream)
+			BadReqIf(!isDownload && ep != pingEp, "GET is only accepted by download endpoints")
+		}
 		// check all requests have a X-Client header
 		BadReqIf(!ep.SkipXClientCheck && tlbx.req.Header.Get("X-Client") == "", "X-Client header missing")
 
@@ -290,7 +319,9 @@ func Run(configs ...func(*Config)) {
 				defer s.Content.Close()
 				BadReqIf(tlbx.isSubMDo, "can not call stream endpoint in an mdo request")
 				tlbx.resp.Header().Add("Content-Type", s.Type)
-				tlbx.resp.Header().Add("Content-Length", Strf("%d", s.Size))
+				if s.Size >= 0 {
+					tlbx.resp.Header().Add("Content-Length", Strf("%d", s.Size))
+				}
 				tlbx.resp.Header().Add("Content-Name", Strf("%s", s.Name))
 				tlbx.resp.Header().Add("Content-Id", Strf("%s", s.ID))
 				if s.IsDownload {
@@ -324,7 +355,24 @@ func Run(configs ...func(*Config)) {
 			do()
 		}
 	}
-	c.Serve(root)
+	bg := &tlbx{
+		mDoMax:       c.MDoMax,
+		root:         root,
+		idGenPool:    idGenPool,
+		log:          c.Log,
+		setup:        c.TlbxSetup,
+		cleanup:      c.TlbxCleanup,
+		shuttingDown: shuttingDown,
+	}
+	for _, t := range c.Tickers {
+		startTicker(bg, t)
+	}
+	closeShuttingDown := &sync.Once{}
+	c.Serve(root, func() {
+		closeShuttingDown.Do(func() {
+			close(shuttingDown)
+		})
+	})
 }
 
 func config(configs ...func(*Config)) *Config {
@@ -340,10 +388,12 @@ func config(configs ...func(*Config)) *Config {
 		Name:            "Web App",
 		Description:     "A web app",
 		Endpoints:       nil,
-		Serve: func(h http.HandlerFunc) {
+		Tickers:         nil,
+		Serve: func(h http.HandlerFunc, onShutdown func()) {
 			server.Run(func(c *server.Config) {
 				c.Log = l
 				c.Handler = h
+				c.OnShutdown = onShutdown
 			})
 		},
 	}
@@ -365,6 +415,7 @@ type reqStats struct {
 	Status  int            `json:"status"`
 	Method  string         `json:"method"`
 	Path    string         `json:"path"`
+	IP      string         `json:"ip"`
 	Queries []*ActionStats `json:"queries"`
 }
 
@@ -401,12 +452,32 @@ func (r *responseWrapper) WriteHeader(status int) {
 	r.w.WriteHeader(status)
 }
 
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (d *discardResponseWriter) Header() http.Header {
+	return d.header
+}
+
+func (d *discardResponseWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (d *discardResponseWriter) WriteHeader(_ int) {}
+
 type Tlbx interface {
 	Req() *http.Request
 	Resp() http.ResponseWriter
+	// IP is the clients address resolved through Config.TrustedProxies,
+	// it should be used rather than reading the request directly.
+	IP() string
 	Start() time.Time
 	StartMilli() int64
 	Ctx() context.Context
+	// ShuttingDown is closed when the server starts shutting down, long
+	// lived handlers should select on it and return when it is.
+	ShuttingDown() <-chan struct{}
 	NewID() ID
 	Log() log.Log
 	LogActionStats(*ActionStats)
@@ -420,6 +491,7 @@ type tlbx struct {
 	root           http.HandlerFunc
 	resp           *responseWrapper
 	req            *http.Request
+	ip             string
 	start          time.Time
 	startMilli     int64
 	idGenPool      IDGenPool
@@ -430,6 +502,9 @@ type tlbx struct {
 	actionStats    []*ActionStats
 	storeMtx       *sync.RWMutex
 	store          map[interface{}]interface{}
+	setup          TlbxMwares
+	cleanup        TlbxMwares
+	shuttingDown   chan struct{}
 }
 
 func (t *tlbx) Req() *http.Request {
@@ -440,6 +515,10 @@ func (t *tlbx) Resp() http.ResponseWriter {
 	return t.resp
 }
 
+func (t *tlbx) IP() string {
+	return t.ip
+}
+
 func (t *tlbx) Start() time.Time {
 	return t.start
 }
@@ -452,6 +531,10 @@ func (t *tlbx) Ctx() context.Context {
 	return t.req.Context()
 }
 
+func (t *tlbx) ShuttingDown() <-chan struct{} {
+	return t.shuttingDown
+}
+
 func (t *tlbx) NewID() ID {
 	if t.idGen == nil {
 		t.idGen = t.idGenPool.Get()
@@ -469,6 +552,86 @@ func (t *tlbx) LogActionStats(as *ActionStats) {
 	t.actionStats = append(t.actionStats, as)
 }
 
+// Async runs fn on a new go routine with a new Tlbx for work that must
+// outlive the current request, e.g. producing large exports. The new Tlbx
+// has a clone of the current request, with no body and a background
+// context, its own store populated by TlbxSetup and a Resp that discards
+// everything written to it. Panics in fn are logged.
+func Async(t Tlbx, fn func(Tlbx)) {
+	src, ok := t.(*tlbx)
+	PanicIf(!ok, "app.Async must be passed the Tlbx given to an endpoint handler")
+	req := src.req.Clone(context.Background())
+	req.Body = http.NoBody
+	req.ContentLength = 0
+	go runBackground(src, req, "ASYNC", fn)
+}
+
+// Ticker runs Fn every Every for the life of the app, each run is passed
+// a new Tlbx the same as Async, for a GET request to /ticker/{Name}.
+// Runs don't overlap and panics in Fn are logged.
+type Ticker struct {
+	Name  string
+	Every time.Duration
+	Fn    func(Tlbx)
+}
+
+func startTicker(src *tlbx, t *Ticker) {
+	PanicIf(t.Every <= 0, "ticker: %q, Every must be > 0", t.Name)
+	go func() {
+		for range time.Tick(t.Every) {
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/ticker/"+t.Name, nil)
+			PanicOn(err)
+			runBackground(src, req, "TICKER", t.Fn)
+		}
+	}()
+}
+
+// runs fn with a new Tlbx for req that shares srcs app level state, method
+// is only used in the logged stats.
+func runBackground(src *tlbx, req *http.Request, method string, fn func(Tlbx)) {
+	at := &tlbx{
+		mDoMax:         src.mDoMax,
+		root:           src.root,
+		resp:           &responseWrapper{w: &discardResponseWriter{header: http.Header{}}},
+		req:            req,
+		ip:             src.ip,
+		start:          NowMilli(),
+		idGenPool:      src.idGenPool,
+		log:            src.log,
+		actionStatsMtx: &sync.Mutex{},
+		actionStats:    make([]*ActionStats, 0, 10),
+		storeMtx:       &sync.RWMutex{},
+		store:          map[interface{}]interface{}{},
+		setup:          src.setup,
+		cleanup:        src.cleanup,
+		shuttingDown:   src.shuttingDown,
+	}
+	at.startMilli = at.start.UnixNano() / 1000000
+	Do(func() {
+		defer func() {
+			at.actionStatsMtx.Lock()
+			defer at.actionStatsMtx.Unlock()
+			at.log.Stats(&reqStats{
+				Milli:   NowUnixMilli() - at.startMilli,
+				Status:  at.resp.status,
+				Method:  method,
+				Path:    at.req.URL.Path,
+				IP:      at.ip,
+				Queries: at.actionStats,
+			})
+		}()
+		for _, setup := range at.setup {
+			setup(at)
+		}
+		defer func() {
+			for _, cleanup := range at.cleanup {
+				cleanup(at)
+			}
+		}()
+		fn(at)
+	}, at.log.ErrorOn)
+}
+
 func Redirect(status int, url string) {
 	PanicOn(&redirect{
 		status: status,
@@ -694,6 +857,7 @@ func (_ *UpStream) MarshalJSON() ([]byte, error) {
 	return json.Marshal(streamDocs)
 }
 
+// DownStream with a Size < 0 is sent without a Content-Length
 type DownStream struct {
 	stream
 	ID         ID
@@ -724,9 +888,13 @@ func (s *UpStream) MustToReq(method, url string) *http.Request {
 }
 
 func (s *DownStream) FromResp(r *http.Response) error {
-	size, err := strconv.ParseInt(r.Header.Get("Content-Length"), 10, 64)
-	if err != nil {
-		return ToError(err)
+	size := int64(-1)
+	if cl := r.Header.Get("Content-Length"); cl != "" {
+		var err error
+		size, err = strconv.ParseInt(cl, 10, 64)
+		if err != nil {
+			return ToError(err)
+		}
 	}
 	var id ID
 	contentID := r.Header.Get("Content-Id")
@@ -768,6 +936,12 @@ func (c *Client) Cookies() map[string]string {
 	return res
 }
 
+// SetCookie sets a cookie to be sent with every request, e.g. to replay
+// another clients session.
+func (c *Client) SetCookie(name, value string) {
+	c.cookies[name] = value
+}
+
 func NewClient(baseHref string, optClient ...httpClient) *Client {
 	if len(optClient) == 0 {
 		optClient = []httpClient{&http.Client{}}
@@ -810,6 +984,9 @@ func Call(c *Client, path string, args interface{}, res interface{}) error {
 	}
 	req.Header.Set("X-Client", "tlbx-go-client")
 	req.Header.Set("Accept-Encoding", "gzip")
+	if token := c.cookies[CSRFCookie]; token != "" {
+		req.Header.Set(CSRFHeader, token)
+	}
 
 	httpRes, err := c.http.Do(req)
 	if err != nil {
@@ -1041,12 +1218,11 @@ var mDoEp = &Endpoint{
 					PanicOn(err)
 					PanicIf(subReq.URL.Path == ApiPathPrefix+(&MDo{}).Path(), "can't have mdo request inside an mdo request")
 					PanicIf(!strings.HasPrefix(subReq.URL.Path, ApiPathPrefixSegment), "can't have none api request inside an mdo request")
-					for _, c := range tlbx.req.Cookies() {
-						subReq.AddCookie(c)
-					}
-					for name := range tlbx.req.Header {
-						subReq.Header.Add(name, tlbx.req.Header.Get(name))
-					}
+					// so sub requests resolve the same ip, all header values
+					// are copied as X-Forwarded-For may be repeated, this
+					// includes the Cookie header
+					subReq.RemoteAddr = tlbx.req.RemoteAddr
+					subReq.Header = tlbx.req.Header.Clone()
 					subResp := &mDoResp{returnHeaders: mdoReq.Header, header: http.Header{}, body: new(bytes.Buffer)}
 					tlbx.root(subResp, subReq)
 					fullMDoRespMtx.Lock()
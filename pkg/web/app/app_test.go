@@ -3,11 +3,13 @@ package app_test
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	. "github.com/0xor1/tlbx/pkg/core"
 	"github.com/0xor1/tlbx/pkg/json"
+	"github.com/0xor1/tlbx/pkg/log"
 	"github.com/0xor1/tlbx/pkg/web/app"
 	"github.com/0xor1/tlbx/pkg/web/app/config"
 	"github.com/0xor1/tlbx/pkg/web/app/test"
@@ -111,6 +113,24 @@ func Test(t *testing.T) {
 					return nil
 				},
 			},
+			{
+				Description:  "return the X-Test header values",
+				Path:         "/test/header",
+				Timeout:      500,
+				MaxBodyBytes: app.KB,
+				GetDefaultArgs: func() interface{} {
+					return nil
+				},
+				GetExampleArgs: func() interface{} {
+					return nil
+				},
+				GetExampleResponse: func() interface{} {
+					return []string{"a", "b"}
+				},
+				Handler: func(tlbx app.Tlbx, args interface{}) interface{} {
+					return tlbx.Req().Header.Values("X-Test")
+				},
+			},
 		})
 	defer r.CleanUp()
 
@@ -146,15 +166,95 @@ func Test(t *testing.T) {
 	a.Equal(http.StatusServiceUnavailable, mdoRes["3"].Status)
 	a.Equal(http.StatusInternalServerError, mdoRes["4"].Status)
 
+	// test mdo sub requests get every header value
+	req, err := http.NewRequest(http.MethodPut, "/api/mdo", strings.NewReader(`{"0":{"path":"/api/test/header"}}`))
+	PanicOn(err)
+	req.Header.Add("X-Client", "tlbx-app-tests")
+	req.Header.Add("X-Test", "a")
+	req.Header.Add("X-Test", "b")
+	w := httptest.NewRecorder()
+	r.RootHandler().ServeHTTP(w, req)
+	a.Equal(http.StatusOK, w.Result().StatusCode)
+	mdoRes = map[string]*app.MDoResp{}
+	PanicOn(json.Unmarshal(w.Body.Bytes(), &mdoRes))
+	a.Equal(http.StatusOK, mdoRes["0"].Status)
+	a.Equal([]interface{}{"a", "b"}, mdoRes["0"].Body.MustSlice())
+
 	// test static file headers
-	req, err := http.NewRequest(http.MethodGet, "/notfound", nil)
+	req, err = http.NewRequest(http.MethodGet, "/notfound", nil)
 	req.Header.Add("X-Client", "tlbx-app-tests")
 	PanicOn(err)
-	w := httptest.NewRecorder()
+	w = httptest.NewRecorder()
 	r.RootHandler().ServeHTTP(w, req)
 	a.Equal(http.StatusNotFound, w.Result().StatusCode)
 	a.Equal(w.Header().Get("Cache-Control"), "public, max-age=3600, immutable")
 	a.Equal(w.Header().Get("X-Frame-Options"), "DENY")
 	a.Equal(w.Header().Get("X-XSS-Protection"), "1; mode=block")
 	a.Contains(w.Header().Get("Content-Security-Policy"), "default-src 'self'")
+
+	// test GET is only accepted by download endpoints and ping
+	req, err = http.NewRequest(http.MethodGet, `/api/test/echo?args={"msg":"yolo"}`, nil)
+	PanicOn(err)
+	req.Header.Add("X-Client", "tlbx-app-tests")
+	w = httptest.NewRecorder()
+	r.RootHandler().ServeHTTP(w, req)
+	a.Equal(http.StatusBadRequest, w.Result().StatusCode)
+	req, err = http.NewRequest(http.MethodGet, "/api/ping", nil)
+	PanicOn(err)
+	w = httptest.NewRecorder()
+	r.RootHandler().ServeHTTP(w, req)
+	a.Equal(http.StatusOK, w.Result().StatusCode)
+}
+
+func Test_ShuttingDown(t *testing.T) {
+	a := assert.New(t)
+	var root http.HandlerFunc
+	var onShutdown func()
+	ended := make(chan struct{})
+	app.Run(func(c *app.Config) {
+		c.Log = log.New()
+		c.Endpoints = []*app.Endpoint{
+			{
+				Description:  "blocks until the server starts shutting down",
+				Path:         "/test/stream",
+				Timeout:      0,
+				MaxBodyBytes: app.KB,
+				GetDefaultArgs: func() interface{} {
+					return nil
+				},
+				GetExampleArgs: func() interface{} {
+					return nil
+				},
+				GetExampleResponse: func() interface{} {
+					return nil
+				},
+				Handler: func(tlbx app.Tlbx, _ interface{}) interface{} {
+					<-tlbx.ShuttingDown()
+					close(ended)
+					return nil
+				},
+			},
+		}
+		c.Serve = func(h http.HandlerFunc, s func()) {
+			root = h
+			onShutdown = s
+		}
+	})
+	req, err := http.NewRequest(http.MethodPut, "/api/test/stream", nil)
+	PanicOn(err)
+	req.Header.Add("X-Client", "tlbx-app-tests")
+	go root.ServeHTTP(httptest.NewRecorder(), req)
+	select {
+	case <-ended:
+		a.Fail("handler ended before shutdown")
+	case <-time.After(50 * time.Millisecond):
+	}
+	onShutdown()
+	// calling it again must not panic
+	onShutdown()
+	select {
+	case <-ended:
+	case <-time.After(time.Second):
+		a.Fail("handler did not end on shutdown")
+	}
 }
@@ -2,7 +2,9 @@ package config
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/base64"
+	"net/http"
 	"time"
 
 	firebase "firebase.google.com/go"
@@ -15,6 +17,8 @@ import (
 	"github.com/0xor1/tlbx/pkg/ptr"
 	"github.com/0xor1/tlbx/pkg/sqlh"
 	"github.com/0xor1/tlbx/pkg/store"
+	"github.com/0xor1/tlbx/pkg/web/server"
+	"github.com/0xor1/tlbx/pkg/web/server/realip"
 	sp "github.com/SparkPost/gosparkpost"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -32,11 +36,32 @@ type Config struct {
 		StaticDir               string
 		ContentSecurityPolicies []string
 		StaticHostWhiteList     []string
+		TrustedProxies          []string
 		RateLimit               int
-		Session                 struct {
-			Secure     bool
-			AuthKey64s [][]byte
-			EncrKey32s [][]byte
+		RateLimitGCRA           bool
+		ReadHeaderTimeout       time.Duration
+		ReadTimeout             time.Duration
+		WriteTimeout            time.Duration
+		IdleTimeout             time.Duration
+		MaxHeaderBytes          int
+		DrainPeriod             time.Duration
+		H2C                     bool
+		MaxConns                int
+		TLS                     struct {
+			CertFile     string
+			KeyFile      string
+			CertBindTo   string
+			ClientCAFile string
+			ClientAuth   tls.ClientAuthType
+			MinVersion   uint16
+			CipherSuites []uint16
+		}
+		Session struct {
+			Secure          bool
+			AuthKey64s      [][]byte
+			EncrKey32s      [][]byte
+			AbsoluteTimeout time.Duration
+			IdleTimeout     time.Duration
 		}
 	}
 	App struct {
@@ -44,6 +69,15 @@ type Config struct {
 		ActivateFmtLink           string
 		LoginLinkFmtLink          string
 		ConfirmChangeEmailFmtLink string
+		ResetPwdFmtLink           string
+		UnlockFmtLink             string
+		RestoreFmtLink            string
+		InviteFmtLink             string
+		RevertChangeEmailFmtLink  string
+		RegistrationMode          string
+		RequirePow                bool
+		PwdMinEntropy             int
+		BreachedPwdsDir           string
 	}
 	Redis struct {
 		RateLimit iredis.Pool
@@ -67,9 +101,32 @@ func GetBase(file ...string) *config.Config {
 	c.SetDefault("web.appBindTo", ":8080")
 	c.SetDefault("web.contentSecurityPolicies", []string{})
 	c.SetDefault("web.staticHostWhiteList", []string{})
+	c.SetDefault("web.trustedProxies", realip.PrivateCIDRs())
 	c.SetDefault("web.rateLimit", 300)
+	c.SetDefault("web.rateLimitGCRA", true)
+	// app server, readTimeout and writeTimeout of 0 allow large uploads
+	// and long lived responses e.g. SSE, endpoints have their own timeouts
+	c.SetDefault("web.readHeaderTimeout", 5*time.Second)
+	c.SetDefault("web.readTimeout", time.Duration(0))
+	c.SetDefault("web.writeTimeout", time.Duration(0))
+	c.SetDefault("web.idleTimeout", 2*time.Minute)
+	c.SetDefault("web.maxHeaderBytes", http.DefaultMaxHeaderBytes)
+	c.SetDefault("web.drainPeriod", 10*time.Second)
+	c.SetDefault("web.h2c", false)
+	c.SetDefault("web.maxConns", 0)
+	// https is used when certFile and keyFile are set, certBindTo redirects
+	// to https, clientAuth is one of none, request, requireAny,
+	// verifyIfGiven or requireAndVerify
+	c.SetDefault("web.tls.certFile", "")
+	c.SetDefault("web.tls.keyFile", "")
+	c.SetDefault("web.tls.certBindTo", ":http")
+	c.SetDefault("web.tls.clientCAFile", "")
+	c.SetDefault("web.tls.clientAuth", "")
+	c.SetDefault("web.tls.minVersion", "1.2")
+	c.SetDefault("web.tls.cipherSuites", []string{})
 	// session cookie store
 	c.SetDefault("web.session.secure", true)
+	// generate a rotated key block with: crypt -t r -auth <authKey64s> -encr <encrKey32s>
 	c.SetDefault("web.session.authKey64s", []string{
 		"Va3ZMfhH4qSfolDHLU7oPal599DMcL93A80rV2KLM_om_HBFFUbodZKOHAGDYg4LCvjYKaicodNmwLXROKVgcA",
 		"WK_2RgRx6vjfWVkpiwOCB1fvv1yklnltstBjYlQGfRsl6LyVV4mkt6UamUylmkwC8MEgb9bSGr1FYgM2Zk20Ug",
@@ -78,10 +135,21 @@ func GetBase(file ...string) *config.Config {
 		"3ICuYRUelY-4Fhak0Iw0_5CW24bJvxFWM0jAA78IIp8",
 		"u80sYkgbBav52fJXbENYhN3Iyof7WhuLHHMaS_rmUQw",
 	})
+	c.SetDefault("web.session.absoluteTimeout", 30*24*time.Hour)
+	c.SetDefault("web.session.idleTimeout", 7*24*time.Hour)
 	c.SetDefault("app.fromEmail", "test@test.localhost")
 	c.SetDefault("app.activateFmtLink", "http://localhost:8081/#/activate?me=%s&code=%s")
 	c.SetDefault("app.loginLinkFmtLink", "http://localhost:8081/#/loginLinkLogin?me=%s&code=%s")
 	c.SetDefault("app.confirmChangeEmailFmtLink", "http://localhost:8081/#/confirmChangeEmail?me=%s&code=%s")
+	c.SetDefault("app.resetPwdFmtLink", "http://localhost:8081/#/confirmResetPwd?me=%s&code=%s")
+	c.SetDefault("app.unlockFmtLink", "http://localhost:8081/#/unlock?me=%s&code=%s")
+	c.SetDefault("app.restoreFmtLink", "http://localhost:8081/#/restore?me=%s&code=%s")
+	c.SetDefault("app.inviteFmtLink", "http://localhost:8081/#/register?code=%s&email=%s")
+	c.SetDefault("app.revertChangeEmailFmtLink", "http://localhost:8081/#/revertChangeEmail?me=%s&code=%s")
+	c.SetDefault("app.registrationMode", "open")
+	c.SetDefault("app.requirePow", false)
+	c.SetDefault("app.pwdMinEntropy", 0)
+	c.SetDefault("app.breachedPwdsDir", "")
 	c.SetDefault("redis.rateLimit", "localhost:6379")
 	c.SetDefault("redis.cache", "localhost:6379")
 	c.SetDefault("sql.user.primary", "users:C0-Mm-0n-U5-3r5@tcp(localhost:3306)/users?parseTime=true&loc=UTC&multiStatements=true")
@@ -122,10 +190,31 @@ func GetProcessed(c *config.Config) *Config {
 	res.Web.StaticDir = c.GetString("web.staticDir")
 	res.Web.ContentSecurityPolicies = c.GetStringSlice("web.contentSecurityPolicies")
 	res.Web.StaticHostWhiteList = c.GetStringSlice("web.staticHostWhiteList")
+	res.Web.TrustedProxies = c.GetStringSlice("web.trustedProxies")
 	res.Web.RateLimit = c.GetInt("web.rateLimit")
+	res.Web.RateLimitGCRA = c.GetBool("web.rateLimitGCRA")
+	res.Web.ReadHeaderTimeout = c.GetDuration("web.readHeaderTimeout")
+	res.Web.ReadTimeout = c.GetDuration("web.readTimeout")
+	res.Web.WriteTimeout = c.GetDuration("web.writeTimeout")
+	res.Web.IdleTimeout = c.GetDuration("web.idleTimeout")
+	res.Web.MaxHeaderBytes = c.GetInt("web.maxHeaderBytes")
+	res.Web.DrainPeriod = c.GetDuration("web.drainPeriod")
+	res.Web.H2C = c.GetBool("web.h2c")
+	res.Web.MaxConns = c.GetInt("web.maxConns")
+	res.Web.TLS.CertFile = c.GetString("web.tls.certFile")
+	res.Web.TLS.KeyFile = c.GetString("web.tls.keyFile")
+	PanicIf((res.Web.TLS.CertFile == "") != (res.Web.TLS.KeyFile == ""), "web.tls.certFile and web.tls.keyFile must both be set or both be empty")
+	res.Web.TLS.CertBindTo = c.GetString("web.tls.certBindTo")
+	res.Web.TLS.ClientCAFile = c.GetString("web.tls.clientCAFile")
+	res.Web.TLS.ClientAuth = server.ClientAuth(c.GetString("web.tls.clientAuth"))
+	res.Web.TLS.MinVersion = server.TLSVersion(c.GetString("web.tls.minVersion"))
+	res.Web.TLS.CipherSuites = server.CipherSuites(c.GetStringSlice("web.tls.cipherSuites"))
 	res.Web.Session.Secure = c.GetBool("web.session.secure")
+	res.Web.Session.AbsoluteTimeout = c.GetDuration("web.session.absoluteTimeout")
+	res.Web.Session.IdleTimeout = c.GetDuration("web.session.idleTimeout")
 	authKey64s := c.GetStringSlice("web.session.authKey64s")
 	encrKey32s := c.GetStringSlice("web.session.encrKey32s")
+	PanicIf(len(authKey64s) != len(encrKey32s), "session authKey64s and encrKey32s must be the same length")
 	for i := range authKey64s {
 		authBytes, err := base64.RawURLEncoding.DecodeString(authKey64s[i])
 		PanicOn(err)
@@ -141,6 +230,15 @@ func GetProcessed(c *config.Config) *Config {
 	res.App.ActivateFmtLink = c.GetString("app.activateFmtLink")
 	res.App.LoginLinkFmtLink = c.GetString("app.loginLinkFmtLink")
 	res.App.ConfirmChangeEmailFmtLink = c.GetString("app.confirmChangeEmailFmtLink")
+	res.App.ResetPwdFmtLink = c.GetString("app.resetPwdFmtLink")
+	res.App.UnlockFmtLink = c.GetString("app.unlockFmtLink")
+	res.App.RestoreFmtLink = c.GetString("app.restoreFmtLink")
+	res.App.InviteFmtLink = c.GetString("app.inviteFmtLink")
+	res.App.RevertChangeEmailFmtLink = c.GetString("app.revertChangeEmailFmtLink")
+	res.App.RegistrationMode = c.GetString("app.registrationMode")
+	res.App.RequirePow = c.GetBool("app.requirePow")
+	res.App.PwdMinEntropy = c.GetInt("app.pwdMinEntropy")
+	res.App.BreachedPwdsDir = c.GetString("app.breachedPwdsDir")
 
 	res.Redis.RateLimit = iredis.CreatePool(c.GetString("redis.rateLimit"))
 	res.Redis.Cache = iredis.CreatePool(c.GetString("redis.cache"))
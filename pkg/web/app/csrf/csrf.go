@@ -0,0 +1,86 @@
+package csrf
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+
+	. "github.com/0xor1/tlbx/pkg/core"
+	"github.com/0xor1/tlbx/pkg/web/app"
+	"github.com/0xor1/tlbx/pkg/web/app/session"
+)
+
+type Config struct {
+	// AllowedHosts are the hosts, other than the requests own host, that
+	// requests may have an Origin or Referer from, e.g.
+	// web.staticHostWhiteList, an entry of "*" allows any host.
+	AllowedHosts []string
+	// Header is the request header the session token must be sent in,
+	// app.Client does this automatically.
+	Header string
+}
+
+// Mware rejects state changing requests, i.e. PUT and POST, that have an
+// Origin or Referer from a host that isn't allowed, or that have a session
+// but dont send its session.Session.Token in the header. It must come
+// directly after the session mware, before anything that may create a
+// session, e.g. ratelimit.MeMware. GETs aren't checked as app only
+// accepts GETs to the api for downloads and ping.
+func Mware(configs ...func(*Config)) func(app.Tlbx) {
+	c := config(configs...)
+	hosts := make(map[string]bool, len(c.AllowedHosts))
+	for _, h := range c.AllowedHosts {
+		hosts[StrLower(h)] = true
+	}
+	return func(tlbx app.Tlbx) {
+		r := tlbx.Req()
+		if r.Method != http.MethodPut && r.Method != http.MethodPost {
+			return
+		}
+		app.ReturnIf(!originAllowed(r, hosts), http.StatusForbidden, "cross origin request denied")
+		s := session.Get(tlbx)
+		if !s.Exists() {
+			// nothing to forge a request with
+			return
+		}
+		token := s.Token()
+		app.ReturnIf(
+			subtle.ConstantTimeCompare([]byte(token), []byte(r.Header.Get(c.Header))) != 1,
+			http.StatusForbidden,
+			"csrf token missing or invalid")
+	}
+}
+
+// originAllowed checks the Origin header, falling back to the Referer,
+// requests with neither are allowed as they are not from browsers that
+// would send cookies cross site without them.
+func originAllowed(r *http.Request, hosts map[string]bool) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		origin = r.Header.Get("Referer")
+	}
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := StrLower(u.Host)
+	return host == StrLower(r.Host) ||
+		hosts[host] ||
+		hosts[strings.Split(host, ":")[0]] ||
+		hosts["*"]
+}
+
+func config(configs ...func(*Config)) *Config {
+	c := &Config{
+		AllowedHosts: []string{},
+		Header:       app.CSRFHeader,
+	}
+	for _, config := range configs {
+		config(c)
+	}
+	return c
+}
@@ -0,0 +1,31 @@
+package csrf
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_originAllowed(t *testing.T) {
+	a := assert.New(t)
+	hosts := map[string]bool{"static.example.com": true}
+	req := func(origin, referer string) *http.Request {
+		r, _ := http.NewRequest(http.MethodPut, "https://example.com/api/user/me", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if referer != "" {
+			r.Header.Set("Referer", referer)
+		}
+		return r
+	}
+	a.True(originAllowed(req("", ""), hosts))
+	a.True(originAllowed(req("https://example.com", ""), hosts))
+	a.True(originAllowed(req("https://static.example.com:443", ""), hosts))
+	a.True(originAllowed(req("null", "https://example.com/page"), hosts))
+	a.False(originAllowed(req("https://evil.com", ""), hosts))
+	a.False(originAllowed(req("", "https://evil.com/page"), hosts))
+	a.False(originAllowed(req("https://example.com.evil.com", ""), hosts))
+	a.True(originAllowed(req("https://evil.com", ""), map[string]bool{"*": true}))
+}
@@ -0,0 +1,74 @@
+package pow
+
+import (
+	"crypto/sha256"
+	"math/bits"
+	"strconv"
+	"time"
+
+	. "github.com/0xor1/tlbx/pkg/core"
+	"github.com/0xor1/tlbx/pkg/web/app"
+)
+
+// Challenge is a hashcash style puzzle, it is solved by finding a Nonce
+// for which sha256(Challenge + ":" + Nonce) has at least Difficulty
+// leading zero bits.
+type Challenge struct {
+	Challenge  string    `json:"challenge"`
+	Difficulty uint8     `json:"difficulty"`
+	ExpiresOn  time.Time `json:"expiresOn"`
+}
+
+// Solution is passed to endpoints that require proof of work, each
+// Challenge may only be used once.
+type Solution struct {
+	Challenge string `json:"challenge"`
+	Nonce     string `json:"nonce"`
+}
+
+type GetChallenge struct{}
+
+func (_ *GetChallenge) Path() string {
+	return "/pow/getChallenge"
+}
+
+func (a *GetChallenge) Do(c *app.Client) (*Challenge, error) {
+	res := &Challenge{}
+	err := app.Call(c, a.Path(), nil, &res)
+	return res, err
+}
+
+func (a *GetChallenge) MustDo(c *app.Client) *Challenge {
+	res, err := a.Do(c)
+	PanicOn(err)
+	return res
+}
+
+// Valid returns true if nonce solves challenge at difficulty.
+func Valid(challenge, nonce string, difficulty uint8) bool {
+	hash := sha256.Sum256([]byte(challenge + ":" + nonce))
+	zeros := 0
+	for _, b := range hash {
+		if b == 0 {
+			zeros += 8
+		} else {
+			zeros += bits.LeadingZeros8(b)
+			break
+		}
+	}
+	return zeros >= int(difficulty)
+}
+
+// Solve brute forces a Solution to c, the expected number of hashes is
+// 2^Difficulty.
+func Solve(c *Challenge) *Solution {
+	for i := uint64(0); ; i++ {
+		nonce := strconv.FormatUint(i, 36)
+		if Valid(c.Challenge, nonce, c.Difficulty) {
+			return &Solution{
+				Challenge: c.Challenge,
+				Nonce:     nonce,
+			}
+		}
+	}
+}
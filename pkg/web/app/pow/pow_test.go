@@ -0,0 +1,27 @@
+package pow
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Valid(t *testing.T) {
+	a := assert.New(t)
+	a.True(Valid("abc", "anything", 0))
+	// sha256("abc:0") starts 0x5f, one leading zero bit
+	a.True(Valid("abc", "0", 1))
+	a.False(Valid("abc", "0", 2))
+}
+
+func Test_Solve(t *testing.T) {
+	a := assert.New(t)
+	c := &Challenge{
+		Challenge:  "abc",
+		Difficulty: 12,
+	}
+	s := Solve(c)
+	a.Equal(c.Challenge, s.Challenge)
+	a.True(Valid(s.Challenge, s.Nonce, c.Difficulty))
+	a.False(Valid("abd", s.Nonce, 32))
+}
@@ -0,0 +1,143 @@
+package poweps
+
+import (
+	"crypto/subtle"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/0xor1/tlbx/pkg/core"
+	"github.com/0xor1/tlbx/pkg/crypt"
+	"github.com/0xor1/tlbx/pkg/web/app"
+	"github.com/0xor1/tlbx/pkg/web/app/pow"
+	"github.com/0xor1/tlbx/pkg/web/app/ratelimit"
+	"github.com/0xor1/tlbx/pkg/web/app/service"
+	"github.com/gomodule/redigo/redis"
+)
+
+const challengeLen = 32
+
+// New returns the endpoint clients use to get a pow.Challenge, the
+// difficulty starts at BaseDifficulty and increases by one bit for every
+// AbuseStep abuse signals recorded against the client by the ratelimit
+// mware, up to MaxDifficulty.
+func New(configs ...func(*Config)) []*app.Endpoint {
+	c := config(configs...)
+	return []*app.Endpoint{
+		{
+			Description:  "get a proof of work challenge, required by some endpoints to prevent abuse",
+			Path:         (&pow.GetChallenge{}).Path(),
+			Timeout:      500,
+			MaxBodyBytes: app.KB,
+			IsPrivate:    false,
+			GetDefaultArgs: func() interface{} {
+				return nil
+			},
+			GetExampleArgs: func() interface{} {
+				return nil
+			},
+			GetExampleResponse: func() interface{} {
+				return &pow.Challenge{
+					Challenge:  "123abc",
+					Difficulty: c.BaseDifficulty,
+					ExpiresOn:  app.ExampleTime(),
+				}
+			},
+			Handler: func(tlbx app.Tlbx, _ interface{}) interface{} {
+				res := &pow.Challenge{
+					Challenge:  crypt.UrlSafeString(challengeLen),
+					Difficulty: Difficulty(c, ratelimit.AbuseScore(tlbx)),
+					ExpiresOn:  tlbx.Start().Add(c.ValidFor),
+				}
+				cnn := service.Get(tlbx).Cache().Get()
+				defer cnn.Close()
+				// the rate limit key is stored with the difficulty so
+				// the challenge can't be solved at a low abuse score
+				// and used by another client
+				_, err := cnn.Do("SET", challengeKey(res.Challenge), challengeVal(res.Difficulty, ratelimit.ClientKey(tlbx)), "PX", c.ValidFor.Milliseconds())
+				PanicOn(err)
+				return res
+			},
+		},
+	}
+}
+
+// Difficulty returns the number of leading zero bits required for a
+// client with the given abuse score.
+func Difficulty(c *Config, abuseScore int) uint8 {
+	d := int(c.BaseDifficulty)
+	if c.AbuseStep > 0 {
+		d += abuseScore / c.AbuseStep
+	}
+	if d > int(c.MaxDifficulty) {
+		d = int(c.MaxDifficulty)
+	}
+	return uint8(d)
+}
+
+// MustVerify returns a 400 unless s solves an unexpired challenge issued
+// by the pow endpoint to the same rate limit key as the current request,
+// each challenge can only be verified once.
+func MustVerify(tlbx app.Tlbx, s *pow.Solution) {
+	app.BadReqIf(s == nil, "proof of work required")
+	key := challengeKey(s.Challenge)
+	cnn := service.Get(tlbx).Cache().Get()
+	defer cnn.Close()
+	val, err := redis.String(cnn.Do("GET", key))
+	if err != nil && err != redis.ErrNil {
+		PanicOn(err)
+	}
+	app.BadReqIf(err == redis.ErrNil, "proof of work invalid")
+	// only the request which deletes the key may use it
+	deleted, err := redis.Int(cnn.Do("DEL", key))
+	PanicOn(err)
+	difficulty, issuedTo, ok := parseChallengeVal(val)
+	app.BadReqIf(
+		deleted != 1 ||
+			!ok ||
+			subtle.ConstantTimeCompare([]byte(issuedTo), []byte(ratelimit.ClientKey(tlbx))) != 1 ||
+			!pow.Valid(s.Challenge, s.Nonce, difficulty),
+		"proof of work invalid")
+}
+
+func challengeKey(challenge string) string {
+	return Strf("pow_%s", challenge)
+}
+
+// challenge values are "<difficulty>:<rate limit key>", the key may
+// contain ':' so the value is only split on the first.
+func challengeVal(difficulty uint8, rateLimitKey string) string {
+	return Strf("%d:%s", difficulty, rateLimitKey)
+}
+
+func parseChallengeVal(val string) (uint8, string, bool) {
+	parts := strings.SplitN(val, ":", 2)
+	if len(parts) != 2 {
+		return 0, "", false
+	}
+	difficulty, err := strconv.ParseUint(parts[0], 10, 8)
+	if err != nil {
+		return 0, "", false
+	}
+	return uint8(difficulty), parts[1], true
+}
+
+type Config struct {
+	BaseDifficulty uint8
+	MaxDifficulty  uint8
+	AbuseStep      int
+	ValidFor       time.Duration
+}
+
+func config(configs ...func(*Config)) *Config {
+	c := &Config{
+		BaseDifficulty: 16,
+		MaxDifficulty:  24,
+		AbuseStep:      5,
+		ValidFor:       5 * time.Minute,
+	}
+	for _, config := range configs {
+		config(c)
+	}
+	return c
+}
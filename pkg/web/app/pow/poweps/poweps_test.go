@@ -0,0 +1,35 @@
+package poweps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Difficulty(t *testing.T) {
+	a := assert.New(t)
+	c := config()
+	a.Equal(c.BaseDifficulty, Difficulty(c, 0))
+	a.Equal(c.BaseDifficulty, Difficulty(c, c.AbuseStep-1))
+	a.Equal(c.BaseDifficulty+1, Difficulty(c, c.AbuseStep))
+	a.Equal(c.MaxDifficulty, Difficulty(c, 1000000))
+	c.AbuseStep = 0
+	a.Equal(c.BaseDifficulty, Difficulty(c, 1000000))
+}
+
+func Test_challengeVal(t *testing.T) {
+	a := assert.New(t)
+	key := "rate-limiter-::1-"
+	difficulty, issuedTo, ok := parseChallengeVal(challengeVal(20, key))
+	a.True(ok)
+	a.Equal(uint8(20), difficulty)
+	a.Equal(key, issuedTo)
+	difficulty, issuedTo, ok = parseChallengeVal(challengeVal(16, ""))
+	a.True(ok)
+	a.Equal(uint8(16), difficulty)
+	a.Equal("", issuedTo)
+	_, _, ok = parseChallengeVal("16")
+	a.False(ok)
+	_, _, ok = parseChallengeVal("300:key")
+	a.False(ok)
+}
@@ -0,0 +1,190 @@
+package ratelimit
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	. "github.com/0xor1/tlbx/pkg/core"
+	"github.com/0xor1/tlbx/pkg/web/app"
+	"github.com/gomodule/redigo/redis"
+)
+
+// local is an in memory gcra limiter used while redis is unavailable, it
+// holds at most max keys, evicting the least recently used, and limits
+// are applied per instance rather than across all instances.
+type local struct {
+	mtx     sync.Mutex
+	max     int
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type localEntry struct {
+	key string
+	val int64
+	// unix ms
+	expires int64
+}
+
+func newLocal(max int) *local {
+	return &local{
+		max:     max,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element, max),
+	}
+}
+
+// must be called with mtx locked
+func (l *local) get(key string, now int64) int64 {
+	el, exists := l.entries[key]
+	if !exists {
+		return 0
+	}
+	e := el.Value.(*localEntry)
+	if e.expires <= now {
+		l.lru.Remove(el)
+		delete(l.entries, key)
+		return 0
+	}
+	l.lru.MoveToFront(el)
+	return e.val
+}
+
+// must be called with mtx locked
+func (l *local) set(key string, val, expires int64) {
+	if el, exists := l.entries[key]; exists {
+		e := el.Value.(*localEntry)
+		e.val = val
+		e.expires = expires
+		l.lru.MoveToFront(el)
+		return
+	}
+	l.entries[key] = l.lru.PushFront(&localEntry{
+		key:     key,
+		val:     val,
+		expires: expires,
+	})
+	for l.lru.Len() > l.max {
+		oldest := l.lru.Back()
+		l.lru.Remove(oldest)
+		delete(l.entries, oldest.Value.(*localEntry).key)
+	}
+}
+
+// limit is a limiter that ignores cnn, it is the same algorithm as
+// gcraScript.
+func (l *local) limit(_ redis.Conn, c *Config, abuseKey string, windows []*window, now time.Time) (bool, time.Duration, int, error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	allowed := true
+	var retry int64
+	tats := make([]int64, len(windows))
+	newTats := make([]int64, len(windows))
+	for i, w := range windows {
+		period := w.Period.Milliseconds()
+		tat := l.get(localKey(w), nowMs)
+		if tat < nowMs {
+			tat = nowMs
+		}
+		newTat := tat + (int64(w.cost)*period+int64(w.Limit)-1)/int64(w.Limit)
+		if newTat-period > nowMs {
+			allowed = false
+			if newTat-period-nowMs > retry {
+				retry = newTat - period - nowMs
+			}
+		}
+		tats[i] = tat
+		newTats[i] = newTat
+	}
+	abuse := int(l.get(abuseKey, nowMs))
+	if !allowed {
+		abuse++
+		l.set(abuseKey, int64(abuse), nowMs+c.AbuseWindow.Milliseconds())
+	}
+	for i, w := range windows {
+		period := w.Period.Milliseconds()
+		tat := tats[i]
+		if allowed {
+			tat = newTats[i]
+			if tat > nowMs {
+				l.set(localKey(w), tat, tat)
+			}
+		}
+		w.remaining = int((nowMs + period - tat) * int64(w.Limit) / period)
+		if w.remaining > w.Limit {
+			w.remaining = w.Limit
+		}
+		w.reset = time.Duration(tat-nowMs) * time.Millisecond
+	}
+	return allowed, time.Duration(retry) * time.Millisecond, abuse, nil
+}
+
+func localKey(w *window) string {
+	return Strf("%s-%d", w.key, w.Period.Milliseconds())
+}
+
+// breaker tracks whether redis is usable, once a call fails it is open
+// and the local limiter is used, every retry one request is let through
+// to redis to check if it has recovered.
+type breaker struct {
+	mtx     sync.Mutex
+	retry   time.Duration
+	open    bool
+	since   time.Time
+	retryAt time.Time
+}
+
+type modeStats struct {
+	Mode     string `json:"mode"`
+	Previous string `json:"previous"`
+	// how long the previous mode lasted in ms
+	PreviousMilli int64 `json:"previousMilli"`
+}
+
+func (b *breaker) useRedis(now time.Time) bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if !b.open {
+		return true
+	}
+	if now.Before(b.retryAt) {
+		return false
+	}
+	b.retryAt = now.Add(b.retry)
+	return true
+}
+
+func (b *breaker) failed(tlbx app.Tlbx, now time.Time) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.retryAt = now.Add(b.retry)
+	if b.open {
+		return
+	}
+	tlbx.Log().Warning("ratelimit redis unavailable, using local limiter, retrying every %s", b.retry)
+	tlbx.Log().Stats(&modeStats{
+		Mode:          "local",
+		Previous:      "redis",
+		PreviousMilli: now.Sub(b.since).Milliseconds(),
+	})
+	b.open = true
+	b.since = now
+}
+
+func (b *breaker) succeeded(tlbx app.Tlbx, now time.Time) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if !b.open {
+		return
+	}
+	tlbx.Log().Info("ratelimit redis recovered after %s", now.Sub(b.since))
+	tlbx.Log().Stats(&modeStats{
+		Mode:          "redis",
+		Previous:      "local",
+		PreviousMilli: now.Sub(b.since).Milliseconds(),
+	})
+	b.open = false
+	b.since = now
+}
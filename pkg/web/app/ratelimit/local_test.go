@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_local(t *testing.T) {
+	a := assert.New(t)
+	c := config()
+	l := newLocal(2)
+	now := time.Unix(1000, 0)
+	windows := func() []*window {
+		return []*window{{
+			Window: &Window{Period: time.Minute, Limit: 3},
+			key:    "a",
+			cost:   1,
+		}}
+	}
+
+	for i := 2; i >= 0; i-- {
+		ws := windows()
+		allowed, _, abuse, err := l.limit(nil, c, "a-abuse", ws, now)
+		a.Nil(err)
+		a.True(allowed)
+		a.Zero(abuse)
+		a.Equal(i, ws[0].remaining)
+	}
+
+	ws := windows()
+	allowed, retry, abuse, _ := l.limit(nil, c, "a-abuse", ws, now)
+	a.False(allowed)
+	a.Equal(1, abuse)
+	a.Equal(20*time.Second, retry)
+	a.Equal(time.Minute, ws[0].reset)
+
+	allowed, _, _, _ = l.limit(nil, c, "a-abuse", windows(), now.Add(20*time.Second))
+	a.True(allowed)
+
+	// max 2 keys so adding a third evicts the least recently used
+	l.mtx.Lock()
+	l.set("b", 1, now.Unix()*1000+1000)
+	l.set("c", 1, now.Unix()*1000+1000)
+	a.Equal(2, l.lru.Len())
+	a.Zero(l.get("a-60000", now.Unix()*1000))
+	l.mtx.Unlock()
+}
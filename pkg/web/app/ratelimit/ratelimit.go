@@ -3,13 +3,13 @@ package ratelimit
 import (
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	. "github.com/0xor1/tlbx/pkg/core"
 	"github.com/0xor1/tlbx/pkg/iredis"
 	"github.com/0xor1/tlbx/pkg/web/app"
 	"github.com/0xor1/tlbx/pkg/web/app/session/me"
-	"github.com/0xor1/tlbx/pkg/web/server/realip"
 	"github.com/gomodule/redigo/redis"
 )
 
@@ -18,21 +18,20 @@ func NoMware(cache iredis.Pool, perMinute ...int) func(app.Tlbx) {
 }
 
 func MeMware(cache iredis.Pool, perMinute ...int) func(app.Tlbx) {
-	return BasicMware(me.AuthedExists, func(t app.Tlbx) string {
-		return me.AuthedGet(t).String()
-	}, cache, perMinute...)
+	PanicIf(len(perMinute) != 0 && perMinute[0] < 1, "perMinute must be >= 1")
+	return Mware(func(c *Config) {
+		c.KeyGen = MeKeyGen
+		c.Pool = cache
+		if len(perMinute) != 0 {
+			c.PerMinute = perMinute[0]
+		}
+	})
 }
 
 func BasicMware(sesExists func(app.Tlbx) bool, sesID func(app.Tlbx) string, cache iredis.Pool, perMinute ...int) func(app.Tlbx) {
 	PanicIf(len(perMinute) != 0 && perMinute[0] < 1, "perMinute must be >= 1")
 	return Mware(func(c *Config) {
-		c.KeyGen = func(tlbx app.Tlbx) string {
-			var key string
-			if sesExists(tlbx) {
-				key = sesID(tlbx)
-			}
-			return Strf("rate-limiter-%s-%s", realip.RealIP(tlbx.Req()), key)
-		}
+		c.KeyGen = KeyGen(sesExists, sesID)
 		c.Pool = cache
 		if len(perMinute) != 0 {
 			c.PerMinute = perMinute[0]
@@ -40,8 +39,96 @@ func BasicMware(sesExists func(app.Tlbx) bool, sesID func(app.Tlbx) string, cach
 	})
 }
 
+// KeyGen returns a Config.KeyGen keyed by real ip and session id if a
+// session exists.
+func KeyGen(sesExists func(app.Tlbx) bool, sesID func(app.Tlbx) string) func(app.Tlbx) string {
+	return func(tlbx app.Tlbx) string {
+		var key string
+		if sesExists(tlbx) {
+			key = sesID(tlbx)
+		}
+		return Strf("rate-limiter-%s-%s", tlbx.IP(), key)
+	}
+}
+
+// MeKeyGen is the KeyGen used by MeMware.
+func MeKeyGen(tlbx app.Tlbx) string {
+	return KeyGen(me.AuthedExists, func(t app.Tlbx) string {
+		return me.AuthedGet(t).String()
+	})(tlbx)
+}
+
+// Rule applies its own Windows to requests to any of Paths, which are
+// endpoint paths without the api prefix, e.g. "/user/register". Each
+// matching request counts once against the rules Windows, Cost is how
+// much it consumes from the PerMinute budget, 0 makes matching requests
+// free against PerMinute.
+type Rule struct {
+	Name    string
+	Paths   []string
+	Cost    int
+	Windows []*Window
+}
+
+type Window struct {
+	Period time.Duration
+	Limit  int
+}
+
+// PingRule makes pings free against PerMinute, so health checks and
+// clients checking connectivity dont consume the budget of real requests.
+func PingRule() *Rule {
+	return &Rule{
+		Name:  "ping",
+		Paths: []string{(&app.Ping{}).Path()},
+		Cost:  0,
+		Windows: []*Window{
+			{Period: time.Second, Limit: 10},
+		},
+	}
+}
+
+// a window of a rule and its state after the request
+type window struct {
+	*Window
+	name      string
+	key       string
+	cost      int
+	remaining int
+	// reset is how long until the window is back to its full limit
+	reset time.Duration
+}
+
+// limiter checks and records a request against every window in a single
+// call, setting each windows remaining and reset, and returns the abuse
+// score and how long to wait before retrying if the request isnt allowed.
+type limiter func(cnn redis.Conn, c *Config, abuseKey string, windows []*window, now time.Time) (allowed bool, retryAfter time.Duration, abuse int, err error)
+
 func Mware(configs ...func(*Config)) func(app.Tlbx) {
 	c := config(configs...)
+	rules := make(map[string]*Rule, len(c.Rules))
+	for _, r := range c.Rules {
+		PanicIf(r.Name == "", "rule name must be set")
+		PanicIf(r.Cost < 0, "rule %s cost must be >= 0", r.Name)
+		for _, w := range r.Windows {
+			PanicIf(w.Period < time.Second || w.Limit < 1, "rule %s has an invalid window", r.Name)
+		}
+		for _, p := range r.Paths {
+			lp := StrLower(app.ApiPathPrefix + p)
+			_, exists := rules[lp]
+			PanicIf(exists, "path %s is in multiple rules", p)
+			rules[lp] = r
+		}
+	}
+	limit := slidingLog
+	if c.GCRA {
+		limit = gcra
+	}
+	loc := newLocal(c.FallbackMaxKeys)
+	brk := &breaker{
+		retry: c.FallbackRetry,
+		since: Now(),
+	}
 	return func(tlbx app.Tlbx) {
 		if c.Pool == nil ||
 			c.PerMinute < 1 ||
@@ -49,99 +136,349 @@ func Mware(configs ...func(*Config)) func(app.Tlbx) {
 			return
 		}
 
-		shouldReturn := func(err error) bool {
-			if err != nil {
-				if c.ExitOnError {
-					PanicOn(err)
-				}
-				tlbx.Log().ErrorOn(err)
-				return true
+		key := c.KeyGen(tlbx)
+		tlbx.Set(keyTlbxKey{}, key)
+		abuseKey := key + "-abuse"
+
+		cost := 1
+		windows := []*window{}
+		if rule := rules[StrLower(tlbx.Req().URL.Path)]; rule != nil {
+			cost = rule.Cost
+			for _, w := range rule.Windows {
+				windows = append(windows, &window{
+					Window: w,
+					name:   rule.Name,
+					key:    key + "-" + rule.Name,
+					cost:   1,
+				})
+			}
+		}
+		windows = append(windows, &window{
+			Window: &Window{
+				Period: time.Minute,
+				Limit:  c.PerMinute,
+			},
+			name: "default",
+			key:  key,
+			cost: cost,
+		})
+		for _, w := range windows {
+			w.remaining = w.Limit
+			w.reset = w.Period
+			if c.GCRA {
+				// gcra stores one value per window rather than per key
+				w.key = Strf("%s-gcra-%d", w.key, w.Period.Milliseconds())
 			}
-			return false
 		}
 
-		remaining := c.PerMinute
+		allowed := true
+		var retryAfter time.Duration
 
 		defer func() {
-			tlbx.Resp().Header().Add("X-Rate-Limit-Limit", strconv.Itoa(c.PerMinute))
+			// the standard headers describe the most restrictive window,
+			// X-Rate-Limit-Policy lists every window that applied
+			tightest := windows[0]
+			policies := make([]string, 0, len(windows))
+			for _, w := range windows {
+				if w.remaining < tightest.remaining {
+					tightest = w
+				}
+				policies = append(policies, Strf("%d;w=%d;name=%s", w.Limit, int64(w.Period/time.Second), w.name))
+			}
+			remaining := tightest.remaining
+			if remaining < 0 {
+				remaining = 0
+			}
+			tlbx.Resp().Header().Add("X-Rate-Limit-Limit", strconv.Itoa(tightest.Limit))
 			tlbx.Resp().Header().Add("X-Rate-Limit-Remaining", strconv.Itoa(remaining))
-			tlbx.Resp().Header().Add("X-Rate-Limit-Reset", "60")
+			tlbx.Resp().Header().Add("X-Rate-Limit-Reset", strconv.FormatInt(seconds(tightest.reset), 10))
+			tlbx.Resp().Header().Add("X-Rate-Limit-Policy", strings.Join(policies, ", "))
+			if !allowed {
+				tlbx.Resp().Header().Add("Retry-After", strconv.FormatInt(seconds(retryAfter), 10))
+			}
 
-			app.ReturnIf(remaining < 1, http.StatusTooManyRequests, "")
+			app.ReturnIf(!allowed, http.StatusTooManyRequests, "")
 		}()
 
-		key := c.KeyGen(tlbx)
+		var abuse int
+		var err error
+		now := Now()
+		if c.Fallback && !brk.useRedis(now) {
+			allowed, retryAfter, abuse, _ = loc.limit(nil, c, abuseKey, windows, now)
+			tlbx.Set(abuseTlbxKey{}, abuse)
+			return
+		}
 
-		now := NowUnixNano()
 		cnn := c.Pool.Get()
 		defer cnn.Close()
 
-		err := cnn.Send("MULTI")
-		if shouldReturn(err) {
-			return
+		allowed, retryAfter, abuse, err = limit(cnn, c, abuseKey, windows, now)
+		if err != nil {
+			allowed = true
+			if c.ExitOnError {
+				PanicOn(err)
+			}
+			tlbx.Log().ErrorOn(err)
+			if !c.Fallback {
+				return
+			}
+			brk.failed(tlbx, now)
+			allowed, retryAfter, abuse, _ = loc.limit(nil, c, abuseKey, windows, now)
+		} else if c.Fallback {
+			brk.succeeded(tlbx, now)
 		}
+		tlbx.Set(abuseTlbxKey{}, abuse)
+	}
+}
 
-		err = cnn.Send("ZREMRANGEBYSCORE", key, 0, now-time.Minute.Nanoseconds())
-		if shouldReturn(err) {
-			return
+// seconds rounds d up to whole seconds.
+func seconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+// slidingLog stores a sorted set member per unit of cost per request,
+// it is exact but memory grows with the limit and it takes up to two
+// round trips per request.
+func slidingLog(cnn redis.Conn, c *Config, abuseKey string, windows []*window, now time.Time) (bool, time.Duration, int, error) {
+	nowNano := now.UnixNano()
+	// the longest window of each key determines how long its
+	// entries must be kept
+	keyPeriods := map[string]time.Duration{}
+	keyCosts := map[string]int{}
+	keys := []string{}
+	for _, w := range windows {
+		if _, exists := keyPeriods[w.key]; !exists {
+			keys = append(keys, w.key)
 		}
+		if w.Period > keyPeriods[w.key] {
+			keyPeriods[w.key] = w.Period
+		}
+		keyCosts[w.key] = w.cost
+	}
 
-		err = cnn.Send("ZRANGE", key, 0, -1)
-		if shouldReturn(err) {
-			return
+	// send errors are returned by the EXEC
+	send := func(cmd string, args ...interface{}) {
+		cnn.Send(cmd, args...)
+	}
+
+	send("MULTI")
+	for _, k := range keys {
+		send("ZREMRANGEBYSCORE", k, 0, nowNano-keyPeriods[k].Nanoseconds())
+	}
+	for _, w := range windows {
+		from := Strf("(%d", nowNano-w.Period.Nanoseconds())
+		send("ZCOUNT", w.key, from, "+inf")
+		send("ZRANGEBYSCORE", w.key, from, "+inf", "WITHSCORES", "LIMIT", 0, 1)
+	}
+	send("GET", abuseKey)
+	results, err := redis.Values(cnn.Do("EXEC"))
+	if err != nil {
+		return true, 0, 0, err
+	}
+
+	allowed := true
+	var retryAfter time.Duration
+	results = results[len(keys):]
+	oldests := make([]int64, len(windows))
+	for i, w := range windows {
+		used, err := redis.Int(results[i*2], nil)
+		if err != nil {
+			return true, 0, 0, err
+		}
+		oldest, err := redis.Int64s(results[i*2+1], nil)
+		if err != nil {
+			return true, 0, 0, err
+		}
+		if len(oldest) == 2 {
+			oldests[i] = oldest[1]
+			w.reset = time.Duration(oldest[1] + w.Period.Nanoseconds() - nowNano)
+		} else {
+			w.reset = 0
+		}
+		w.remaining = w.Limit - used
+		if used+w.cost > w.Limit {
+			allowed = false
+			if w.reset > retryAfter {
+				retryAfter = w.reset
+			}
 		}
+	}
 
-		results, err := redis.Values(cnn.Do("EXEC"))
-		if shouldReturn(err) {
-			return
+	abuse, err := redis.Int(results[len(results)-1], nil)
+	if err != nil && err != redis.ErrNil {
+		return true, 0, 0, err
+	}
+
+	if !allowed {
+		// each rejected request is an abuse signal that is remembered
+		// for AbuseWindow, see AbuseScore.
+		send("MULTI")
+		send("INCR", abuseKey)
+		send("PEXPIRE", abuseKey, c.AbuseWindow.Milliseconds())
+		if _, err = cnn.Do("EXEC"); err != nil {
+			return true, 0, 0, err
 		}
+		return false, retryAfter, abuse + 1, nil
+	}
 
-		keys, err := redis.Strings(results[len(results)-1], err)
-		if shouldReturn(err) {
-			return
+	send("MULTI")
+	for _, k := range keys {
+		for i := 0; i < keyCosts[k]; i++ {
+			// members must be unique so each unit of cost is counted
+			send("ZADD", k, nowNano, Strf("%d-%d", nowNano, i))
 		}
+		send("PEXPIRE", k, keyPeriods[k].Milliseconds())
+	}
+	if _, err = cnn.Do("EXEC"); err != nil {
+		return true, 0, 0, err
+	}
 
-		remaining = remaining - len(keys)
+	for i, w := range windows {
+		w.remaining -= w.cost
+		if oldests[i] == 0 && w.cost > 0 {
+			w.reset = w.Period
+		}
+	}
+	return true, 0, abuse, nil
+}
 
-		if remaining > 0 {
-			remaining--
+// gcraScript implements the generic cell rate algorithm over every
+// window in one call, each window stores only its theoretical arrival
+// time, tat, in ms. A request is allowed if for every window
+// tat + cost * period / limit - period <= now.
+// KEYS: a key per window, then the abuse key
+// ARGV: now ms, abuse window ms, then period ms, limit and cost per window
+// returns: allowed, abuse, retry after ms, then remaining and reset ms
+// per window
+var gcraScript = redis.NewScript(-1, `
+local now = tonumber(ARGV[1])
+local n = #KEYS - 1
+local allowed = 1
+local retry = 0
+local tats = {}
+for i = 1, n do
+	local period = tonumber(ARGV[i*3])
+	local interval = period / tonumber(ARGV[i*3+1])
+	local tat = tonumber(redis.call('GET', KEYS[i]) or now)
+	if tat < now then
+		tat = now
+	end
+	local newTat = math.ceil(tat + tonumber(ARGV[i*3+2]) * interval)
+	if newTat - period > now then
+		allowed = 0
+		if newTat - period - now > retry then
+			retry = newTat - period - now
+		end
+	end
+	tats[i] = {tat, newTat}
+end
+local abuse
+if allowed == 1 then
+	abuse = tonumber(redis.call('GET', KEYS[n+1]) or 0)
+else
+	abuse = redis.call('INCR', KEYS[n+1])
+	redis.call('PEXPIRE', KEYS[n+1], ARGV[2])
+end
+local res = {allowed, abuse, retry}
+for i = 1, n do
+	local period = tonumber(ARGV[i*3])
+	local limit = tonumber(ARGV[i*3+1])
+	local tat = tats[i][1]
+	if allowed == 1 then
+		tat = tats[i][2]
+		if tat > now then
+			redis.call('SET', KEYS[i], string.format('%d', tat), 'PX', tat - now)
+		end
+	end
+	local remaining = math.floor((now + period - tat) / (period / limit))
+	if remaining > limit then
+		remaining = limit
+	end
+	res[#res+1] = remaining
+	res[#res+1] = tat - now
+end
+return res
+`)
 
-			err := cnn.Send("MULTI")
-			if shouldReturn(err) {
-				return
-			}
+// gcra takes one round trip per request and stores one value per window,
+// remaining and reset are exact rather than rounded to the window.
+func gcra(cnn redis.Conn, c *Config, abuseKey string, windows []*window, now time.Time) (bool, time.Duration, int, error) {
+	args := make([]interface{}, 0, 1+len(windows)*4+3)
+	args = append(args, len(windows)+1)
+	for _, w := range windows {
+		args = append(args, w.key)
+	}
+	args = append(args, abuseKey, now.UnixNano()/int64(time.Millisecond), c.AbuseWindow.Milliseconds())
+	for _, w := range windows {
+		args = append(args, w.Period.Milliseconds(), w.Limit, w.cost)
+	}
+	res, err := redis.Int64s(gcraScript.Do(cnn, args...))
+	if err != nil {
+		return true, 0, 0, err
+	}
+	for i, w := range windows {
+		w.remaining = int(res[3+i*2])
+		w.reset = time.Duration(res[4+i*2]) * time.Millisecond
+	}
+	return res[0] == 1, time.Duration(res[2]) * time.Millisecond, int(res[1]), nil
+}
 
-			err = cnn.Send("ZADD", key, now, now)
-			if shouldReturn(err) {
-				return
-			}
+type abuseTlbxKey struct{}
 
-			err = cnn.Send("EXPIRE", key, 60)
-			if shouldReturn(err) {
-				return
-			}
+type keyTlbxKey struct{}
 
-			_, err = cnn.Do("EXEC")
-			if shouldReturn(err) {
-				return
-			}
-		}
-	}
+// ClientKey returns the key the current client is rate limited by, it is ""
+// if no rate limit mware has run.
+func ClientKey(tlbx app.Tlbx) string {
+	key, _ := tlbx.Get(keyTlbxKey{}).(string)
+	return key
+}
+
+// AbuseScore returns the number of requests from the current client that
+// have been rejected for exceeding the rate limit within the last
+// AbuseWindow, it is 0 if no rate limit mware has run.
+func AbuseScore(tlbx app.Tlbx) int {
+	score, _ := tlbx.Get(abuseTlbxKey{}).(int)
+	return score
 }
 
 type Config struct {
-	KeyGen      func(tlbx app.Tlbx) string
-	PerMinute   int
-	ExitOnError bool
-	Pool        iredis.Pool
+	KeyGen func(tlbx app.Tlbx) string
+	// PerMinute is the budget shared by every request, Rules add further
+	// windows for specific paths and set the cost of their requests
+	// against PerMinute.
+	PerMinute int
+	Rules     []*Rule
+	// GCRA uses a single lua script per request storing one value per
+	// window instead of a sorted set member per request.
+	GCRA        bool
+	AbuseWindow time.Duration
+	// ExitOnError panics on redis errors, otherwise if Fallback is set
+	// an in memory limiter with at most FallbackMaxKeys keys is used per
+	// instance until redis recovers, which is checked every
+	// FallbackRetry, else requests are let through.
+	ExitOnError     bool
+	Fallback        bool
+	FallbackMaxKeys int
+	FallbackRetry   time.Duration
+	Pool            iredis.Pool
 }
 
 func config(configs ...func(*Config)) *Config {
 	c := &Config{
-		KeyGen:      nil,
-		PerMinute:   300,
-		ExitOnError: false,
-		Pool:        nil,
+		KeyGen:          nil,
+		PerMinute:       300,
+		Rules:           nil,
+		GCRA:            false,
+		AbuseWindow:     time.Hour,
+		ExitOnError:     false,
+		Fallback:        true,
+		FallbackMaxKeys: 100000,
+		FallbackRetry:   5 * time.Second,
+		Pool:            nil,
 	}
 	for _, config := range configs {
 		config(c)
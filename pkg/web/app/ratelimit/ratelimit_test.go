@@ -0,0 +1,196 @@
+package ratelimit_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/0xor1/tlbx/pkg/core"
+	"github.com/0xor1/tlbx/pkg/iredis"
+	"github.com/0xor1/tlbx/pkg/log"
+	"github.com/0xor1/tlbx/pkg/web/app"
+	"github.com/0xor1/tlbx/pkg/web/app/config"
+	. "github.com/0xor1/tlbx/pkg/web/app/ratelimit"
+	"github.com/0xor1/tlbx/pkg/web/app/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RuleCost(t *testing.T) {
+	a := assert.New(t)
+	mware := Mware(func(c *Config) {
+		c.KeyGen = func(app.Tlbx) string { return "rate-limiter-test" }
+		// nothing listens here so the local fallback is used
+		c.Pool = iredis.CreatePool("127.0.0.1:1")
+		c.PerMinute = 30
+		c.Rules = []*Rule{
+			{
+				Name:  "email",
+				Paths: []string{"/test/email"},
+				Cost:  5,
+				Windows: []*Window{
+					{Period: time.Minute, Limit: 5},
+					{Period: time.Hour, Limit: 30},
+				},
+			},
+			PingRule(),
+		}
+	})
+
+	// each request counts once against the rules windows
+	for i := 0; i < 5; i++ {
+		a.True(run(mware, "/api/test/email").allowed)
+	}
+	tlbx := run(mware, "/api/test/email")
+	a.False(tlbx.allowed)
+	a.Equal("12", tlbx.resp.Header().Get("Retry-After"))
+
+	// but costs 5 against PerMinute, so 5 of 30 are left
+	for i := 0; i < 5; i++ {
+		a.True(run(mware, "/api/test/other").allowed)
+	}
+	a.False(run(mware, "/api/test/other").allowed)
+
+	// pings are free against PerMinute
+	for i := 0; i < 10; i++ {
+		a.True(run(mware, "/api/ping").allowed)
+	}
+	a.False(run(mware, "/api/ping").allowed)
+}
+
+func Test_GCRA(t *testing.T) {
+	a := assert.New(t)
+	key := Strf("rate-limiter-gcra-test-%d", NowUnixMilli())
+	ep := func(path string) *app.Endpoint {
+		return &app.Endpoint{
+			Description:  "does nothing",
+			Path:         path,
+			Timeout:      500,
+			MaxBodyBytes: app.KB,
+			GetDefaultArgs: func() interface{} {
+				return nil
+			},
+			GetExampleArgs: func() interface{} {
+				return nil
+			},
+			GetExampleResponse: func() interface{} {
+				return nil
+			},
+			Handler: func(app.Tlbx, interface{}) interface{} {
+				return nil
+			},
+		}
+	}
+	r := test.NewRig(
+		config.GetProcessed(config.GetBase()),
+		[]*app.Endpoint{ep("/test/email"), ep("/test/other")},
+		false,
+		nil,
+		nil,
+		nil,
+		false,
+		func(pool iredis.Pool, _ ...int) func(app.Tlbx) {
+			return Mware(func(c *Config) {
+				c.KeyGen = func(app.Tlbx) string { return key }
+				c.Pool = pool
+				c.PerMinute = 30
+				c.GCRA = true
+				// fail rather than silently using the local limiter
+				c.ExitOnError = true
+				c.Fallback = false
+				c.Rules = []*Rule{
+					{
+						Name:  "email",
+						Paths: []string{"/test/email"},
+						Cost:  5,
+						Windows: []*Window{
+							{Period: time.Minute, Limit: 5},
+						},
+					},
+					PingRule(),
+				}
+			})
+		})
+	defer r.CleanUp()
+	do := func(path string) *http.Response {
+		req := httptest.NewRequest(http.MethodPut, "/api"+path, nil)
+		req.Header.Add("X-Client", "tlbx-ratelimit-tests")
+		w := httptest.NewRecorder()
+		r.RootHandler().ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	res := do("/test/email")
+	a.Equal(http.StatusOK, res.StatusCode)
+	a.Equal("5", res.Header.Get("X-Rate-Limit-Limit"))
+	a.Equal("4", res.Header.Get("X-Rate-Limit-Remaining"))
+	a.Equal("12", res.Header.Get("X-Rate-Limit-Reset"))
+	a.Equal("5;w=60;name=email, 30;w=60;name=default", res.Header.Get("X-Rate-Limit-Policy"))
+	a.Equal("", res.Header.Get("Retry-After"))
+	for i := 0; i < 4; i++ {
+		a.Equal(http.StatusOK, do("/test/email").StatusCode)
+	}
+	res = do("/test/email")
+	a.Equal(http.StatusTooManyRequests, res.StatusCode)
+	a.Equal("0", res.Header.Get("X-Rate-Limit-Remaining"))
+	a.Equal("60", res.Header.Get("X-Rate-Limit-Reset"))
+	a.Equal("12", res.Header.Get("Retry-After"))
+
+	// 25 of the 30 PerMinute budget is used by the 5 allowed emails
+	for i := 0; i < 5; i++ {
+		a.Equal(http.StatusOK, do("/test/other").StatusCode)
+	}
+	res = do("/test/other")
+	a.Equal(http.StatusTooManyRequests, res.StatusCode)
+	a.Equal("30", res.Header.Get("X-Rate-Limit-Limit"))
+	a.Equal("0", res.Header.Get("X-Rate-Limit-Remaining"))
+	a.Equal("60", res.Header.Get("X-Rate-Limit-Reset"))
+	a.Equal("2", res.Header.Get("Retry-After"))
+
+	// pings are free against PerMinute so are allowed even though it is
+	// used up
+	res = do("/ping")
+	a.Equal(http.StatusOK, res.StatusCode)
+	a.Equal("10;w=1;name=ping, 30;w=60;name=default", res.Header.Get("X-Rate-Limit-Policy"))
+	a.Equal("", res.Header.Get("Retry-After"))
+}
+
+// runs mware for a request to path.
+func run(mware func(app.Tlbx), path string) *testTlbx {
+	tlbx := &testTlbx{
+		req:     httptest.NewRequest(http.MethodPut, path, nil),
+		resp:    httptest.NewRecorder(),
+		vals:    map[interface{}]interface{}{},
+		log:     log.New(),
+		allowed: true,
+	}
+	func() {
+		defer func() {
+			tlbx.allowed = recover() == nil
+		}()
+		mware(tlbx)
+	}()
+	return tlbx
+}
+
+type testTlbx struct {
+	req     *http.Request
+	resp    *httptest.ResponseRecorder
+	vals    map[interface{}]interface{}
+	log     log.Log
+	allowed bool
+}
+
+func (t *testTlbx) Req() *http.Request              { return t.req }
+func (t *testTlbx) Resp() http.ResponseWriter       { return t.resp }
+func (t *testTlbx) IP() string                      { return "" }
+func (t *testTlbx) Start() time.Time                { return Now() }
+func (t *testTlbx) StartMilli() int64               { return NowUnixMilli() }
+func (t *testTlbx) Ctx() context.Context            { return context.Background() }
+func (t *testTlbx) ShuttingDown() <-chan struct{}   { return nil }
+func (t *testTlbx) NewID() ID                       { return ID{} }
+func (t *testTlbx) Log() log.Log                    { return t.log }
+func (t *testTlbx) LogActionStats(*app.ActionStats) {}
+func (t *testTlbx) Get(key interface{}) interface{} { return t.vals[key] }
+func (t *testTlbx) Set(key, value interface{})      { t.vals[key] = value }
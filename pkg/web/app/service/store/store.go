@@ -129,6 +129,21 @@ func (c *client) MustPresignedGetUrl(bucket, key string, name string, isAttachme
 	return url
 }
 
+func (c *client) PresignedGetUrlExpires(bucket, key string, name string, isAttachment bool, expires time.Duration) (string, error) {
+	var url string
+	var err error
+	c.do(func() {
+		url, err = c.store.PresignedGetUrlExpires(bucket, key, name, isAttachment, expires)
+	}, Strf("%s %s %s", "GET_PRESIGNED_URL", bucket, key))
+	return url, err
+}
+
+func (c *client) MustPresignedGetUrlExpires(bucket, key string, name string, isAttachment bool, expires time.Duration) string {
+	url, err := c.PresignedGetUrlExpires(bucket, key, name, isAttachment, expires)
+	PanicOn(err)
+	return url
+}
+
 func (c *client) Delete(bucket, key string) error {
 	var err error
 	c.do(func() {
@@ -1,21 +1,82 @@
 package me
 
 import (
+	"encoding/binary"
 	"net/http"
+	"strconv"
+	"time"
 
 	. "github.com/0xor1/tlbx/pkg/core"
+	"github.com/0xor1/tlbx/pkg/iredis"
 	"github.com/0xor1/tlbx/pkg/web/app"
 	"github.com/0xor1/tlbx/pkg/web/app/session"
+	"github.com/gomodule/redigo/redis"
 )
 
+const (
+	legacyLen = 17
+	fullLen   = 25
+	// fullLen plus the impersonating admins ID
+	impersonatedLen = 41
+)
+
+type tlbxKey struct{}
+type tlbxMwareKey struct{}
+
+type Config struct {
+	// OnUpgrade is called by AuthedSet when the request has an existing
+	// unauthed session, i.e. on login, so apps can move anything tied to
+	// the anonymous ID to me, e.g. an active games player ID. It should
+	// do so in a single tx, if it panics the session remains unauthed.
+	OnUpgrade func(tlbx app.Tlbx, anon, me ID)
+	// when OnUpgrade is set upgraded anonymous IDs are remembered for
+	// UpgradedTTL and any request still using one is given a new
+	// unauthed session, so a fixated anonymous session can not be used
+	// to follow the user after they log in.
+	UpgradedTTL time.Duration
+	// IsDisabled is the authority on whether me is disabled, e.g. reading
+	// users.disabledOn, its answer is cached for DisabledTTL and it is
+	// only called on cache misses. Without it only SetDisabled calls in
+	// the last DisabledTTL are enforced.
+	IsDisabled  func(tlbx app.Tlbx, me ID) bool
+	DisabledTTL time.Duration
+}
+
+type mware struct {
+	cache iredis.Pool
+	c     *Config
+}
+
+// Mware enables server side revocation of authed sessions and the
+// anonymous to authed upgrade hook, it must come after the session mware
+// and before anything that calls into this package, e.g.
+// ratelimit.MeMware. Without it sessions can not be revoked.
+func Mware(cache iredis.Pool, configs ...func(*Config)) func(app.Tlbx) {
+	m := &mware{
+		cache: cache,
+		c:     config(configs...),
+	}
+	return func(tlbx app.Tlbx) {
+		tlbx.Set(tlbxMwareKey{}, m)
+	}
+}
+
 type Session interface {
 	IsAuthed() bool
 	ID() ID
+	IssuedOn() time.Time
+	// Impersonator is the admin impersonating ID, see ImpersonateSet,
+	// nil if the session isn't being impersonated.
+	Impersonator() *ID
 }
 
 type ses struct {
-	isAuthed bool
-	id       ID
+	isAuthed     bool
+	id           ID
+	issuedOn     time.Time
+	impersonator *ID
+	// isNew is true if the session was created during this request
+	isNew bool
 }
 
 func (s *ses) IsAuthed() bool {
@@ -26,52 +87,93 @@ func (s *ses) ID() ID {
 	return s.id
 }
 
+func (s *ses) IssuedOn() time.Time {
+	return s.issuedOn
+}
+
+func (s *ses) Impersonator() *ID {
+	return s.impersonator
+}
+
 func (s *ses) MarshalBinary() ([]byte, error) {
-	bs := make([]byte, 17, 17)
+	l := fullLen
+	if s.impersonator != nil {
+		l = impersonatedLen
+	}
+	bs := make([]byte, l, l)
 	bs[0] = byte('t')
 	if !s.isAuthed {
 		bs[0] = byte('f')
 	}
-	err := s.id.MarshalBinaryTo(bs[1:])
+	err := s.id.MarshalBinaryTo(bs[1:legacyLen])
 	if err != nil {
 		return nil, err
 	}
+	binary.BigEndian.PutUint64(bs[legacyLen:fullLen], uint64(s.issuedOn.UnixNano()/int64(time.Millisecond)))
+	if s.impersonator != nil {
+		err = s.impersonator.MarshalBinaryTo(bs[fullLen:])
+		if err != nil {
+			return nil, err
+		}
+	}
 	return bs, nil
 }
 
 func (s *ses) UnmarshalBinary(data []byte) error {
+	if len(data) != legacyLen && len(data) != fullLen && len(data) != impersonatedLen {
+		return Err("invalid session data length %d", len(data))
+	}
 	s.isAuthed = string(data[0:1]) == `t`
 	id := &ID{}
-	e := id.UnmarshalBinary(data[1:])
+	e := id.UnmarshalBinary(data[1:legacyLen])
 	if e != nil {
 		return e
 	}
 	PanicIfZeroID(*id)
 	s.id = *id
+	// legacy sessions have no issuedOn so are treated as issued at the epoch
+	s.issuedOn = time.Time{}
+	if len(data) >= fullLen {
+		s.issuedOn = time.Unix(0, int64(binary.BigEndian.Uint64(data[legacyLen:fullLen]))*int64(time.Millisecond)).UTC()
+	}
+	s.impersonator = nil
+	if len(data) == impersonatedLen {
+		admin := &ID{}
+		e = admin.UnmarshalBinary(data[fullLen:])
+		if e != nil {
+			return e
+		}
+		s.impersonator = admin
+	}
 	return nil
 }
 
 func Get(tlbx app.Tlbx) Session {
+	if cached, ok := tlbx.Get(tlbxKey{}).(*ses); ok {
+		return cached
+	}
 	s := session.Get(tlbx)
 	ses := &ses{}
 	if s.Exists() {
 		err := ses.UnmarshalBinary(s.Get())
 		if err == nil {
+			if (!ses.isAuthed && !isUpgraded(tlbx, ses)) || (ses.isAuthed && !isRevoked(tlbx, ses)) {
+				tlbx.Set(tlbxKey{}, ses)
+				return ses
+			}
+		} else {
 			// if the struct doesnt unmarshal nicely then just wipe the session
-			return ses
+			tlbx.Log().Warning("error unmarshalling session struct: %s", err.Error())
 		}
-		tlbx.Log().Warning("error unmarshalling session struct: %s", err.Error())
 	}
 	// if session doesnt exist create a new unauthed one
-	ses.isAuthed = false
-	ses.id = tlbx.NewID()
-	bs, err := ses.MarshalBinary()
-	PanicOn(err)
-	s.Set(bs)
+	ses = set(tlbx, false, tlbx.NewID())
+	ses.isNew = true
 	return ses
 }
 
 func Del(tlbx app.Tlbx) {
+	tlbx.Set(tlbxKey{}, nil)
 	session.Get(tlbx).Del()
 }
 
@@ -85,12 +187,191 @@ func AuthedGet(tlbx app.Tlbx) ID {
 	return ses.ID()
 }
 
+// AuthedSet authes the session as me, if the request had an unauthed
+// session it is upgraded, see Config.OnUpgrade, the session is always
+// reissued so no previous session value survives.
 func AuthedSet(tlbx app.Tlbx, me ID) {
+	if anon := existingAnon(tlbx); anon != nil {
+		if m := getMware(tlbx); m != nil && m.c.OnUpgrade != nil {
+			m.c.OnUpgrade(tlbx, anon.id, me)
+			setUpgraded(tlbx, m, anon.id)
+		}
+	}
+	set(tlbx, true, me)
+}
+
+// ImpersonateSet authes the session as me on behalf of admin, the
+// session is marked with admin, see Session.Impersonator, so actions
+// taken with it can be attributed to them.
+func ImpersonateSet(tlbx app.Tlbx, admin, me ID) {
 	ses := &ses{
-		isAuthed: true,
-		id:       me,
+		isAuthed:     true,
+		id:           me,
+		issuedOn:     NowMilli(),
+		impersonator: &admin,
 	}
+	save(tlbx, ses)
+}
+
+// RevokeAll logs out every session authed as me, on every device, that was
+// issued before now, including the current requests session if it is one.
+func RevokeAll(tlbx app.Tlbx, me ID) {
+	m := getMware(tlbx)
+	if m == nil {
+		tlbx.Log().Warning("me.Mware not installed, unable to revoke sessions for %s", me)
+		return
+	}
+	cnn := m.cache.Get()
+	defer cnn.Close()
+	_, err := cnn.Do("SET", revokedKey(me), NowUnixMilli())
+	PanicOn(err)
+	if ses, ok := tlbx.Get(tlbxKey{}).(*ses); ok && ses.isAuthed && ses.id.Equal(me) {
+		Del(tlbx)
+	}
+}
+
+// SetDisabled caches that me has been disabled or re-enabled, it must be
+// called after the change is committed to the Config.IsDisabled authority,
+// while disabled every session authed as me is treated as revoked.
+func SetDisabled(tlbx app.Tlbx, me ID, disabled bool) {
+	m := getMware(tlbx)
+	if m == nil {
+		tlbx.Log().Warning("me.Mware not installed, unable to set disabled for %s", me)
+		return
+	}
+	cnn := m.cache.Get()
+	defer cnn.Close()
+	PanicOn(cacheDisabled(cnn, m, me, disabled))
+	if ses, ok := tlbx.Get(tlbxKey{}).(*ses); disabled && ok && ses.isAuthed && ses.id.Equal(me) {
+		Del(tlbx)
+	}
+}
+
+func set(tlbx app.Tlbx, isAuthed bool, id ID) *ses {
+	ses := &ses{
+		isAuthed: isAuthed,
+		id:       id,
+		issuedOn: NowMilli(),
+	}
+	save(tlbx, ses)
+	return ses
+}
+
+func save(tlbx app.Tlbx, ses *ses) {
 	bs, err := ses.MarshalBinary()
 	PanicOn(err)
 	session.Get(tlbx).Set(bs)
+	tlbx.Set(tlbxKey{}, ses)
+}
+
+func getMware(tlbx app.Tlbx) *mware {
+	m, ok := tlbx.Get(tlbxMwareKey{}).(*mware)
+	if !ok || m == nil || m.cache == nil {
+		return nil
+	}
+	return m
+}
+
+// returns the requests unauthed session if it came with one, it does
+// not create a new session like Get does.
+func existingAnon(tlbx app.Tlbx) *ses {
+	if cached, ok := tlbx.Get(tlbxKey{}).(*ses); ok && cached != nil {
+		if cached.isAuthed || cached.isNew {
+			return nil
+		}
+		return cached
+	}
+	s := session.Get(tlbx)
+	if !s.Exists() {
+		return nil
+	}
+	ses := &ses{}
+	if ses.UnmarshalBinary(s.Get()) != nil || ses.isAuthed || isUpgraded(tlbx, ses) {
+		return nil
+	}
+	return ses
+}
+
+func setUpgraded(tlbx app.Tlbx, m *mware, anon ID) {
+	cnn := m.cache.Get()
+	defer cnn.Close()
+	_, err := cnn.Do("SET", upgradedKey(anon), 1, "PX", m.c.UpgradedTTL.Milliseconds())
+	PanicOn(err)
+}
+
+func isUpgraded(tlbx app.Tlbx, ses *ses) bool {
+	m := getMware(tlbx)
+	if m == nil || m.c.OnUpgrade == nil {
+		return false
+	}
+	cnn := m.cache.Get()
+	defer cnn.Close()
+	upgraded, err := redis.Bool(cnn.Do("EXISTS", upgradedKey(ses.id)))
+	if err != nil {
+		tlbx.Log().ErrorOn(err)
+		return false
+	}
+	return upgraded
+}
+
+// redis errors fail closed, i.e. panic, rather than risk letting a
+// revoked or disabled session through.
+func isRevoked(tlbx app.Tlbx, ses *ses) bool {
+	m := getMware(tlbx)
+	if m == nil {
+		return false
+	}
+	cnn := m.cache.Get()
+	defer cnn.Close()
+	vals, err := redis.Strings(cnn.Do("MGET", revokedKey(ses.id), disabledKey(ses.id)))
+	PanicOn(err)
+	disabled := vals[1] == "1"
+	if vals[1] == "" && m.c.IsDisabled != nil {
+		// not cached or evicted so ask the authority
+		disabled = m.c.IsDisabled(tlbx, ses.id)
+		tlbx.Log().ErrorOn(cacheDisabled(cnn, m, ses.id, disabled))
+	}
+	if disabled {
+		return true
+	}
+	if vals[0] == "" {
+		return false
+	}
+	milli, err := strconv.ParseInt(vals[0], 10, 64)
+	PanicOn(err)
+	return ses.issuedOn.UnixNano()/int64(time.Millisecond) < milli
+}
+
+func cacheDisabled(cnn redis.Conn, m *mware, me ID, disabled bool) error {
+	val := "0"
+	if disabled {
+		val = "1"
+	}
+	_, err := cnn.Do("SET", disabledKey(me), val, "PX", m.c.DisabledTTL.Milliseconds())
+	return err
+}
+
+func revokedKey(me ID) string {
+	return Strf("me_revoked_%s", me)
+}
+
+func disabledKey(me ID) string {
+	return Strf("me_disabled_%s", me)
+}
+
+func upgradedKey(anon ID) string {
+	return Strf("me_upgraded_%s", anon)
+}
+
+func config(configs ...func(*Config)) *Config {
+	c := &Config{
+		OnUpgrade:   nil,
+		UpgradedTTL: 7 * 24 * time.Hour,
+		IsDisabled:  nil,
+		DisabledTTL: time.Minute,
+	}
+	for _, config := range configs {
+		config(c)
+	}
+	return c
 }
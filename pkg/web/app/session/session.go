@@ -3,8 +3,10 @@ package session
 import (
 	"net/http"
 	"sync"
+	"time"
 
 	. "github.com/0xor1/tlbx/pkg/core"
+	"github.com/0xor1/tlbx/pkg/crypt"
 	"github.com/0xor1/tlbx/pkg/web/app"
 	"github.com/gorilla/sessions"
 )
@@ -21,6 +23,7 @@ func BasicMware(authKey64s, encrKey32s [][]byte, secure bool) func(app.Tlbx) {
 
 func Mware(configs ...func(*Config)) func(app.Tlbx) {
 	c := config(configs...)
+	PanicIf(len(c.AuthKey64s) != len(c.EncrKey32s), "authKey64s and encrKey32s must be the same length")
 	AuthEncrKeyPairs := make([][]byte, 0, len(c.AuthKey64s)*2)
 	for i := range c.AuthKey64s {
 		PanicIf(len(c.AuthKey64s[i]) != 64, "authKey64s length is not 64")
@@ -35,29 +38,82 @@ func Mware(configs ...func(*Config)) func(app.Tlbx) {
 	store.Options.HttpOnly = c.HttpOnly
 	store.Options.SameSite = c.SameSite
 	return func(tlbx app.Tlbx) {
-		gorilla, err := store.Get(tlbx.Req(), c.Name)
+		gorilla, keyIdx, err := load(store, tlbx.Req(), c.Name)
 		tlbx.Log().ErrorOn(err)
-		PanicIf(gorilla == nil, "nil gorilla session object")
 		s := &session{
 			tlbx:    tlbx,
+			c:       c,
 			gorilla: gorilla,
 			mtx:     &sync.RWMutex{},
 		}
 		if !s.gorilla.IsNew {
-			i, ok := s.gorilla.Values["v"]
-			if ok {
+			now := NowUnixMilli()
+			createdOn, _ := s.gorilla.Values["c"].(int64)
+			activeOn, _ := s.gorilla.Values["a"].(int64)
+			if createdOn == 0 {
+				// sessions from before timeouts were added start now
+				createdOn = now
+				activeOn = now
+			}
+			if (c.AbsoluteTimeout > 0 && now-createdOn > c.AbsoluteTimeout.Milliseconds()) ||
+				(c.IdleTimeout > 0 && now-activeOn > c.IdleTimeout.Milliseconds()) {
+				// expired sessions are treated as if there was no session
+				s.gorilla.IsNew = true
+				s.gorilla.Values = map[interface{}]interface{}{}
+			} else if i, ok := s.gorilla.Values["v"]; ok {
 				s.v = i.([]byte)
+				s.createdOn = createdOn
+				s.token, _ = s.gorilla.Values["t"].(string)
+				if s.token == "" {
+					s.token = crypt.UrlSafeString(tokenLen)
+				}
+				// reissue the cookie if it was decoded with an old key, is
+				// a legacy cookie or to slide the idle timeout, the idle
+				// timeout is only slid once a tenth of it has passed to
+				// avoid setting the cookie on every request
+				if keyIdx > 0 ||
+					s.gorilla.Values["c"] == nil ||
+					s.gorilla.Values["t"] == nil ||
+					(c.IdleTimeout > 0 && now-activeOn > c.IdleTimeout.Milliseconds()/10) {
+					s.save()
+				}
 			}
 		}
 		tlbx.Set(tlbxKey{}, s)
 	}
 }
 
+// load decodes the named cookie with the first codec that can, returning
+// that codecs index, 0 being the newest key.
+func load(store *sessions.CookieStore, r *http.Request, name string) (*sessions.Session, int, error) {
+	s := sessions.NewSession(store, name)
+	opts := *store.Options
+	s.Options = &opts
+	s.IsNew = true
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return s, 0, nil
+	}
+	for i, codec := range store.Codecs {
+		values := map[interface{}]interface{}{}
+		err = codec.Decode(name, cookie.Value, &values)
+		if err == nil {
+			s.Values = values
+			s.IsNew = false
+			return s, i, nil
+		}
+	}
+	return s, 0, err
+}
+
 func Get(tlbx app.Tlbx) Session {
 	return tlbx.Get(tlbxKey{}).(Session)
 }
 
 type Config struct {
+	// AuthKey64s and EncrKey32s are parallel, the first pair is used to
+	// encode cookies, the rest are only used to decode them, cookies
+	// decoded with an older pair are reissued with the first.
 	AuthKey64s [][]byte
 	EncrKey32s [][]byte
 	Name       string
@@ -66,7 +122,19 @@ type Config struct {
 	MaxAge     int
 	Secure     bool
 	HttpOnly   bool
-	SameSite   http.SameSite
+	// SameSite defaults to lax so cookies are not sent on cross site
+	// subrequests or POSTs, csrf.Mware covers the rest.
+	SameSite http.SameSite
+	// TokenCookieName is the name of the cookie the sessions csrf token
+	// is written to, it is not HttpOnly so js clients can read it and
+	// send it back in the app.CSRFHeader header.
+	TokenCookieName string
+	// sessions are treated as not existing once AbsoluteTimeout has
+	// passed since they were Set or IdleTimeout has passed since the
+	// last request, both are stored in the encrypted cookie and 0
+	// disables them.
+	AbsoluteTimeout time.Duration
+	IdleTimeout     time.Duration
 }
 
 type Session interface {
@@ -74,13 +142,21 @@ type Session interface {
 	Get() []byte
 	Set([]byte)
 	Del()
+	// Token is a random value regenerated on every Set, it is used by
+	// csrf.Mware and is "" if the session doesnt exist.
+	Token() string
 }
 
+const tokenLen = 32
+
 type session struct {
-	tlbx    app.Tlbx
-	v       []byte
-	gorilla *sessions.Session
-	mtx     *sync.RWMutex
+	tlbx      app.Tlbx
+	c         *Config
+	v         []byte
+	createdOn int64
+	token     string
+	gorilla   *sessions.Session
+	mtx       *sync.RWMutex
 }
 
 func (s *session) Exists() bool {
@@ -99,20 +175,52 @@ func (s *session) Set(v []byte) {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 	s.v = v
+	s.createdOn = NowUnixMilli()
+	s.token = crypt.UrlSafeString(tokenLen)
+	// a previous Del in the same request sets MaxAge to -1
+	s.gorilla.Options.MaxAge = s.c.MaxAge
+	s.save()
+}
+
+// save must be called with mtx locked or before s is shared.
+func (s *session) save() {
 	s.gorilla.Values = map[interface{}]interface{}{
-		"v": v,
+		"v": s.v,
+		"c": s.createdOn,
+		"a": NowUnixMilli(),
+		"t": s.token,
 	}
-
 	PanicOn(s.gorilla.Save(s.tlbx.Req(), s.tlbx.Resp()))
+	s.setTokenCookie()
+}
+
+func (s *session) setTokenCookie() {
+	if s.c.TokenCookieName == "" {
+		return
+	}
+	opts := *s.gorilla.Options
+	opts.HttpOnly = false
+	http.SetCookie(s.tlbx.Resp(), sessions.NewCookie(s.c.TokenCookieName, s.token, &opts))
+}
+
+func (s *session) Token() string {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	if len(s.v) == 0 {
+		return ""
+	}
+	return s.token
 }
 
 func (s *session) Del() {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 	s.v = nil
+	s.token = ""
 	s.gorilla.Options.MaxAge = -1
 	s.gorilla.Values = map[interface{}]interface{}{}
 	PanicOn(s.gorilla.Save(s.tlbx.Req(), s.tlbx.Resp()))
+	s.setTokenCookie()
 }
 
 func config(configs ...func(*Config)) *Config {
@@ -125,7 +233,12 @@ func config(configs ...func(*Config)) *Config {
 		MaxAge:     0,
 		Secure:     false,
 		HttpOnly:   true,
-		SameSite:   http.SameSiteDefaultMode,
+		SameSite:   http.SameSiteLaxMode,
+		// csrf tokens are always written so csrf.Mware can be added
+		TokenCookieName: app.CSRFCookie,
+		// timeouts are disabled by default for backwards compatibility
+		AbsoluteTimeout: 0,
+		IdleTimeout:     0,
 	}
 	for _, config := range configs {
 		config(c)
@@ -0,0 +1,158 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/0xor1/tlbx/pkg/core"
+	"github.com/0xor1/tlbx/pkg/crypt"
+	"github.com/0xor1/tlbx/pkg/log"
+	"github.com/0xor1/tlbx/pkg/web/app"
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_KeyRotation(t *testing.T) {
+	a := assert.New(t)
+	auth1, encr1 := crypt.Bytes(64), crypt.Bytes(32)
+	auth2, encr2 := crypt.Bytes(64), crypt.Bytes(32)
+	old := Mware(func(c *Config) {
+		c.AuthKey64s = [][]byte{auth1}
+		c.EncrKey32s = [][]byte{encr1}
+	})
+	rotated := Mware(func(c *Config) {
+		c.AuthKey64s = [][]byte{auth2, auth1}
+		c.EncrKey32s = [][]byte{encr2, encr1}
+	})
+	newOnly := Mware(func(c *Config) {
+		c.AuthKey64s = [][]byte{auth2}
+		c.EncrKey32s = [][]byte{encr2}
+	})
+
+	tlbx := run(old, nil)
+	Get(tlbx).Set([]byte("a"))
+	oldCookie := cookie(tlbx)
+	a.NotNil(oldCookie)
+
+	// old cookies still decode and are reissued with the newest key
+	tlbx = run(rotated, oldCookie)
+	a.Equal([]byte("a"), Get(tlbx).Get())
+	newCookie := cookie(tlbx)
+	a.NotNil(newCookie)
+	a.NotEqual(oldCookie.Value, newCookie.Value)
+
+	tlbx = run(newOnly, newCookie)
+	a.Equal([]byte("a"), Get(tlbx).Get())
+	// already on the newest key so not reissued
+	a.Nil(cookie(tlbx))
+
+	// once the old key is dropped old cookies are treated as new
+	tlbx = run(newOnly, oldCookie)
+	a.False(Get(tlbx).Exists())
+}
+
+func Test_Timeouts(t *testing.T) {
+	a := assert.New(t)
+	auth, encr := crypt.Bytes(64), crypt.Bytes(32)
+	configs := func(c *Config) {
+		c.AuthKey64s = [][]byte{auth}
+		c.EncrKey32s = [][]byte{encr}
+		c.AbsoluteTimeout = 24 * time.Hour
+		c.IdleTimeout = time.Hour
+	}
+	mware := Mware(configs)
+	store := sessions.NewCookieStore(auth, encr)
+	now := NowUnixMilli()
+	hour := time.Hour.Milliseconds()
+
+	tlbx := run(mware, encode(store, now-2*hour, now-hour/2))
+	a.Equal([]byte("a"), Get(tlbx).Get())
+	a.Equal("t", Get(tlbx).Token())
+	// reissued to slide the idle timeout
+	a.NotNil(cookie(tlbx))
+
+	tlbx = run(mware, encode(store, now-2*hour, now-hour/20))
+	a.Equal([]byte("a"), Get(tlbx).Get())
+	// too recently active to be worth reissuing
+	a.Nil(cookie(tlbx))
+
+	// idle expired
+	tlbx = run(mware, encode(store, now-2*hour, now-2*hour))
+	a.False(Get(tlbx).Exists())
+	a.Equal("", Get(tlbx).Token())
+
+	// absolute expired, even though recently active
+	tlbx = run(mware, encode(store, now-25*hour, now))
+	a.False(Get(tlbx).Exists())
+
+	// timeouts of 0 are disabled
+	tlbx = run(Mware(configs, func(c *Config) {
+		c.AbsoluteTimeout = 0
+		c.IdleTimeout = 0
+	}), encode(store, now-25*hour, now-25*hour))
+	a.Equal([]byte("a"), Get(tlbx).Get())
+}
+
+// encodes a session cookie as if it was created and last active at the
+// given unix millis.
+func encode(store *sessions.CookieStore, createdOn, activeOn int64) *http.Cookie {
+	s := sessions.NewSession(store, "s")
+	s.Values = map[interface{}]interface{}{
+		"v": []byte("a"),
+		"c": createdOn,
+		"a": activeOn,
+		"t": "t",
+	}
+	w := httptest.NewRecorder()
+	PanicOn(store.Save(httptest.NewRequest(http.MethodPut, "/api/test", nil), w, s))
+	return w.Result().Cookies()[0]
+}
+
+// runs mware for a request with the session cookie c, if any.
+func run(mware func(app.Tlbx), c *http.Cookie) *testTlbx {
+	req := httptest.NewRequest(http.MethodPut, "/api/test", nil)
+	if c != nil {
+		req.AddCookie(c)
+	}
+	tlbx := &testTlbx{
+		req:  req,
+		resp: httptest.NewRecorder(),
+		vals: map[interface{}]interface{}{},
+		log:  log.New(),
+	}
+	mware(tlbx)
+	return tlbx
+}
+
+// returns the session cookie set on the response, if any.
+func cookie(tlbx *testTlbx) *http.Cookie {
+	for _, c := range tlbx.resp.Result().Cookies() {
+		if c.Name == "s" {
+			return c
+		}
+	}
+	return nil
+}
+
+type testTlbx struct {
+	req  *http.Request
+	resp *httptest.ResponseRecorder
+	vals map[interface{}]interface{}
+	log  log.Log
+}
+
+func (t *testTlbx) Req() *http.Request              { return t.req }
+func (t *testTlbx) Resp() http.ResponseWriter       { return t.resp }
+func (t *testTlbx) IP() string                      { return "" }
+func (t *testTlbx) Start() time.Time                { return Now() }
+func (t *testTlbx) StartMilli() int64               { return NowUnixMilli() }
+func (t *testTlbx) Ctx() context.Context            { return context.Background() }
+func (t *testTlbx) ShuttingDown() <-chan struct{}   { return nil }
+func (t *testTlbx) NewID() ID                       { return ID{} }
+func (t *testTlbx) Log() log.Log                    { return t.log }
+func (t *testTlbx) LogActionStats(*app.ActionStats) {}
+func (t *testTlbx) Get(key interface{}) interface{} { return t.vals[key] }
+func (t *testTlbx) Set(key, value interface{})      { t.vals[key] = value }
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync"
 	"time"
 
 	. "github.com/0xor1/tlbx/pkg/core"
@@ -16,10 +17,14 @@ import (
 	"github.com/0xor1/tlbx/pkg/store"
 	"github.com/0xor1/tlbx/pkg/web/app"
 	"github.com/0xor1/tlbx/pkg/web/app/config"
+	"github.com/0xor1/tlbx/pkg/web/app/csrf"
+	"github.com/0xor1/tlbx/pkg/web/app/pow"
+	"github.com/0xor1/tlbx/pkg/web/app/pow/poweps"
 	"github.com/0xor1/tlbx/pkg/web/app/ratelimit"
 	"github.com/0xor1/tlbx/pkg/web/app/service"
 	"github.com/0xor1/tlbx/pkg/web/app/service/sql"
 	"github.com/0xor1/tlbx/pkg/web/app/session"
+	"github.com/0xor1/tlbx/pkg/web/app/session/me"
 	"github.com/0xor1/tlbx/pkg/web/app/user"
 	"github.com/0xor1/tlbx/pkg/web/app/user/usereps"
 )
@@ -53,6 +58,12 @@ type Rig interface {
 	Email() email.Client
 	Store() store.Client
 	CreateUser(handlePrefix string) User
+	// Pow solves a challenge from the pow endpoint, as required by the
+	// user endpoints that send emails, challenges are only accepted from
+	// the client that requested them
+	Pow(c *app.Client) *pow.Solution
+	// Upgraded returns the ID anon was upgraded to by me.Config.OnUpgrade
+	Upgraded(anon ID) *ID
 	// cleanup
 	CleanUp()
 }
@@ -101,6 +112,8 @@ type rig struct {
 	store       store.Client
 	fcm         fcm.Client
 	useAuth     bool
+	upgradesMtx sync.Mutex
+	upgrades    map[string]ID
 }
 
 func (r *rig) RootHandler() http.HandlerFunc {
@@ -238,14 +251,55 @@ func NewRig(
 		pwd:       config.SQL.Pwd,
 		data:      config.SQL.Data,
 		useAuth:   useUsers,
+		upgrades:  map[string]ID{},
 	}
 
 	for _, bucket := range buckets {
 		r.store.MustCreateBucket(bucket, "private")
 	}
 
+	var tickers []*app.Ticker
 	if useUsers {
+		userConfig := func(c *usereps.Config) {
+			c.UnlockFmtLink = config.App.UnlockFmtLink
+			c.RestoreFmtLink = config.App.RestoreFmtLink
+			c.InviteFmtLink = config.App.InviteFmtLink
+			c.RevertChangeEmailFmtLink = config.App.RevertChangeEmailFmtLink
+			c.RegistrationMode = config.App.RegistrationMode
+			c.EnableAdmin = true
+			// purge often so tests dont wait for it
+			c.DeletePurgeInterval = 100 * time.Millisecond
+			// low difficulty so tests solve challenges quickly
+			c.RequirePow = true
+			c.PowConfigs = []func(*poweps.Config){
+				func(c *poweps.Config) {
+					c.BaseDifficulty = 4
+					c.MaxDifficulty = 8
+				},
+			}
+			c.ProfileFields = []*usereps.ProfileField{
+				{
+					ProfileField: user.ProfileField{
+						Name:       "bio",
+						Type:       user.ProfileString,
+						Visibility: user.ProfilePublic,
+						MaxLen:     200,
+					},
+					Example: "I like trees",
+				},
+				{
+					ProfileField: user.ProfileField{
+						Name:       "timezone",
+						Type:       user.ProfileString,
+						Visibility: user.ProfilePrivate,
+						MaxLen:     50,
+					},
+					Example: "Europe/London",
+				},
+			}
+		}
 		r.store.MustCreateBucket(usereps.AvatarBucket, "public_read")
+		r.store.MustCreateBucket(usereps.ExportBucket, "private")
 		eps = append(
 			eps,
 			usereps.New(
@@ -253,10 +307,13 @@ func NewRig(
 				config.App.ActivateFmtLink,
 				config.App.LoginLinkFmtLink,
 				config.App.ConfirmChangeEmailFmtLink,
+				config.App.ResetPwdFmtLink,
 				onDelete,
 				onSetSocials,
 				validateFcmTopic,
-				enableJin)...)
+				enableJin,
+				userConfig)...)
+		tickers = usereps.Tickers(onDelete, userConfig)
 	}
 	Go(func() {
 		app.Run(func(c *app.Config) {
@@ -266,11 +323,18 @@ func NewRig(
 					config.Web.Session.AuthKey64s,
 					config.Web.Session.EncrKey32s,
 					config.Web.Session.Secure),
+				csrf.Mware(),
+				me.Mware(r.cache, func(c *me.Config) {
+					c.IsDisabled = usereps.IsDisabled(r.user)
+					c.OnUpgrade = r.onUpgrade
+				}),
 				rateLimitMware(r.rateLimit, 1000000),
 				service.Mware(r.cache, r.user, r.pwd, r.data, r.email, r.store, r.fcm),
+				usereps.ImpersonationAuditMware,
 			}
 			c.Endpoints = eps
-			c.Serve = func(h http.HandlerFunc) {
+			c.Tickers = tickers
+			c.Serve = func(h http.HandlerFunc, _ func()) {
 				r.rootHandler = h
 			}
 		})
@@ -297,6 +361,25 @@ func (r *rig) CleanUp() {
 	}
 }
 
+func (r *rig) Pow(c *app.Client) *pow.Solution {
+	return pow.Solve((&pow.GetChallenge{}).MustDo(c))
+}
+
+func (r *rig) Upgraded(anon ID) *ID {
+	r.upgradesMtx.Lock()
+	defer r.upgradesMtx.Unlock()
+	if me, ok := r.upgrades[anon.String()]; ok {
+		return &me
+	}
+	return nil
+}
+
+func (r *rig) onUpgrade(tlbx app.Tlbx, anon, me ID) {
+	r.upgradesMtx.Lock()
+	defer r.upgradesMtx.Unlock()
+	r.upgrades[anon.String()] = me
+}
+
 func (r *rig) CreateUser(handlePrefix string) User {
 	_, exists := r.users[handlePrefix]
 	PanicIf(exists, "%s test user handle prefix already used", handlePrefix)
@@ -309,6 +392,7 @@ func (r *rig) CreateUser(handlePrefix string) User {
 			Alias:  ptr.String(handlePrefix),
 			Email:  email,
 			Pwd:    pwd,
+			Pow:    r.Pow(c),
 		}
 		reg.MustDo(c)
 
@@ -2,17 +2,22 @@ package user
 
 import (
 	"io"
+	"time"
 
 	. "github.com/0xor1/tlbx/pkg/core"
 	"github.com/0xor1/tlbx/pkg/json"
 	"github.com/0xor1/tlbx/pkg/web/app"
+	"github.com/0xor1/tlbx/pkg/web/app/filter"
+	"github.com/0xor1/tlbx/pkg/web/app/pow"
 )
 
 type Register struct {
-	Alias  *string `json:"alias,omitempty"`
-	Handle *string `json:"handle,omitempty"`
-	Email  string  `json:"email"`
-	Pwd    string  `json:"pwd"`
+	Alias      *string       `json:"alias,omitempty"`
+	Handle     *string       `json:"handle,omitempty"`
+	Email      string        `json:"email"`
+	Pwd        string        `json:"pwd"`
+	InviteCode *string       `json:"inviteCode,omitempty"`
+	Pow        *pow.Solution `json:"pow,omitempty"`
 }
 
 func (_ *Register) Path() string {
@@ -28,7 +33,8 @@ func (a *Register) MustDo(c *app.Client) {
 }
 
 type ResendActivateLink struct {
-	Email string `json:"email"`
+	Email string        `json:"email"`
+	Pow   *pow.Solution `json:"pow,omitempty"`
 }
 
 func (_ *ResendActivateLink) Path() string {
@@ -107,8 +113,26 @@ func (a *ConfirmChangeEmail) MustDo(c *app.Client) {
 	PanicOn(a.Do(c))
 }
 
+type RevertChangeEmail struct {
+	Me   ID     `json:"me"`
+	Code string `json:"code"`
+}
+
+func (_ *RevertChangeEmail) Path() string {
+	return "/user/revertChangeEmail"
+}
+
+func (a *RevertChangeEmail) Do(c *app.Client) error {
+	return app.Call(c, a.Path(), a, nil)
+}
+
+func (a *RevertChangeEmail) MustDo(c *app.Client) {
+	PanicOn(a.Do(c))
+}
+
 type ResetPwd struct {
-	Email string `json:"email"`
+	Email string        `json:"email"`
+	Pow   *pow.Solution `json:"pow,omitempty"`
 }
 
 func (_ *ResetPwd) Path() string {
@@ -123,6 +147,24 @@ func (a *ResetPwd) MustDo(c *app.Client) {
 	PanicOn(a.Do(c))
 }
 
+type ConfirmResetPwd struct {
+	Me     ID     `json:"me"`
+	Code   string `json:"code"`
+	NewPwd string `json:"newPwd"`
+}
+
+func (_ *ConfirmResetPwd) Path() string {
+	return "/user/confirmResetPwd"
+}
+
+func (a *ConfirmResetPwd) Do(c *app.Client) error {
+	return app.Call(c, a.Path(), a, nil)
+}
+
+func (a *ConfirmResetPwd) MustDo(c *app.Client) {
+	PanicOn(a.Do(c))
+}
+
 type SetHandle struct {
 	Handle string `json:"handle"`
 }
@@ -176,6 +218,20 @@ func (a *SetAvatar) MustDo(c *app.Client) {
 	PanicOn(a.Do(c))
 }
 
+type DeleteAvatar struct{}
+
+func (_ *DeleteAvatar) Path() string {
+	return "/user/deleteAvatar"
+}
+
+func (a *DeleteAvatar) Do(c *app.Client) error {
+	return app.Call(c, a.Path(), nil, nil)
+}
+
+func (a *DeleteAvatar) MustDo(c *app.Client) {
+	PanicOn(a.Do(c))
+}
+
 type SetPwd struct {
 	OldPwd string `json:"oldPwd"`
 	NewPwd string `json:"newPwd"`
@@ -231,7 +287,8 @@ func (a *Login) MustDo(c *app.Client) *Me {
 }
 
 type SendLoginLinkEmail struct {
-	Email string `json:"email"`
+	Email string        `json:"email"`
+	Pow   *pow.Solution `json:"pow,omitempty"`
 }
 
 func (_ *SendLoginLinkEmail) Path() string {
@@ -267,6 +324,106 @@ func (a *LoginLinkLogin) MustDo(c *app.Client) *Me {
 	return res
 }
 
+type Unlock struct {
+	Me   ID     `json:"me"`
+	Code string `json:"code"`
+}
+
+func (_ *Unlock) Path() string {
+	return "/user/unlock"
+}
+
+func (a *Unlock) Do(c *app.Client) error {
+	return app.Call(c, a.Path(), a, nil)
+}
+
+func (a *Unlock) MustDo(c *app.Client) {
+	PanicOn(a.Do(c))
+}
+
+type Invite struct {
+	Code      string    `json:"code"`
+	CreatedBy ID        `json:"createdBy"`
+	CreatedOn time.Time `json:"createdOn"`
+	Email     *string   `json:"email,omitempty"`
+	MaxUses   uint16    `json:"maxUses"`
+	Uses      uint16    `json:"uses"`
+	ExpiresOn time.Time `json:"expiresOn"`
+}
+
+type CreateInvite struct {
+	Email     *string   `json:"email,omitempty"`
+	MaxUses   uint16    `json:"maxUses"`
+	ExpiresOn time.Time `json:"expiresOn"`
+}
+
+func (_ *CreateInvite) Path() string {
+	return "/user/createInvite"
+}
+
+func (a *CreateInvite) Do(c *app.Client) (*Invite, error) {
+	res := &Invite{}
+	err := app.Call(c, a.Path(), a, &res)
+	return res, err
+}
+
+func (a *CreateInvite) MustDo(c *app.Client) *Invite {
+	res, err := a.Do(c)
+	PanicOn(err)
+	return res
+}
+
+type GetInvites struct{}
+
+func (_ *GetInvites) Path() string {
+	return "/user/getInvites"
+}
+
+func (a *GetInvites) Do(c *app.Client) ([]*Invite, error) {
+	res := []*Invite{}
+	err := app.Call(c, a.Path(), nil, &res)
+	return res, err
+}
+
+func (a *GetInvites) MustDo(c *app.Client) []*Invite {
+	res, err := a.Do(c)
+	PanicOn(err)
+	return res
+}
+
+type DeleteInvite struct {
+	Code string `json:"code"`
+}
+
+func (_ *DeleteInvite) Path() string {
+	return "/user/deleteInvite"
+}
+
+func (a *DeleteInvite) Do(c *app.Client) error {
+	return app.Call(c, a.Path(), a, nil)
+}
+
+func (a *DeleteInvite) MustDo(c *app.Client) {
+	PanicOn(a.Do(c))
+}
+
+type Restore struct {
+	Me   ID     `json:"me"`
+	Code string `json:"code"`
+}
+
+func (_ *Restore) Path() string {
+	return "/user/restore"
+}
+
+func (a *Restore) Do(c *app.Client) error {
+	return app.Call(c, a.Path(), a, nil)
+}
+
+func (a *Restore) MustDo(c *app.Client) {
+	PanicOn(a.Do(c))
+}
+
 type Logout struct{}
 
 func (_ *Logout) Path() string {
@@ -283,7 +440,57 @@ func (a *Logout) MustDo(c *app.Client) {
 
 type Me struct {
 	User
-	FcmEnabled *bool `json:"fcmEnabled,omitempty"`
+	FcmEnabled   *bool   `json:"fcmEnabled,omitempty"`
+	Locale       *string `json:"locale,omitempty"`
+	Discoverable *bool   `json:"discoverable,omitempty"`
+}
+
+type SetLocale struct {
+	Locale *string `json:"locale"`
+}
+
+func (_ *SetLocale) Path() string {
+	return "/user/setLocale"
+}
+
+func (a *SetLocale) Do(c *app.Client) error {
+	return app.Call(c, a.Path(), a, nil)
+}
+
+func (a *SetLocale) MustDo(c *app.Client) {
+	PanicOn(a.Do(c))
+}
+
+type Export struct{}
+
+func (_ *Export) Path() string {
+	return "/user/export"
+}
+
+func (a *Export) Do(c *app.Client) (*app.DownStream, error) {
+	res := &app.DownStream{}
+	err := app.Call(c, a.Path(), nil, &res)
+	return res, err
+}
+
+func (a *Export) MustDo(c *app.Client) *app.DownStream {
+	res, err := a.Do(c)
+	PanicOn(err)
+	return res
+}
+
+type ExportAsync struct{}
+
+func (_ *ExportAsync) Path() string {
+	return "/user/exportAsync"
+}
+
+func (a *ExportAsync) Do(c *app.Client) error {
+	return app.Call(c, a.Path(), nil, nil)
+}
+
+func (a *ExportAsync) MustDo(c *app.Client) {
+	PanicOn(a.Do(c))
 }
 
 type GetMe struct{}
@@ -304,6 +511,67 @@ func (a *GetMe) MustDo(c *app.Client) *Me {
 	return res
 }
 
+const (
+	ProfileString = "string"
+	ProfileInt    = "int"
+	ProfileFloat  = "float"
+	ProfileBool   = "bool"
+
+	// ProfilePrivate fields are only returned to their owner,
+	// ProfileAuthed fields to any authed user and ProfilePublic
+	// fields to anyone.
+	ProfilePrivate = "private"
+	ProfileAuthed  = "authed"
+	ProfilePublic  = "public"
+)
+
+type ProfileField struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Type is one of ProfileString, ProfileInt, ProfileFloat or ProfileBool
+	Type string `json:"type"`
+	// Visibility is one of ProfilePrivate, ProfileAuthed or ProfilePublic
+	Visibility string `json:"visibility"`
+	// MaxLen only applies to ProfileString fields
+	MaxLen int `json:"maxLen,omitempty"`
+}
+
+type GetProfileFields struct{}
+
+func (_ *GetProfileFields) Path() string {
+	return "/user/getProfileFields"
+}
+
+func (a *GetProfileFields) Do(c *app.Client) ([]*ProfileField, error) {
+	res := []*ProfileField{}
+	err := app.Call(c, a.Path(), nil, &res)
+	return res, err
+}
+
+func (a *GetProfileFields) MustDo(c *app.Client) []*ProfileField {
+	res, err := a.Do(c)
+	PanicOn(err)
+	return res
+}
+
+// SetProfile sets each field in Fields, a nil value clears the field,
+// fields not in Fields are left as they are.
+type SetProfile struct {
+	Fields map[string]interface{} `json:"fields"`
+}
+
+func (_ *SetProfile) Path() string {
+	return "/user/setProfile"
+}
+
+func (a *SetProfile) Do(c *app.Client) error {
+	return app.Call(c, a.Path(), a, nil)
+}
+
+func (a *SetProfile) MustDo(c *app.Client) {
+	PanicOn(a.Do(c))
+}
+
 type Get struct {
 	Users IDs `json:"users"`
 }
@@ -324,7 +592,15 @@ func (a *Get) MustDo(c *app.Client) []*User {
 	return res
 }
 
+type Jin struct {
+	Rev uint64     `json:"rev"`
+	Val *json.Json `json:"val"`
+}
+
+// SetJin replaces the whole jin, if Rev is set it must match the current
+// revision or a 409 is returned, a nil Val clears the jin.
 type SetJin struct {
+	Rev *uint64    `json:"rev,omitempty"`
 	Val *json.Json `json:"val"`
 }
 
@@ -332,12 +608,39 @@ func (_ *SetJin) Path() string {
 	return "/user/setJin"
 }
 
-func (a *SetJin) Do(c *app.Client) error {
-	return app.Call(c, a.Path(), a, nil)
+func (a *SetJin) Do(c *app.Client) (uint64, error) {
+	var res uint64
+	err := app.Call(c, a.Path(), a, &res)
+	return res, err
 }
 
-func (a *SetJin) MustDo(c *app.Client) {
-	PanicOn(a.Do(c))
+func (a *SetJin) MustDo(c *app.Client) uint64 {
+	res, err := a.Do(c)
+	PanicOn(err)
+	return res
+}
+
+// PatchJin applies Patch to the jin as an RFC 7396 json merge patch, if
+// Rev is set it must match the current revision or a 409 is returned.
+type PatchJin struct {
+	Rev   *uint64    `json:"rev,omitempty"`
+	Patch *json.Json `json:"patch"`
+}
+
+func (_ *PatchJin) Path() string {
+	return "/user/patchJin"
+}
+
+func (a *PatchJin) Do(c *app.Client) (*Jin, error) {
+	res := &Jin{}
+	err := app.Call(c, a.Path(), a, &res)
+	return res, err
+}
+
+func (a *PatchJin) MustDo(c *app.Client) *Jin {
+	res, err := a.Do(c)
+	PanicOn(err)
+	return res
 }
 
 type GetJin struct{}
@@ -346,20 +649,25 @@ func (_ *GetJin) Path() string {
 	return "/user/getJin"
 }
 
-func (a *GetJin) Do(c *app.Client) (*json.Json, error) {
-	res := &json.Json{}
+func (a *GetJin) Do(c *app.Client) (*Jin, error) {
+	res := &Jin{}
 	err := app.Call(c, a.Path(), a, &res)
 	return res, err
 }
 
-func (a *GetJin) MustDo(c *app.Client) *json.Json {
+func (a *GetJin) MustDo(c *app.Client) *Jin {
 	res, err := a.Do(c)
 	PanicOn(err)
 	return res
 }
 
+// GetAvatar returns the smallest stored size that is at least Size, or the
+// largest if Size is not given, if Hash is given it must match the users
+// current avatar and the response may be cached indefinitely.
 type GetAvatar struct {
-	User ID `json:"user"`
+	User ID      `json:"user"`
+	Size *int    `json:"size,omitempty"`
+	Hash *string `json:"hash,omitempty"`
 }
 
 func (_ *GetAvatar) Path() string {
@@ -383,6 +691,61 @@ type User struct {
 	Handle    *string `json:"handle,omitempty"`
 	Alias     *string `json:"alias,omitempty"`
 	HasAvatar *bool   `json:"hasAvatar,omitempty"`
+	// AvatarHash identifies the current avatar content, pass it to
+	// GetAvatar to get a response that may be cached indefinitely.
+	AvatarHash *string `json:"avatarHash,omitempty"`
+	// Profile contains the app defined profile fields that are set and
+	// visible to the caller, keyed by ProfileField.Name.
+	Profile map[string]interface{} `json:"profile,omitempty"`
+}
+
+const (
+	SortHandle = "handle"
+	SortAlias  = "alias"
+)
+
+// Search finds discoverable users whose handle or alias starts with
+// Prefix, After is the id of the last user from the previous page.
+type Search struct {
+	Prefix string `json:"prefix"`
+	filter.Base
+}
+
+type SearchRes struct {
+	Set  []*User `json:"set"`
+	More bool    `json:"more"`
+}
+
+func (_ *Search) Path() string {
+	return "/user/search"
+}
+
+func (a *Search) Do(c *app.Client) (*SearchRes, error) {
+	res := &SearchRes{}
+	err := app.Call(c, a.Path(), a, &res)
+	return res, err
+}
+
+func (a *Search) MustDo(c *app.Client) *SearchRes {
+	res, err := a.Do(c)
+	PanicOn(err)
+	return res
+}
+
+type SetDiscoverable struct {
+	Val bool `json:"val"`
+}
+
+func (_ *SetDiscoverable) Path() string {
+	return "/user/setDiscoverable"
+}
+
+func (a *SetDiscoverable) Do(c *app.Client) error {
+	return app.Call(c, a.Path(), a, nil)
+}
+
+func (a *SetDiscoverable) MustDo(c *app.Client) {
+	PanicOn(a.Do(c))
 }
 
 type SetFCMEnabled struct {
@@ -438,3 +801,199 @@ func (a *UnregisterFromFCM) Do(c *app.Client) error {
 func (a *UnregisterFromFCM) MustDo(c *app.Client) {
 	PanicOn(a.Do(c))
 }
+
+type AdminUser struct {
+	Me
+	Email        string     `json:"email"`
+	NewEmail     *string    `json:"newEmail,omitempty"`
+	RegisteredOn time.Time  `json:"registeredOn"`
+	ActivatedOn  *time.Time `json:"activatedOn,omitempty"`
+	IsAdmin      bool       `json:"isAdmin"`
+	DisabledOn   *time.Time `json:"disabledOn,omitempty"`
+	DeletedOn    *time.Time `json:"deletedOn,omitempty"`
+}
+
+type AdminAudit struct {
+	ID        ID        `json:"id"`
+	Admin     ID        `json:"admin"`
+	User      ID        `json:"user"`
+	Action    string    `json:"action"`
+	CreatedOn time.Time `json:"createdOn"`
+}
+
+type EmailChange struct {
+	User       ID         `json:"user"`
+	OldEmail   string     `json:"oldEmail"`
+	NewEmail   string     `json:"newEmail"`
+	ChangedOn  time.Time  `json:"changedOn"`
+	RevertedOn *time.Time `json:"revertedOn,omitempty"`
+}
+
+type AdminSearch struct {
+	Prefix string `json:"prefix"`
+	Limit  uint16 `json:"limit"`
+}
+
+func (_ *AdminSearch) Path() string {
+	return "/user/admin/search"
+}
+
+func (a *AdminSearch) Do(c *app.Client) ([]*AdminUser, error) {
+	res := []*AdminUser{}
+	err := app.Call(c, a.Path(), a, &res)
+	return res, err
+}
+
+func (a *AdminSearch) MustDo(c *app.Client) []*AdminUser {
+	res, err := a.Do(c)
+	PanicOn(err)
+	return res
+}
+
+type AdminGet struct {
+	User ID `json:"user"`
+}
+
+func (_ *AdminGet) Path() string {
+	return "/user/admin/get"
+}
+
+func (a *AdminGet) Do(c *app.Client) (*AdminUser, error) {
+	res := &AdminUser{}
+	err := app.Call(c, a.Path(), a, &res)
+	return res, err
+}
+
+func (a *AdminGet) MustDo(c *app.Client) *AdminUser {
+	res, err := a.Do(c)
+	PanicOn(err)
+	return res
+}
+
+type AdminActivate struct {
+	User ID `json:"user"`
+}
+
+func (_ *AdminActivate) Path() string {
+	return "/user/admin/activate"
+}
+
+func (a *AdminActivate) Do(c *app.Client) error {
+	return app.Call(c, a.Path(), a, nil)
+}
+
+func (a *AdminActivate) MustDo(c *app.Client) {
+	PanicOn(a.Do(c))
+}
+
+type AdminSetDisabled struct {
+	User     ID   `json:"user"`
+	Disabled bool `json:"disabled"`
+}
+
+func (_ *AdminSetDisabled) Path() string {
+	return "/user/admin/setDisabled"
+}
+
+func (a *AdminSetDisabled) Do(c *app.Client) error {
+	return app.Call(c, a.Path(), a, nil)
+}
+
+func (a *AdminSetDisabled) MustDo(c *app.Client) {
+	PanicOn(a.Do(c))
+}
+
+type AdminLogout struct {
+	User ID `json:"user"`
+}
+
+func (_ *AdminLogout) Path() string {
+	return "/user/admin/logout"
+}
+
+func (a *AdminLogout) Do(c *app.Client) error {
+	return app.Call(c, a.Path(), a, nil)
+}
+
+func (a *AdminLogout) MustDo(c *app.Client) {
+	PanicOn(a.Do(c))
+}
+
+type AdminResendEmail struct {
+	User  ID     `json:"user"`
+	Email string `json:"email"`
+}
+
+func (_ *AdminResendEmail) Path() string {
+	return "/user/admin/resendEmail"
+}
+
+func (a *AdminResendEmail) Do(c *app.Client) error {
+	return app.Call(c, a.Path(), a, nil)
+}
+
+func (a *AdminResendEmail) MustDo(c *app.Client) {
+	PanicOn(a.Do(c))
+}
+
+type AdminImpersonate struct {
+	User ID `json:"user"`
+}
+
+func (_ *AdminImpersonate) Path() string {
+	return "/user/admin/impersonate"
+}
+
+func (a *AdminImpersonate) Do(c *app.Client) (*Me, error) {
+	res := &Me{}
+	err := app.Call(c, a.Path(), a, &res)
+	return res, err
+}
+
+func (a *AdminImpersonate) MustDo(c *app.Client) *Me {
+	res, err := a.Do(c)
+	PanicOn(err)
+	return res
+}
+
+type AdminGetAudit struct {
+	User  *ID    `json:"user,omitempty"`
+	Limit uint16 `json:"limit"`
+}
+
+func (_ *AdminGetAudit) Path() string {
+	return "/user/admin/getAudit"
+}
+
+func (a *AdminGetAudit) Do(c *app.Client) ([]*AdminAudit, error) {
+	res := []*AdminAudit{}
+	err := app.Call(c, a.Path(), a, &res)
+	return res, err
+}
+
+func (a *AdminGetAudit) MustDo(c *app.Client) []*AdminAudit {
+	res, err := a.Do(c)
+	PanicOn(err)
+	return res
+}
+
+type AdminGetEmailHistory struct {
+	User  ID     `json:"user"`
+	Limit uint16 `json:"limit"`
+}
+
+func (_ *AdminGetEmailHistory) Path() string {
+	return "/user/admin/getEmailHistory"
+}
+
+func (a *AdminGetEmailHistory) Do(c *app.Client) ([]*EmailChange, error) {
+	res := []*EmailChange{}
+	err := app.Call(c, a.Path(), a, &res)
+	return res, err
+}
+
+func (a *AdminGetEmailHistory) MustDo(c *app.Client) []*EmailChange {
+	res, err := a.Do(c)
+	PanicOn(err)
+	return res
+}
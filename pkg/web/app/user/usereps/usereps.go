@@ -4,16 +4,25 @@ package usereps
 //go:generate qtc -file=usereps.sql -skipLineComments
 
 import (
+	"archive/zip"
 	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
 	"io/ioutil"
 	"math"
 	"net/http"
+	"net/url"
+	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"image"
-	_ "image/gif"
+	"image/draw"
+	"image/gif"
 	_ "image/jpeg"
 	"image/png"
 
@@ -22,35 +31,203 @@ import (
 	"github.com/0xor1/tlbx/pkg/crypt"
 	"github.com/0xor1/tlbx/pkg/json"
 	"github.com/0xor1/tlbx/pkg/ptr"
+	"github.com/0xor1/tlbx/pkg/pwdpolicy"
 	"github.com/0xor1/tlbx/pkg/sqlh"
 	"github.com/0xor1/tlbx/pkg/store"
 	"github.com/0xor1/tlbx/pkg/web/app"
+	"github.com/0xor1/tlbx/pkg/web/app/filter"
+	"github.com/0xor1/tlbx/pkg/web/app/pow/poweps"
+	"github.com/0xor1/tlbx/pkg/web/app/ratelimit"
 	"github.com/0xor1/tlbx/pkg/web/app/service"
 	"github.com/0xor1/tlbx/pkg/web/app/service/sql"
 	"github.com/0xor1/tlbx/pkg/web/app/session/me"
 	"github.com/0xor1/tlbx/pkg/web/app/user"
+	"github.com/0xor1/tlbx/pkg/web/app/user/usermail"
 	"github.com/0xor1/tlbx/pkg/web/app/validate"
+	"github.com/0xor1/tlbx/pkg/webp"
 	"github.com/disintegration/imaging"
 	"github.com/go-sql-driver/mysql"
+	"github.com/gomodule/redigo/redis"
+	_ "golang.org/x/image/webp"
 )
 
 const (
 	AvatarBucket = "avatars"
 	AvatarPrefix = ""
+	ExportBucket = "exports"
+	ExportPrefix = ""
+	purgeKey     = "user_purge"
+
+	RegistrationOpen       = "open"
+	RegistrationInviteOnly = "inviteOnly"
+	RegistrationClosed     = "closed"
 )
 
 var NopOnSetSocials = func(_ app.Tlbx, _ *user.User) {}
 
+type Config struct {
+	// lockout protects login and login link endpoints from brute force
+	// attempts, failures are counted per account and per ip in the cache
+	// redis, once a counter reaches its max fails the account/ip is locked
+	// for LockoutBase, doubling with each subsequent failure up to LockoutMax.
+	LockoutAccountMaxFails int
+	LockoutIPMaxFails      int
+	LockoutWindow          time.Duration
+	LockoutBase            time.Duration
+	LockoutMax             time.Duration
+	// if empty no unlock email is sent when an account is locked
+	UnlockFmtLink string
+	// new pwds are hashed with PwdHasher, existing pwds hashed by
+	// OldPwdHashers are rehashed with PwdHasher on successful login
+	PwdHasher     crypt.PwdHasher
+	OldPwdHashers []crypt.PwdHasher
+	// templates for every email sent, to customise use
+	// usermail.Default().Override(yourSet) and preview the result with
+	// its PreviewCmd
+	Emails usermail.Set
+	// OnExport lets apps add their own data to a users export zip
+	OnExport func(tlbx app.Tlbx, me ID, zw *zip.Writer)
+	// exports larger than ExportMaxSyncSize fall back to ExportAsync,
+	// which stores them in ExportBucket and emails a link
+	// that is valid for ExportLinkValidFor, users may only request an
+	// async export once every ExportAsyncMinInterval, async exports must
+	// be uploaded within ExportUploadTimeout
+	ExportMaxSyncSize      int64
+	ExportLinkValidFor     time.Duration
+	ExportAsyncMinInterval time.Duration
+	ExportUploadTimeout    time.Duration
+	// deleted accounts are logged out everywhere and hidden for
+	// DeleteGracePeriod, during which they can be restored via an emailed
+	// RestoreFmtLink, after that they are purged and onDelete is called,
+	// purges are run by Tickers at most once every DeletePurgeInterval
+	// across all app instances. If DeleteGracePeriod is 0 accounts
+	// are deleted immediately.
+	DeleteGracePeriod   time.Duration
+	DeletePurgeInterval time.Duration
+	RestoreFmtLink      string
+	// EnableAdmin adds the /user/admin/* endpoints, they may only be
+	// called by users with users.isAdmin set, which can only be done in
+	// the db, every action is recorded in the adminAudit table.
+	EnableAdmin bool
+	// RegistrationMode is one of RegistrationOpen, RegistrationInviteOnly
+	// or RegistrationClosed, invites may be created by admins or anyone
+	// CanInvite returns true for and are valid for at most
+	// InviteMaxValidFor, invites with an email are sent to it using
+	// InviteFmtLink which is passed the code and the url escaped email.
+	RegistrationMode  string
+	CanInvite         func(tlbx app.Tlbx, me ID) bool
+	InviteMaxValidFor time.Duration
+	InviteFmtLink     string
+	// RequirePow makes register, resendActivateLink, sendLoginLinkEmail
+	// and resetPwd require a solved pow.Challenge, as they send emails to
+	// arbitrary addresses, the /pow/getChallenge endpoint is added and
+	// configured with PowConfigs.
+	RequirePow bool
+	PowConfigs []func(*poweps.Config)
+	// PwdPolicy is checked on register, setPwd and confirmResetPwd, the
+	// default rejects pwds containing the users email or handle.
+	PwdPolicy *pwdpolicy.Policy
+	// RevertChangeEmailFmtLink is passed the user id and a revert code and
+	// sent to the old email when a change of email is confirmed, it is
+	// valid for RevertChangeEmailValidFor. Email changes are always kept
+	// in the emailChanges table.
+	RevertChangeEmailFmtLink  string
+	RevertChangeEmailValidFor time.Duration
+	// SearchPerMinute limits how many user searches each user may make,
+	// it is stricter than the general rate limit to slow enumeration.
+	SearchPerMinute int
+	// AvatarSizes are the square dimensions avatars are stored at in
+	// ascending order, AvatarEncoder encodes each, e.g. AvatarPNG or
+	// AvatarWebP. Avatar keys contain a hash of the uploaded content so
+	// they can be cached indefinitely. The sizes and encoding are stored
+	// with each avatar so changing them doesn't break existing avatars.
+	AvatarSizes   []int
+	AvatarEncoder AvatarEncoder
+	// ProfileFields are app defined typed fields stored in the
+	// profileFields table, they are returned in user.User.Profile by
+	// GetMe and Get according to their Visibility.
+	ProfileFields []*ProfileField
+}
+
+type ProfileField struct {
+	user.ProfileField
+	// Example is used in the api docs
+	Example interface{}
+	// Validate is optional and called after the value has been checked
+	// against Type and MaxLen, it should panic with an app error if the
+	// value is invalid.
+	Validate func(tlbx app.Tlbx, val interface{})
+}
+
+// Tickers returns the background jobs for the endpoints returned by New,
+// given the same onDelete and configs, to be set as app.Config.Tickers.
+func Tickers(onDelete func(app.Tlbx, ID), configs ...func(*Config)) []*app.Ticker {
+	c := config(configs...)
+	if c.DeleteGracePeriod <= 0 || c.DeletePurgeInterval <= 0 {
+		return nil
+	}
+	return []*app.Ticker{
+		{
+			Name:  "user_purge",
+			Every: c.DeletePurgeInterval,
+			Fn: func(tlbx app.Tlbx) {
+				purge(tlbx, c, onDelete)
+			},
+		},
+	}
+}
+
+// IsDisabled returns a me.Config.IsDisabled which reads users.disabledOn
+// from user directly as me.Mware runs before service.Mware.
+func IsDisabled(user sqlh.ReplicaSet) func(app.Tlbx, ID) bool {
+	return func(tlbx app.Tlbx, me ID) bool {
+		var disabledOn *time.Time
+		err := user.Primary().QueryRow(qryUserDisabledOn(), me).Scan(&disabledOn)
+		if sqlh.IsNoRows(err) {
+			return false
+		}
+		PanicOn(err)
+		return disabledOn != nil
+	}
+}
+
+// ImpersonationAuditMware records every api request made by an admin
+// impersonating a user in the adminAudit table, it must come after
+// service.Mware in app.Config.TlbxSetup.
+func ImpersonationAuditMware(tlbx app.Tlbx) {
+	if !strings.HasPrefix(StrLower(tlbx.Req().URL.Path), app.ApiPathPrefixSegment) ||
+		!me.AuthedExists(tlbx) {
+		return
+	}
+	ses := me.Get(tlbx)
+	admin := ses.Impersonator()
+	if admin == nil {
+		return
+	}
+	tx := service.Get(tlbx).User().BeginWrite()
+	defer tx.Rollback()
+	adminAudit(tlbx, tx, *admin, ses.ID(), "impersonated:"+tlbx.Req().URL.Path)
+	tx.Commit()
+}
+
 func New(
 	fromEmail string,
 	activateFmtLink,
 	loginLinkFmtLink,
-	confirmChangeEmailFmtLink string,
+	confirmChangeEmailFmtLink,
+	resetPwdFmtLink string,
 	onDelete func(app.Tlbx, ID),
 	onSetSocials func(app.Tlbx, *user.User),
 	validateFcmTopic func(app.Tlbx, IDs) (sql.Tx, error),
 	enableJin bool,
+	configs ...func(*Config),
 ) []*app.Endpoint {
+	c := config(configs...)
+	PanicIf(c.RegistrationMode != RegistrationOpen &&
+		c.RegistrationMode != RegistrationInviteOnly &&
+		c.RegistrationMode != RegistrationClosed,
+		"invalid RegistrationMode: %q", c.RegistrationMode)
+	mustBeValidProfileFields(c.ProfileFields)
 	enableSocials := onSetSocials != nil
 	enableFCM := validateFcmTopic != nil
 	eps := []*app.Endpoint{
@@ -84,8 +261,10 @@ func New(
 			},
 			Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
 				app.BadReqIf(me.AuthedExists(tlbx), "already logged in")
-				tlbx.Log().Info("yolo")
 				args := a.(*user.Register)
+				if c.RequirePow {
+					poweps.MustVerify(tlbx, args.Pow)
+				}
 				args.Email = StrTrimWS(args.Email)
 				validate.Str("email", args.Email, 0, emailMaxLen, emailRegex)
 				if !enableSocials {
@@ -104,6 +283,9 @@ func New(
 					args.Alias = ptr.String(StrTrimWS(*args.Alias))
 					validate.Str("alias", *args.Alias, 0, aliasMaxLen)
 				}
+				app.ReturnIf(c.RegistrationMode == RegistrationClosed, http.StatusForbidden, "registration is closed")
+				app.BadReqIf(c.RegistrationMode == RegistrationInviteOnly && args.InviteCode == nil, "registration requires an invite code")
+				checkPwdPolicy(c, args.Pwd, args.Email, args.Handle)
 				activateCode := crypt.UrlSafeString(250)
 				id := me.Get(tlbx).ID()
 				srv := service.Get(tlbx)
@@ -111,13 +293,19 @@ func New(
 				if enableSocials {
 					hasAvatar = ptr.Bool(false)
 				}
-				var fcmEnabled *bool
+				var fcmEnabled, discoverable *bool
+				if enableSocials {
+					discoverable = ptr.Bool(true)
+				}
 				if enableFCM {
 					fcmEnabled = ptr.Bool(false)
 				}
 				usrtx := srv.User().BeginWrite()
 				defer usrtx.Rollback()
-				_, err := usrtx.Exec(qryUserInsert(), id, args.Email, args.Handle, args.Alias, hasAvatar, fcmEnabled, Now(), time.Time{}, activateCode)
+				if args.InviteCode != nil {
+					useInvite(usrtx, *args.InviteCode, args.Email)
+				}
+				_, err := usrtx.Exec(qryUserInsert(), id, args.Email, args.Handle, args.Alias, hasAvatar, fcmEnabled, discoverable, Now(), time.Time{}, activateCode)
 				if err != nil {
 					mySqlErr, ok := err.(*mysql.MySQLError)
 					app.BadReqIf(ok && mySqlErr.Number == 1062, "email or handle already registered")
@@ -125,8 +313,8 @@ func New(
 				}
 				pwdtx := srv.Pwd().BeginWrite()
 				defer pwdtx.Rollback()
-				setPwd(tlbx, pwdtx, id, args.Pwd)
-				sendActivateEmail(srv, args.Email, fromEmail, Strf(activateFmtLink, id, activateCode), args.Handle)
+				setPwd(tlbx, c, pwdtx, id, args.Pwd)
+				sendEmail(tlbx, c, usermail.Activate, args.Email, fromEmail, Strf(activateFmtLink, id, activateCode), args.Handle, nil, true)
 				usrtx.Commit()
 				pwdtx.Commit()
 				return nil
@@ -151,6 +339,9 @@ func New(
 			},
 			Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
 				args := a.(*user.ResendActivateLink)
+				if c.RequirePow {
+					poweps.MustVerify(tlbx, args.Pow)
+				}
 				srv := service.Get(tlbx)
 				tx := srv.User().BeginRead()
 				defer tx.Rollback()
@@ -159,7 +350,7 @@ func New(
 				if fullUser == nil || fullUser.ActivateCode == nil {
 					return nil
 				}
-				sendActivateEmail(srv, args.Email, fromEmail, Strf(activateFmtLink, fullUser.ID, *fullUser.ActivateCode), fullUser.Handle)
+				sendEmail(tlbx, c, usermail.Activate, args.Email, fromEmail, Strf(activateFmtLink, fullUser.ID, *fullUser.ActivateCode), fullUser.Handle, fullUser.Locale, false)
 				return nil
 			},
 		},
@@ -230,7 +421,7 @@ func New(
 				fullUser.ChangeEmailCode = &changeEmailCode
 				updateUser(tx, fullUser)
 				tx.Commit()
-				sendConfirmChangeEmailEmail(srv, args.NewEmail, fromEmail, Strf(confirmChangeEmailFmtLink, me, changeEmailCode))
+				sendEmail(tlbx, c, usermail.ConfirmChangeEmail, args.NewEmail, fromEmail, Strf(confirmChangeEmailFmtLink, me, changeEmailCode), fullUser.Handle, fullUser.Locale, true)
 				return nil
 			},
 		},
@@ -256,7 +447,7 @@ func New(
 				defer tx.Rollback()
 				fullUser := getUser(tx, nil, &me)
 				tx.Commit()
-				sendConfirmChangeEmailEmail(srv, *fullUser.NewEmail, fromEmail, Strf(confirmChangeEmailFmtLink, me, *fullUser.ChangeEmailCode))
+				sendEmail(tlbx, c, usermail.ConfirmChangeEmail, *fullUser.NewEmail, fromEmail, Strf(confirmChangeEmailFmtLink, me, *fullUser.ChangeEmailCode), fullUser.Handle, fullUser.Locale, true)
 				return nil
 			},
 		},
@@ -284,12 +475,85 @@ func New(
 				tx := srv.User().BeginWrite()
 				defer tx.Rollback()
 				user := getUser(tx, nil, &args.Me)
-				app.BadReqIf(*user.ChangeEmailCode != args.Code, "")
+				app.BadReqIf(user == nil || user.ChangeEmailCode == nil || *user.ChangeEmailCode != args.Code, "")
+				oldEmail := user.Email
+				var revertCode *string
+				if c.RevertChangeEmailFmtLink != "" {
+					revertCode = ptr.String(crypt.UrlSafeString(250))
+				}
 				user.ChangeEmailCode = nil
 				user.Email = *user.NewEmail
 				user.NewEmail = nil
 				updateUser(tx, user)
+				tx.MustExec(qryEmailChangeInsert(), user.ID, tlbx.Start(), oldEmail, user.Email, revertCode)
+				tx.Commit()
+				if revertCode != nil {
+					sendEmail(tlbx, c, usermail.EmailChanged, oldEmail, fromEmail, Strf(c.RevertChangeEmailFmtLink, user.ID, *revertCode), user.Handle, user.Locale, false)
+				}
+				return nil
+			},
+		},
+		{
+			Description:  "revert a change of email, and any after it, sent to the old email, it restores the old email, logs out all sessions and requires a pwd reset",
+			Path:         (&user.RevertChangeEmail{}).Path(),
+			Timeout:      1000,
+			MaxBodyBytes: app.KB,
+			IsPrivate:    false,
+			GetDefaultArgs: func() interface{} {
+				return &user.RevertChangeEmail{}
+			},
+			GetExampleArgs: func() interface{} {
+				return &user.RevertChangeEmail{
+					Me:   app.ExampleID(),
+					Code: "123abc",
+				}
+			},
+			GetExampleResponse: func() interface{} {
+				return nil
+			},
+			Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
+				args := a.(*user.RevertChangeEmail)
+				srv := service.Get(tlbx)
+				tx := srv.User().BeginWrite()
+				defer tx.Rollback()
+				// any change still in its revert window can be reverted, not
+				// just the latest, else whoever changed the email could change
+				// it again to make the first revert link useless
+				changes := []*emailChange{}
+				tx.MustGetN(&changes, qryEmailChangesGetRevertable(), args.Me, Now().Add(-c.RevertChangeEmailValidFor))
+				var change *emailChange
+				for _, ch := range changes {
+					if subtle.ConstantTimeCompare([]byte(*ch.RevertCode), []byte(args.Code)) == 1 {
+						change = ch
+						break
+					}
+				}
+				app.BadReqIf(change == nil, "revert change email code invalid")
+				user := getUser(tx, nil, &args.Me)
+				now := tlbx.Start()
+				user.Email = change.OldEmail
+				user.NewEmail = nil
+				user.ChangeEmailCode = nil
+				user.LastPwdResetOn = &now
+				user.ResetPwdCode = ptr.String(crypt.UrlSafeString(250))
+				err := tryUpdateUser(tx, user)
+				if err != nil {
+					mySqlErr, ok := err.(*mysql.MySQLError)
+					app.BadReqIf(ok && mySqlErr.Number == 1062, "old email already registered")
+					PanicOn(err)
+				}
+				// later changes are reverted with it
+				tx.MustExec(qryEmailChangeRevert(), now, user.ID, change.ChangedOn)
+				// the current pwd may be known to whoever changed the
+				// email so replace it with one nobody knows
+				pwdtx := srv.Pwd().BeginWrite()
+				defer pwdtx.Rollback()
+				hash := c.PwdHasher.Hash(crypt.Bytes(pwdMaxLen))
+				pwdtx.MustExec(qryPwdUpdate(), user.ID, hash.Alg, hash.Salt, hash.Pwd, hash.N, hash.R, hash.P)
 				tx.Commit()
+				pwdtx.Commit()
+				me.RevokeAll(tlbx, user.ID)
+				sendEmail(tlbx, c, usermail.ResetPwd, user.Email, fromEmail, Strf(resetPwdFmtLink, user.ID, *user.ResetPwdCode), user.Handle, user.Locale, true)
 				return nil
 			},
 		},
@@ -312,26 +576,69 @@ func New(
 			},
 			Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
 				args := a.(*user.ResetPwd)
+				if c.RequirePow {
+					poweps.MustVerify(tlbx, args.Pow)
+				}
 				srv := service.Get(tlbx)
 				tx := srv.User().BeginWrite()
 				defer tx.Rollback()
 				user := getUser(tx, &args.Email, nil)
-				if user != nil {
+				// disabled and deleted accounts are silently ignored the
+				// same as unknown emails so accounts can't be enumerated
+				if user != nil && user.DisabledOn == nil && user.DeletedOn == nil {
 					now := Now()
 					if user.LastPwdResetOn != nil {
 						mustWaitDur := (10 * time.Minute) - Now().Sub(*user.LastPwdResetOn)
 						app.BadReqIf(mustWaitDur > 0, "must wait %d seconds before reseting pwd again", int64(math.Ceil(mustWaitDur.Seconds())))
 					}
 					user.LastPwdResetOn = &now
+					user.ResetPwdCode = ptr.String(crypt.UrlSafeString(250))
 					updateUser(tx, user)
-					pwdtx := srv.Pwd().BeginWrite()
-					defer pwdtx.Rollback()
-					newPwd := `$aA1` + crypt.UrlSafeString(12)
-					setPwd(tlbx, pwdtx, user.ID, newPwd)
-					sendResetPwdEmail(srv, args.Email, fromEmail, newPwd)
-					pwdtx.Commit()
+					sendEmail(tlbx, c, usermail.ResetPwd, args.Email, fromEmail, Strf(resetPwdFmtLink, user.ID, *user.ResetPwdCode), user.Handle, user.Locale, false)
+				}
+				tx.Commit()
+				return nil
+			},
+		},
+		{
+			Description:  "confirm reset password, logs out all existing sessions",
+			Path:         (&user.ConfirmResetPwd{}).Path(),
+			Timeout:      1000,
+			MaxBodyBytes: app.KB,
+			IsPrivate:    false,
+			GetDefaultArgs: func() interface{} {
+				return &user.ConfirmResetPwd{}
+			},
+			GetExampleArgs: func() interface{} {
+				return &user.ConfirmResetPwd{
+					Me:     app.ExampleID(),
+					Code:   "123abc",
+					NewPwd: "N3w-J03-8l0-Gg5-Pwd",
 				}
+			},
+			GetExampleResponse: func() interface{} {
+				return nil
+			},
+			Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
+				args := a.(*user.ConfirmResetPwd)
+				srv := service.Get(tlbx)
+				tx := srv.User().BeginWrite()
+				defer tx.Rollback()
+				user := getUser(tx, nil, &args.Me)
+				app.BadReqIf(user == nil ||
+					user.ResetPwdCode == nil ||
+					user.LastPwdResetOn == nil ||
+					user.LastPwdResetOn.Before(Now().Add(-resetPwdCodeValidFor)) ||
+					*user.ResetPwdCode != args.Code, "reset pwd code invalid (only valid for 1 hour from time of creation)")
+				checkPwdPolicy(c, args.NewPwd, user.Email, user.Handle)
+				user.ResetPwdCode = nil
+				updateUser(tx, user)
+				pwdtx := srv.Pwd().BeginWrite()
+				defer pwdtx.Rollback()
+				setPwd(tlbx, c, pwdtx, user.ID, args.NewPwd)
+				me.RevokeAll(tlbx, user.ID)
 				tx.Commit()
+				pwdtx.Commit()
 				return nil
 			},
 		},
@@ -357,11 +664,16 @@ func New(
 				args := a.(*user.SetPwd)
 				srv := service.Get(tlbx)
 				me := me.AuthedGet(tlbx)
+				tx := srv.User().BeginRead()
+				defer tx.Rollback()
+				user := getUser(tx, nil, &me)
+				tx.Commit()
 				pwdtx := srv.Pwd().BeginWrite()
 				defer pwdtx.Rollback()
 				pwd := getPwd(pwdtx, me)
-				app.BadReqIf(!bytes.Equal(crypt.ScryptKey([]byte(args.OldPwd), pwd.Salt, pwd.N, pwd.R, pwd.P, scryptKeyLen), pwd.Pwd), "current pwd does not match")
-				setPwd(tlbx, pwdtx, me, args.NewPwd)
+				app.BadReqIf(!pwdMatches(c, pwd, args.OldPwd), "current pwd does not match")
+				checkPwdPolicy(c, args.NewPwd, user.Email, user.Handle)
+				setPwd(tlbx, c, pwdtx, me, args.NewPwd)
 				pwdtx.Commit()
 				return nil
 			},
@@ -390,18 +702,32 @@ func New(
 				pwdtx := srv.Pwd().BeginWrite()
 				defer pwdtx.Rollback()
 				pwd := getPwd(pwdtx, m)
-				app.BadReqIf(!bytes.Equal(pwd.Pwd, crypt.ScryptKey([]byte(args.Pwd), pwd.Salt, pwd.N, pwd.R, pwd.P, scryptKeyLen)), "incorrect pwd")
+				app.BadReqIf(!pwdMatches(c, pwd, args.Pwd), "incorrect pwd")
+				pwdtx.Commit()
+				if c.DeleteGracePeriod <= 0 {
+					deleteUser(tlbx, c, onDelete, m)
+					me.Del(tlbx)
+					return nil
+				}
 				tx := srv.User().BeginWrite()
 				defer tx.Rollback()
-				// jin and fcm tokens tables are cleared by foreign key cascade
-				tx.MustExec(qryUserDelete(), m)
-				pwdtx.MustExec(qryPwdDelete(), m)
-				if onDelete != nil {
-					onDelete(tlbx, m)
-				}
-				me.Del(tlbx)
+				u := getUser(tx, nil, &m)
+				u.DeletedOn = ptr.Time(NowMilli())
+				u.RestoreCode = ptr.String(crypt.UrlSafeString(restoreCodeLen))
+				updateUser(tx, u)
+				tokens := make([]string, 0, 5)
+				tx.MustGetN(&tokens, qryDistinctFCMTokens(), m)
+				tx.MustExec(qryFCMTokensDelete(), m)
 				tx.Commit()
-				pwdtx.Commit()
+				if onSetSocials != nil {
+					// hide the users handle, alias and avatar while pending deletion
+					onSetSocials(tlbx, &user.User{ID: m})
+				}
+				srv.FCM().RawAsyncSend("logout", tokens, map[string]string{}, 0)
+				me.RevokeAll(tlbx, m)
+				if c.RestoreFmtLink != "" {
+					sendEmail(tlbx, c, usermail.Restore, u.Email, fromEmail, Strf(c.RestoreFmtLink, m, *u.RestoreCode), u.Handle, u.Locale, true)
+				}
 				return nil
 			},
 		},
@@ -434,27 +760,38 @@ func New(
 				return ex
 			},
 			Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
-				emailOrPwdMismatch := func(condition bool) {
-					app.ReturnIf(condition, http.StatusNotFound, "email and/or pwd are not valid")
-				}
 				args := a.(*user.Login)
 				validate.Str("email", args.Email, 0, emailMaxLen, emailRegex)
 				validate.Str("pwd", args.Pwd, pwdMinLen, pwdMaxLen, pwdRegexs...)
+				lockoutMustNotBeLocked(tlbx, lockoutIPKey(tlbx))
 				srv := service.Get(tlbx)
 				tx := srv.User().BeginRead()
 				defer tx.Rollback()
 				user := getUser(tx, &args.Email, nil)
-				emailOrPwdMismatch(user == nil)
+				if user == nil {
+					lockoutFail(tlbx, c, srv, fromEmail, nil)
+					app.ReturnIf(true, http.StatusNotFound, "email and/or pwd are not valid")
+				}
+				// registered emails aren't secret, register and send login
+				// link email report unknown emails, so locked accounts get
+				// the same StatusLocked as everywhere else so clients can
+				// explain why login failed
+				lockoutMustNotBeLocked(tlbx, lockoutAccKey(user.ID))
 				pwdtx := srv.Pwd().BeginWrite()
 				defer pwdtx.Rollback()
 				pwd := getPwd(pwdtx, user.ID)
-				emailOrPwdMismatch(!bytes.Equal(pwd.Pwd, crypt.ScryptKey([]byte(args.Pwd), pwd.Salt, pwd.N, pwd.R, pwd.P, scryptKeyLen)))
-				// if encryption params have changed re encrypt on successful login
-				if len(pwd.Salt) != scryptSaltLen || len(pwd.Pwd) != scryptKeyLen || pwd.N != scryptN || pwd.R != scryptR || pwd.P != scryptP {
-					setPwd(tlbx, pwdtx, user.ID, args.Pwd)
+				if !pwdMatches(c, pwd, args.Pwd) {
+					lockoutFail(tlbx, c, srv, fromEmail, user)
+					app.ReturnIf(true, http.StatusNotFound, "email and/or pwd are not valid")
+				}
+				mustBeAbleToLogin(user)
+				// if hashing alg or params have changed re hash on successful login
+				if c.PwdHasher.NeedsRehash(&pwd.PwdHash) {
+					setPwd(tlbx, c, pwdtx, user.ID, args.Pwd)
 				}
 				tx.Commit()
 				pwdtx.Commit()
+				lockoutClear(tlbx, user.ID, true)
 				me.AuthedSet(tlbx, user.ID)
 				return &user.Me
 			},
@@ -478,17 +815,27 @@ func New(
 			},
 			Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
 				args := a.(*user.SendLoginLinkEmail)
+				if c.RequirePow {
+					poweps.MustVerify(tlbx, args.Pow)
+				}
 				validate.Str("email", args.Email, 0, emailMaxLen, emailRegex)
+				lockoutMustNotBeLocked(tlbx, lockoutIPKey(tlbx))
 				srv := service.Get(tlbx)
 				tx := srv.User().BeginWrite()
 				defer tx.Rollback()
 				user := getUser(tx, &args.Email, nil)
-				app.BadReqIf(user == nil, "unknown email")
+				if user == nil {
+					// probing for registered emails counts against the ip
+					lockoutFail(tlbx, c, srv, fromEmail, nil)
+					app.BadReqIf(true, "unknown email")
+				}
+				lockoutMustNotBeLocked(tlbx, lockoutAccKey(user.ID))
+				mustBeAbleToLogin(user)
 				app.BadReqIf(user.LoginLinkCodeCreatedOn != nil && user.LoginLinkCodeCreatedOn.After(Now().Add(-8*time.Minute)), "An unused login link code still exists")
 				user.LoginLinkCodeCreatedOn = ptr.Time(NowMilli())
 				user.LoginLinkCode = ptr.String(crypt.UrlSafeString(250))
 				updateUser(tx, user)
-				sendLoginLinkEmail(srv, user.Email, fromEmail, Strf(loginLinkFmtLink, user.ID, *user.LoginLinkCode), user.Handle)
+				sendEmail(tlbx, c, usermail.LoginLink, user.Email, fromEmail, Strf(loginLinkFmtLink, user.ID, *user.LoginLinkCode), user.Handle, user.Locale, false)
 				tx.Commit()
 				return nil
 			},
@@ -523,22 +870,189 @@ func New(
 			},
 			Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
 				args := a.(*user.LoginLinkLogin)
+				lockoutMustNotBeLocked(tlbx, lockoutIPKey(tlbx))
 				srv := service.Get(tlbx)
 				tx := srv.User().BeginWrite()
 				defer tx.Rollback()
 				user := getUser(tx, nil, &args.Me)
 				app.BadReqIf(user == nil, "unknown user")
-				app.BadReqIf(user.LoginLinkCodeCreatedOn == nil ||
+				lockoutMustNotBeLocked(tlbx, lockoutAccKey(user.ID))
+				if user.LoginLinkCodeCreatedOn == nil ||
 					user.LoginLinkCodeCreatedOn.Before(Now().Add(-10*time.Minute)) ||
-					*user.LoginLinkCode != args.Code, "login code invalid (only valid for 10 minutes from time of creation)")
+					subtle.ConstantTimeCompare([]byte(*user.LoginLinkCode), []byte(args.Code)) != 1 {
+					lockoutFail(tlbx, c, srv, fromEmail, user)
+					app.BadReqIf(true, "login code invalid (only valid for 10 minutes from time of creation)")
+				}
+				mustBeAbleToLogin(user)
 				user.LoginLinkCodeCreatedOn = nil
 				user.LoginLinkCode = nil
 				updateUser(tx, user)
 				tx.Commit()
+				lockoutClear(tlbx, user.ID, true)
 				me.AuthedSet(tlbx, user.ID)
 				return &user.Me
 			},
 		},
+		{
+			Description:  "unlock an account locked by too many failed login attempts",
+			Path:         (&user.Unlock{}).Path(),
+			Timeout:      500,
+			MaxBodyBytes: app.KB,
+			IsPrivate:    false,
+			GetDefaultArgs: func() interface{} {
+				return &user.Unlock{}
+			},
+			GetExampleArgs: func() interface{} {
+				return &user.Unlock{
+					Me:   app.ExampleID(),
+					Code: "123abc",
+				}
+			},
+			GetExampleResponse: func() interface{} {
+				return nil
+			},
+			Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
+				args := a.(*user.Unlock)
+				cnn := service.Get(tlbx).Cache().Get()
+				defer cnn.Close()
+				code, err := redis.String(cnn.Do("GET", lockoutUnlockKey(args.Me)))
+				if err != nil && err != redis.ErrNil {
+					PanicOn(err)
+				}
+				app.BadReqIf(code == "" || subtle.ConstantTimeCompare([]byte(code), []byte(args.Code)) != 1, "unlock code invalid")
+				lockoutClear(tlbx, args.Me, false)
+				return nil
+			},
+		},
+		{
+			Description:  "restore an account that is pending deletion (requires email link)",
+			Path:         (&user.Restore{}).Path(),
+			Timeout:      500,
+			MaxBodyBytes: app.KB,
+			IsPrivate:    false,
+			GetDefaultArgs: func() interface{} {
+				return &user.Restore{}
+			},
+			GetExampleArgs: func() interface{} {
+				return &user.Restore{
+					Me:   app.ExampleID(),
+					Code: "123abc",
+				}
+			},
+			GetExampleResponse: func() interface{} {
+				return nil
+			},
+			Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
+				args := a.(*user.Restore)
+				tx := service.Get(tlbx).User().BeginWrite()
+				defer tx.Rollback()
+				user := getUser(tx, nil, &args.Me)
+				app.BadReqIf(user == nil || user.DeletedOn == nil || user.RestoreCode == nil || *user.RestoreCode != args.Code, "restore code invalid")
+				user.DeletedOn = nil
+				user.RestoreCode = nil
+				updateUser(tx, user)
+				tx.Commit()
+				if onSetSocials != nil {
+					onSetSocials(tlbx, &user.User)
+				}
+				return nil
+			},
+		},
+		{
+			Description:  "create an invite code for registration, if email is given the invite is sent to it and can only be used by it",
+			Path:         (&user.CreateInvite{}).Path(),
+			Timeout:      1000,
+			MaxBodyBytes: app.KB,
+			IsPrivate:    false,
+			GetDefaultArgs: func() interface{} {
+				return &user.CreateInvite{
+					MaxUses:   1,
+					ExpiresOn: Now().Add(7 * 24 * time.Hour),
+				}
+			},
+			GetExampleArgs: func() interface{} {
+				return &user.CreateInvite{
+					Email:     ptr.String("joe@bloggs.example"),
+					MaxUses:   1,
+					ExpiresOn: app.ExampleTime(),
+				}
+			},
+			GetExampleResponse: func() interface{} {
+				return exampleInvite()
+			},
+			Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
+				args := a.(*user.CreateInvite)
+				me := mustBeAbleToInvite(tlbx, c)
+				if args.Email != nil {
+					args.Email = ptr.String(StrTrimWS(*args.Email))
+					validate.Str("email", *args.Email, 0, emailMaxLen, emailRegex)
+					app.BadReqIf(args.MaxUses != 1, "invites sent to an email must have maxUses 1")
+				}
+				app.BadReqIf(args.MaxUses < 1 || args.MaxUses > inviteMaxUses, "maxUses must be between 1 and %d", inviteMaxUses)
+				app.BadReqIf(!args.ExpiresOn.After(Now()) || args.ExpiresOn.After(Now().Add(c.InviteMaxValidFor)), "expiresOn must be in the future and within %s", c.InviteMaxValidFor)
+				inv := &user.Invite{
+					Code:      crypt.UrlSafeString(inviteCodeLen),
+					CreatedBy: me,
+					CreatedOn: tlbx.Start(),
+					Email:     args.Email,
+					MaxUses:   args.MaxUses,
+					Uses:      0,
+					ExpiresOn: args.ExpiresOn,
+				}
+				srv := service.Get(tlbx)
+				srv.User().MustExec(qryInviteInsert(), inv.Code, inv.CreatedBy, inv.CreatedOn, inv.Email, inv.MaxUses, inv.Uses, inv.ExpiresOn)
+				if inv.Email != nil && c.InviteFmtLink != "" {
+					sendEmail(tlbx, c, usermail.Invite, *inv.Email, fromEmail, Strf(c.InviteFmtLink, inv.Code, url.QueryEscape(*inv.Email)), nil, nil, false)
+				}
+				return inv
+			},
+		},
+		{
+			Description:  "get the invites I have created, most recent first",
+			Path:         (&user.GetInvites{}).Path(),
+			Timeout:      500,
+			MaxBodyBytes: app.KB,
+			IsPrivate:    false,
+			GetDefaultArgs: func() interface{} {
+				return nil
+			},
+			GetExampleArgs: func() interface{} {
+				return nil
+			},
+			GetExampleResponse: func() interface{} {
+				return []*user.Invite{exampleInvite()}
+			},
+			Handler: func(tlbx app.Tlbx, _ interface{}) interface{} {
+				me := me.AuthedGet(tlbx)
+				res := make([]*user.Invite, 0, 10)
+				service.Get(tlbx).User().MustGetN(&res, qryInvitesGet(), me, inviteGetLimit)
+				return res
+			},
+		},
+		{
+			Description:  "delete an invite I created",
+			Path:         (&user.DeleteInvite{}).Path(),
+			Timeout:      500,
+			MaxBodyBytes: app.KB,
+			IsPrivate:    false,
+			GetDefaultArgs: func() interface{} {
+				return &user.DeleteInvite{}
+			},
+			GetExampleArgs: func() interface{} {
+				return &user.DeleteInvite{
+					Code: "123abc",
+				}
+			},
+			GetExampleResponse: func() interface{} {
+				return nil
+			},
+			Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
+				args := a.(*user.DeleteInvite)
+				me := me.AuthedGet(tlbx)
+				service.Get(tlbx).User().MustExec(qryInviteDelete(), args.Code, me)
+				return nil
+			},
+		},
 		{
 			Description:  "logout",
 			Path:         (&user.Logout{}).Path(),
@@ -570,6 +1084,39 @@ func New(
 				return nil
 			},
 		},
+		{
+			Description:  "set locale, used to select the language of emails, nil to use the requests Accept-Language",
+			Path:         (&user.SetLocale{}).Path(),
+			Timeout:      500,
+			MaxBodyBytes: app.KB,
+			IsPrivate:    false,
+			GetDefaultArgs: func() interface{} {
+				return &user.SetLocale{}
+			},
+			GetExampleArgs: func() interface{} {
+				return &user.SetLocale{
+					Locale: ptr.String("en-gb"),
+				}
+			},
+			GetExampleResponse: func() interface{} {
+				return nil
+			},
+			Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
+				args := a.(*user.SetLocale)
+				if args.Locale != nil {
+					args.Locale = ptr.String(StrLower(StrTrimWS(*args.Locale)))
+					validate.Str("locale", *args.Locale, localeMinLen, localeMaxLen, localeRegex)
+				}
+				me := me.AuthedGet(tlbx)
+				tx := service.Get(tlbx).User().BeginWrite()
+				defer tx.Rollback()
+				user := getUser(tx, nil, &me)
+				user.Locale = args.Locale
+				updateUser(tx, user)
+				tx.Commit()
+				return nil
+			},
+		},
 		{
 			Description:  "get me",
 			Path:         (&user.GetMe{}).Path(),
@@ -593,6 +1140,7 @@ func New(
 				if enableFCM {
 					ex.FcmEnabled = ptr.Bool(true)
 				}
+				ex.Profile = exampleProfile(c, user.ProfilePrivate)
 				return ex
 			},
 			Handler: func(tlbx app.Tlbx, _ interface{}) interface{} {
@@ -602,46 +1150,152 @@ func New(
 				me := me.AuthedGet(tlbx)
 				tx := service.Get(tlbx).User().BeginRead()
 				defer tx.Rollback()
-				user := getUser(tx, nil, &me)
+				u := getUser(tx, nil, &me)
+				u.Profile = getProfiles(tx, c, IDs{me}, user.ProfilePrivate)[me]
 				tx.Commit()
-				return &user.Me
+				if enableSocials && u.Discoverable == nil {
+					// accounts registered before discoverable was added
+					// are discoverable, the same as new accounts
+					u.Discoverable = ptr.Bool(true)
+				}
+				return &u.Me
 			},
 		},
-	}
-	if enableJin {
-		eps = append(eps,
-			&app.Endpoint{
-				Description:  "set users jin (json bin), adhoc json content",
-				Path:         (&user.SetJin{}).Path(),
-				Timeout:      500,
-				MaxBodyBytes: 10 * app.KB,
-				IsPrivate:    false,
-				GetDefaultArgs: func() interface{} {
-					return &user.SetJin{}
-				},
-				GetExampleArgs: func() interface{} {
-					return &user.SetJin{
-						Val: exampleJin,
+		{
+			Description:  "export all of my data as a zip, exports too large to download are exported async instead",
+			Path:         (&user.Export{}).Path(),
+			Timeout:      10000,
+			MaxBodyBytes: app.KB,
+			IsPrivate:    false,
+			GetDefaultArgs: func() interface{} {
+				return nil
+			},
+			GetExampleArgs: func() interface{} {
+				return nil
+			},
+			GetExampleResponse: func() interface{} {
+				return &app.DownStream{}
+			},
+			Handler: func(tlbx app.Tlbx, _ interface{}) interface{} {
+				me := me.AuthedGet(tlbx)
+				// the export is produced once into a buffer capped at
+				// ExportMaxSyncSize so OnExport hooks only run once, if it
+				// doesn't fit it is exported async instead
+				buf := &exportBuffer{max: c.ExportMaxSyncSize}
+				Do(func() {
+					writeExport(tlbx, c, enableJin, enableFCM, me, buf)
+				}, func(r interface{}) {
+					// hooks may wrap the write error so check the buffer
+					if !buf.over {
+						PanicOn(r)
+					}
+				})
+				if buf.over {
+					exportAsync(tlbx, c, enableJin, enableFCM, fromEmail, me)
+					app.ReturnIf(true, http.StatusRequestEntityTooLarge, "export too large to download, a download link will be emailed to you when it is ready")
+				}
+				ds := &app.DownStream{}
+				ds.ID = me
+				ds.Name = exportName
+				ds.Type = "application/zip"
+				ds.Size = int64(buf.Len())
+				ds.IsDownload = true
+				ds.Content = ioutil.NopCloser(&buf.Buffer)
+				return ds
+			},
+		},
+		{
+			Description:  "export all of my data as a zip in the background, a time limited download link is emailed to me when it is ready",
+			Path:         (&user.ExportAsync{}).Path(),
+			Timeout:      500,
+			MaxBodyBytes: app.KB,
+			IsPrivate:    false,
+			GetDefaultArgs: func() interface{} {
+				return nil
+			},
+			GetExampleArgs: func() interface{} {
+				return nil
+			},
+			GetExampleResponse: func() interface{} {
+				return nil
+			},
+			Handler: func(tlbx app.Tlbx, _ interface{}) interface{} {
+				exportAsync(tlbx, c, enableJin, enableFCM, fromEmail, me.AuthedGet(tlbx))
+				return nil
+			},
+		},
+	}
+	if enableJin {
+		eps = append(eps,
+			&app.Endpoint{
+				Description:  "set users jin (json bin), adhoc json content, returns the new revision",
+				Path:         (&user.SetJin{}).Path(),
+				Timeout:      500,
+				MaxBodyBytes: 10 * app.KB,
+				IsPrivate:    false,
+				GetDefaultArgs: func() interface{} {
+					return &user.SetJin{}
+				},
+				GetExampleArgs: func() interface{} {
+					return &user.SetJin{
+						Rev: ptr.Uint64(1),
+						Val: exampleJin,
 					}
 				},
-				GetExampleResponse: func() interface{} {
-					return nil
-				},
+				GetExampleResponse: func() interface{} {
+					return 2
+				},
 				Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
 					args := a.(*user.SetJin)
 					me := me.AuthedGet(tlbx)
-					srv := service.Get(tlbx)
-					if args.Val == nil {
-						srv.User().MustExec(qryJinDelete(), me)
-					} else {
-						// if app requires init ctx data store it in jin
-						srv.User().MustExec(qryJinInsert(), me, args.Val)
+					tx := service.Get(tlbx).User().BeginWrite()
+					defer tx.Rollback()
+					jin := getJinForUpdate(tx, me, args.Rev)
+					// if app requires init ctx data store it in jin
+					jin.Val = args.Val
+					setJin(tx, me, jin)
+					tx.Commit()
+					return jin.Rev
+				},
+			},
+			&app.Endpoint{
+				Description:  "patch users jin (json bin) with an RFC 7396 json merge patch, returns the new jin",
+				Path:         (&user.PatchJin{}).Path(),
+				Timeout:      500,
+				MaxBodyBytes: 10 * app.KB,
+				IsPrivate:    false,
+				GetDefaultArgs: func() interface{} {
+					return &user.PatchJin{}
+				},
+				GetExampleArgs: func() interface{} {
+					return &user.PatchJin{
+						Rev:   ptr.Uint64(1),
+						Patch: json.MustFromString(`{"startTab":"recent"}`),
 					}
-					return nil
+				},
+				GetExampleResponse: func() interface{} {
+					return &user.Jin{
+						Rev: 2,
+						Val: json.MustFromString(`{"v":1, "saveDir":"/my/save/dir", "startTab":"recent"}`),
+					}
+				},
+				Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
+					args := a.(*user.PatchJin)
+					me := me.AuthedGet(tlbx)
+					tx := service.Get(tlbx).User().BeginWrite()
+					defer tx.Rollback()
+					jin := getJinForUpdate(tx, me, args.Rev)
+					jin.Val = json.MergePatch(jin.Val, args.Patch)
+					if jin.Val.MustInterface() == nil {
+						jin.Val = nil
+					}
+					setJin(tx, me, jin)
+					tx.Commit()
+					return jin
 				},
 			},
 			&app.Endpoint{
-				Description:  "get users jin (json bin), adhoc json content",
+				Description:  "get users jin (json bin), adhoc json content, and its revision",
 				Path:         (&user.GetJin{}).Path(),
 				Timeout:      500,
 				MaxBodyBytes: app.KB,
@@ -653,17 +1307,88 @@ func New(
 					return nil
 				},
 				GetExampleResponse: func() interface{} {
-					return exampleJin
+					return &user.Jin{
+						Rev: 1,
+						Val: exampleJin,
+					}
+				},
+				Handler: func(tlbx app.Tlbx, _ interface{}) interface{} {
+					me := me.AuthedGet(tlbx)
+					res := &user.Jin{}
+					sqlh.PanicIfIsntNoRows(service.Get(tlbx).User().Get1(res, qryJinSelect(false), me))
+					return res
+				},
+			})
+	}
+	if len(c.ProfileFields) > 0 {
+		eps = append(eps,
+			&app.Endpoint{
+				Description:  "get the profile fields that may be set with setProfile",
+				Path:         (&user.GetProfileFields{}).Path(),
+				Timeout:      500,
+				MaxBodyBytes: app.KB,
+				IsPrivate:    false,
+				GetDefaultArgs: func() interface{} {
+					return nil
+				},
+				GetExampleArgs: func() interface{} {
+					return nil
+				},
+				GetExampleResponse: func() interface{} {
+					return profileFieldDefs(c)
 				},
 				Handler: func(tlbx app.Tlbx, _ interface{}) interface{} {
+					return profileFieldDefs(c)
+				},
+			},
+			&app.Endpoint{
+				Description:  "set my profile fields, null values clear the field",
+				Path:         (&user.SetProfile{}).Path(),
+				Timeout:      500,
+				MaxBodyBytes: 10 * app.KB,
+				IsPrivate:    false,
+				GetDefaultArgs: func() interface{} {
+					return &user.SetProfile{}
+				},
+				GetExampleArgs: func() interface{} {
+					return &user.SetProfile{
+						Fields: exampleProfile(c, user.ProfilePrivate),
+					}
+				},
+				GetExampleResponse: func() interface{} {
+					return nil
+				},
+				Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
+					args := a.(*user.SetProfile)
 					me := me.AuthedGet(tlbx)
-					srv := service.Get(tlbx)
-					res := &json.Json{}
-					tx := srv.User().BeginRead()
+					app.BadReqIf(len(args.Fields) == 0, "no fields supplied")
+					app.BadReqIf(len(args.Fields) > len(c.ProfileFields), "too many fields supplied")
+					vals := make(map[string][]byte, len(args.Fields))
+					for name, val := range args.Fields {
+						f := getProfileField(c, name)
+						app.BadReqIf(f == nil, "unknown profile field %s", name)
+						if val == nil {
+							vals[name] = nil
+							continue
+						}
+						val = profileValue(f, val)
+						if f.Validate != nil {
+							f.Validate(tlbx, val)
+						}
+						vals[name] = json.MustMarshal(val)
+						app.BadReqIf(len(vals[name]) > profileFieldValMaxBytes, "profile field %s is too long", name)
+					}
+					tx := service.Get(tlbx).User().BeginWrite()
 					defer tx.Rollback()
-					getJin(tx, me, res)
+					for name, val := range vals {
+						if val == nil {
+							tx.MustExec(qryProfileFieldDelete(), me, name)
+						} else {
+							tx.MustExec(qryProfileFieldUpsert(), me, name, val)
+						}
+					}
 					tx.Commit()
-					return res
+					return nil
 				},
 			})
 	}
@@ -690,6 +1415,7 @@ func New(
 							Handle:    ptr.String("bloe_joggs"),
 							Alias:     ptr.String("Joe Bloggs"),
 							HasAvatar: ptr.Bool(true),
+							Profile:   exampleProfile(c, user.ProfileAuthed),
 						},
 					}
 				},
@@ -704,12 +1430,117 @@ func New(
 					srv.User().MustQuery(func(r *sqlx.Rows) {
 						for r.Next() {
 							u := &user.User{}
-							PanicOn(r.Scan(&u.ID, &u.Handle, &u.Alias, &u.HasAvatar))
+							PanicOn(r.Scan(&u.ID, &u.Handle, &u.Alias, &u.HasAvatar, &u.AvatarHash))
 							res = append(res, u)
 						}
 					}, qryUsersGet(len(args.Users)), args.Users.ToIs()...)
+					if len(c.ProfileFields) > 0 {
+						visibility := user.ProfilePublic
+						if me.AuthedExists(tlbx) {
+							visibility = user.ProfileAuthed
+						}
+						profiles := getProfiles(srv.User(), c, args.Users, visibility)
+						for _, u := range res {
+							u.Profile = profiles[u.ID]
+						}
+					}
+					return res
+				},
+			}, &app.Endpoint{
+				Description:  "search discoverable users by handle or alias prefix, rate limited to SearchPerMinute",
+				Path:         (&user.Search{}).Path(),
+				Timeout:      500,
+				MaxBodyBytes: app.KB,
+				IsPrivate:    false,
+				GetDefaultArgs: func() interface{} {
+					return &user.Search{
+						Base: searchFilterDefs(),
+					}
+				},
+				GetExampleArgs: func() interface{} {
+					return &user.Search{
+						Prefix: "bloe",
+						Base: filter.Base{
+							After: ptr.ID(app.ExampleID()),
+							Sort:  user.SortHandle,
+							Asc:   ptr.Bool(true),
+							Limit: 20,
+						},
+					}
+				},
+				GetExampleResponse: func() interface{} {
+					return &user.SearchRes{
+						Set: []*user.User{
+							{
+								ID:        app.ExampleID(),
+								Handle:    ptr.String("bloe_joggs"),
+								Alias:     ptr.String("Joe Bloggs"),
+								HasAvatar: ptr.Bool(true),
+							},
+						},
+						More: true,
+					}
+				},
+				Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
+					args := a.(*user.Search)
+					me := me.AuthedGet(tlbx)
+					args.Prefix = StrTrimWS(args.Prefix)
+					validate.Str("prefix", args.Prefix, searchPrefixMinLen, aliasMaxLen)
+					args.Base.MaxLimit = searchFilterDefs().MaxLimit
+					args.Base.ValidSorts = searchFilterDefs().ValidSorts
+					args.Base.MustBeValid(tlbx)
+					if args.Base.Asc == nil {
+						args.Base.Asc = ptr.Bool(true)
+					}
+					args.Base.Limit = sqlh.Limit100(args.Base.Limit)
+					searchRateLimit(tlbx, c, me)
+					res := &user.SearchRes{
+						Set: make([]*user.User, 0, args.Base.Limit),
+					}
+					sqlArgs := sqlh.NewArgs(10)
+					service.Get(tlbx).User().MustQuery(func(r *sqlx.Rows) {
+						for r.Next() {
+							if len(args.Base.IDs) == 0 && len(res.Set) == int(args.Base.Limit) {
+								res.More = true
+								break
+							}
+							u := &user.User{}
+							PanicOn(r.Scan(&u.ID, &u.Handle, &u.Alias, &u.HasAvatar, &u.AvatarHash))
+							res.Set = append(res.Set, u)
+						}
+					}, qryUsersSearch(sqlArgs, args), sqlArgs.Is()...)
 					return res
 				},
+			}, &app.Endpoint{
+				Description:  "set whether I am returned by user search",
+				Path:         (&user.SetDiscoverable{}).Path(),
+				Timeout:      500,
+				MaxBodyBytes: app.KB,
+				IsPrivate:    false,
+				GetDefaultArgs: func() interface{} {
+					return &user.SetDiscoverable{
+						Val: true,
+					}
+				},
+				GetExampleArgs: func() interface{} {
+					return &user.SetDiscoverable{
+						Val: false,
+					}
+				},
+				GetExampleResponse: func() interface{} {
+					return nil
+				},
+				Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
+					args := a.(*user.SetDiscoverable)
+					me := me.AuthedGet(tlbx)
+					tx := service.Get(tlbx).User().BeginWrite()
+					defer tx.Rollback()
+					u := getUser(tx, nil, &me)
+					u.Discoverable = &args.Val
+					updateUser(tx, u)
+					tx.Commit()
+					return nil
+				},
 			}, &app.Endpoint{
 				Description:  "set handle",
 				Path:         (&user.SetHandle{}).Path(),
@@ -796,49 +1627,29 @@ func New(
 				Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
 					args := a.(*app.UpStream)
 					defer args.Content.Close()
-					me := me.AuthedGet(tlbx)
-					srv := service.Get(tlbx)
-					tx := srv.User().BeginWrite()
-					defer tx.Rollback()
-					user := getUser(tx, nil, &me)
 					content, err := ioutil.ReadAll(args.Content)
 					PanicOn(err)
-					args.Size = int64(len(content))
-					if args.Size > 0 {
-						if *user.HasAvatar {
-							srv.Store().MustDelete(AvatarBucket, store.GenKey(AvatarPrefix, me))
-						}
-						avatar, _, err := image.Decode(bytes.NewBuffer(content))
-						PanicOn(err)
-						bounds := avatar.Bounds()
-						xDiff := bounds.Max.X - bounds.Min.X
-						yDiff := bounds.Max.Y - bounds.Min.Y
-						if xDiff != yDiff || xDiff != avatarDim || yDiff != avatarDim {
-							avatar = imaging.Fill(avatar, avatarDim, avatarDim, imaging.Center, imaging.Lanczos)
-						}
-						buff := &bytes.Buffer{}
-						PanicOn(png.Encode(buff, avatar))
-						srv.Store().MustPut(
-							AvatarBucket,
-							store.GenKey(AvatarPrefix, me),
-							args.Name,
-							"image/png",
-							int64(buff.Len()),
-							true,
-							false,
-							bytes.NewReader(buff.Bytes()))
-					} else if *user.HasAvatar == true {
-						srv.Store().MustDelete(AvatarBucket, store.GenKey(AvatarPrefix, me))
-					}
-					nowHasAvatar := args.Size > 0
-					if *user.HasAvatar != nowHasAvatar {
-						user.HasAvatar = ptr.Bool(nowHasAvatar)
-						if onSetSocials != nil {
-							onSetSocials(tlbx, &user.User)
-						}
-					}
-					updateUser(tx, user)
-					tx.Commit()
+					setAvatar(tlbx, c, onSetSocials, me.AuthedGet(tlbx), content)
+					return nil
+				},
+			},
+			&app.Endpoint{
+				Description:  "delete avatar",
+				Path:         (&user.DeleteAvatar{}).Path(),
+				Timeout:      500,
+				MaxBodyBytes: app.KB,
+				IsPrivate:    false,
+				GetDefaultArgs: func() interface{} {
+					return nil
+				},
+				GetExampleArgs: func() interface{} {
+					return nil
+				},
+				GetExampleResponse: func() interface{} {
+					return nil
+				},
+				Handler: func(tlbx app.Tlbx, _ interface{}) interface{} {
+					setAvatar(tlbx, c, onSetSocials, me.AuthedGet(tlbx), nil)
 					return nil
 				},
 			},
@@ -855,6 +1666,8 @@ func New(
 				GetExampleArgs: func() interface{} {
 					return &user.GetAvatar{
 						User: app.ExampleID(),
+						Size: ptr.Int(64),
+						Hash: ptr.String("0123456789abcdef"),
 					}
 				},
 				GetExampleResponse: func() interface{} {
@@ -863,7 +1676,17 @@ func New(
 				Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
 					args := a.(*user.GetAvatar)
 					srv := service.Get(tlbx)
-					name, mimeType, size, content := srv.Store().MustGet(AvatarBucket, store.GenKey(AvatarPrefix, args.User))
+					tx := srv.User().BeginRead()
+					defer tx.Rollback()
+					u := getUser(tx, nil, &args.User)
+					tx.Commit()
+					app.ReturnIf(u == nil || u.DeletedOn != nil || u.HasAvatar == nil || !*u.HasAvatar, http.StatusNotFound, "")
+					app.ReturnIf(args.Hash != nil && (u.AvatarHash == nil || *u.AvatarHash != *args.Hash), http.StatusNotFound, "")
+					if args.Hash != nil {
+						// content hashed keys never change so may be cached forever
+						tlbx.Resp().Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+					}
+					name, mimeType, size, content := srv.Store().MustGet(AvatarBucket, avatarKey(u, avatarSize(c, u, args.Size)))
 					ds := &app.DownStream{}
 					ds.ID = args.User
 					ds.Name = name
@@ -977,12 +1800,11 @@ func New(
 				},
 			},
 			&app.Endpoint{
-				Description:      "unregister from fcm",
-				SkipXClientCheck: true,
-				Path:             (&user.UnregisterFromFCM{}).Path(),
-				Timeout:          500,
-				MaxBodyBytes:     app.KB,
-				IsPrivate:        false,
+				Description:  "unregister from fcm",
+				Path:         (&user.UnregisterFromFCM{}).Path(),
+				Timeout:      500,
+				MaxBodyBytes: app.KB,
+				IsPrivate:    false,
 				GetDefaultArgs: func() interface{} {
 					return &user.UnregisterFromFCM{}
 				},
@@ -1002,104 +1824,453 @@ func New(
 				},
 			})
 	}
-	return eps
-}
-
-var (
-	handleRegex  = regexp.MustCompile(`\A[_a-z0-9]{1,20}\z`)
-	handleMinLen = 1
-	handleMaxLen = 20
-	emailRegex   = regexp.MustCompile(`\A.+@.+\..+\z`)
-	emailMaxLen  = 250
-	aliasMaxLen  = 50
-	pwdRegexs    = []*regexp.Regexp{
-		regexp.MustCompile(`[0-9]`),
-		regexp.MustCompile(`[a-z]`),
-		regexp.MustCompile(`[A-Z]`),
-		regexp.MustCompile(`[\w]`),
-	}
-	pwdMinLen     = 8
-	pwdMaxLen     = 100
-	scryptN       = 32768
-	scryptR       = 8
-	scryptP       = 1
-	scryptSaltLen = 256
-	scryptKeyLen  = 256
-	avatarDim     = 250
-	exampleJin    = json.MustFromString(`{"v":1, "saveDir":"/my/save/dir", "startTab":"favourites"}`)
-)
-
-func sendActivateEmail(srv service.Layer, sendTo, from string, link string, handle *string) {
-	html := `<p>Thank you for registering.</p><p>Click this link to activate your account:</p><p><a href="` + link + `">Activate</a></p><p>If you didn't register for this account you can simply ignore this email.</p>`
-	txt := "Thank you for registering.\nClick this link to activate your account:\n\n" + link + "\n\nIf you didn't register for this account you can simply ignore this email."
-	if handle != nil {
-		html = Strf("Hi %s,\n\n%s", *handle, html)
-		txt = Strf("Hi %s,\n\n%s", *handle, txt)
-	}
-	srv.Email().MustSend([]string{sendTo}, from, "Activate", html, txt)
-}
-
-func sendLoginLinkEmail(srv service.Layer, sendTo, from string, link string, handle *string) {
-	html := `<p>Here is the login link you requested.</p><p>Click this link to login to your account:</p><p><a href="` + link + `">Login</a></p><p>This link will only be valid for 10 minutes.</p><p>If you didn't request this link you can simply ignore this email.</p>`
-	txt := "Here is the login link you requested.\nClick this link to login to your account:\n\n" + link + "\n\nThis link will only be valid for 10 minutes.\n\nIf you didn't request this link you can simply ignore this email."
-	if handle != nil {
-		html = Strf("Hi %s,\n\n%s", *handle, html)
-		txt = Strf("Hi %s,\n\n%s", *handle, txt)
-	}
-	srv.Email().MustSend([]string{sendTo}, from, "Login Link", html, txt)
-}
-
-func sendConfirmChangeEmailEmail(srv service.Layer, sendTo, from string, link string) {
-	srv.Email().MustSend([]string{sendTo}, from, "Confirm change email",
-		`<p>Click this link to change the email associated with your account:</p><p><a href="`+link+`">Confirm change email</a></p>`,
-		"Confirm change email:\n\n"+link)
-}
-
-func sendResetPwdEmail(srv service.Layer, sendTo, from string, newPwd string) {
-	srv.Email().MustSend([]string{sendTo}, from, "Pwd Reset", `<p>New Pwd: `+newPwd+`</p>`, `New Pwd: `+newPwd)
-}
-
-type fullUser struct {
-	user.Me
-	Email                  string
-	RegisteredOn           time.Time
-	ActivatedOn            time.Time
-	NewEmail               *string
-	ActivateCode           *string
-	ChangeEmailCode        *string
-	LastPwdResetOn         *time.Time
-	LoginLinkCodeCreatedOn *time.Time
-	LoginLinkCode          *string
-}
-
-func getUser(tx sql.Tx, email *string, id *ID) *fullUser {
-	PanicIf(email == nil && id == nil, "one of email or id must not be nil")
-	var arg interface{}
-	if email != nil {
-		arg = *email
-	} else {
-		arg = *id
-	}
-	res := &fullUser{}
-	err := tx.Get1(res, qryUserFullGet(id != nil), arg)
-	if sqlh.IsNoRows(err) {
-		return nil
+	if c.RequirePow {
+		eps = append(eps, poweps.New(c.PowConfigs...)...)
 	}
-	PanicOn(err)
-	return res
-}
-
-func updateUser(tx sql.Tx, user *fullUser) {
-	tx.MustExec(qryUserUpdate(), user.Email, user.Handle, user.Alias, user.HasAvatar, user.FcmEnabled, user.RegisteredOn, user.ActivatedOn, user.NewEmail, user.ActivateCode, user.ChangeEmailCode, user.LastPwdResetOn, user.LoginLinkCodeCreatedOn, user.LoginLinkCode, user.ID)
+	if c.EnableAdmin {
+		eps = append(eps,
+			&app.Endpoint{
+				Description:  "admin: search users by email or handle prefix",
+				Path:         (&user.AdminSearch{}).Path(),
+				Timeout:      500,
+				MaxBodyBytes: app.KB,
+				IsPrivate:    false,
+				GetDefaultArgs: func() interface{} {
+					return &user.AdminSearch{
+						Limit: 20,
+					}
+				},
+				GetExampleArgs: func() interface{} {
+					return &user.AdminSearch{
+						Prefix: "joe",
+						Limit:  20,
+					}
+				},
+				GetExampleResponse: func() interface{} {
+					return []*user.AdminUser{exampleAdminUser()}
+				},
+				Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
+					args := a.(*user.AdminSearch)
+					mustBeAdmin(tlbx)
+					validate.Str("prefix", args.Prefix, 1, emailMaxLen)
+					app.BadReqIf(args.Limit < 1 || args.Limit > 100, "limit must be between 1 and 100")
+					prefix := likePrefix(args.Prefix)
+					users := make([]*fullUser, 0, args.Limit)
+					service.Get(tlbx).User().MustGetN(&users, qryUsersFullSearch(), prefix, prefix, args.Limit)
+					res := make([]*user.AdminUser, 0, len(users))
+					for _, u := range users {
+						res = append(res, u.toAdminUser())
+					}
+					return res
+				},
+			},
+			&app.Endpoint{
+				Description:  "admin: get a users registration, activation, disabled and deletion state",
+				Path:         (&user.AdminGet{}).Path(),
+				Timeout:      500,
+				MaxBodyBytes: app.KB,
+				IsPrivate:    false,
+				GetDefaultArgs: func() interface{} {
+					return &user.AdminGet{}
+				},
+				GetExampleArgs: func() interface{} {
+					return &user.AdminGet{
+						User: app.ExampleID(),
+					}
+				},
+				GetExampleResponse: func() interface{} {
+					return exampleAdminUser()
+				},
+				Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
+					args := a.(*user.AdminGet)
+					mustBeAdmin(tlbx)
+					tx := service.Get(tlbx).User().BeginRead()
+					defer tx.Rollback()
+					u := getUser(tx, nil, &args.User)
+					tx.Commit()
+					app.ReturnIf(u == nil, http.StatusNotFound, "")
+					return u.toAdminUser()
+				},
+			},
+			&app.Endpoint{
+				Description:  "admin: activate a users account without the activate link",
+				Path:         (&user.AdminActivate{}).Path(),
+				Timeout:      500,
+				MaxBodyBytes: app.KB,
+				IsPrivate:    false,
+				GetDefaultArgs: func() interface{} {
+					return &user.AdminActivate{}
+				},
+				GetExampleArgs: func() interface{} {
+					return &user.AdminActivate{
+						User: app.ExampleID(),
+					}
+				},
+				GetExampleResponse: func() interface{} {
+					return nil
+				},
+				Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
+					args := a.(*user.AdminActivate)
+					admin := mustBeAdmin(tlbx)
+					tx := service.Get(tlbx).User().BeginWrite()
+					defer tx.Rollback()
+					u := getUser(tx, nil, &args.User)
+					app.ReturnIf(u == nil, http.StatusNotFound, "")
+					app.BadReqIf(u.ActivateCode == nil, "user is already activated")
+					u.ActivatedOn = Now()
+					u.ActivateCode = nil
+					updateUser(tx, u)
+					adminAudit(tlbx, tx, admin, u.ID, "activate")
+					tx.Commit()
+					return nil
+				},
+			},
+			&app.Endpoint{
+				Description:  "admin: disable or enable a users account, disabled users are logged out and can not login",
+				Path:         (&user.AdminSetDisabled{}).Path(),
+				Timeout:      500,
+				MaxBodyBytes: app.KB,
+				IsPrivate:    false,
+				GetDefaultArgs: func() interface{} {
+					return &user.AdminSetDisabled{}
+				},
+				GetExampleArgs: func() interface{} {
+					return &user.AdminSetDisabled{
+						User:     app.ExampleID(),
+						Disabled: true,
+					}
+				},
+				GetExampleResponse: func() interface{} {
+					return nil
+				},
+				Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
+					args := a.(*user.AdminSetDisabled)
+					admin := mustBeAdmin(tlbx)
+					app.BadReqIf(admin.Equal(args.User), "can not disable yourself")
+					tx := service.Get(tlbx).User().BeginWrite()
+					defer tx.Rollback()
+					u := getUser(tx, nil, &args.User)
+					app.ReturnIf(u == nil, http.StatusNotFound, "")
+					if (u.DisabledOn != nil) == args.Disabled {
+						// not changing anything
+						return nil
+					}
+					action := "enable"
+					u.DisabledOn = nil
+					if args.Disabled {
+						action = "disable"
+						u.DisabledOn = ptr.Time(NowMilli())
+					}
+					updateUser(tx, u)
+					adminAudit(tlbx, tx, admin, u.ID, action)
+					tx.Commit()
+					// only cache once users.disabledOn is committed
+					me.SetDisabled(tlbx, u.ID, args.Disabled)
+					return nil
+				},
+			},
+			&app.Endpoint{
+				Description:  "admin: logout all of a users sessions",
+				Path:         (&user.AdminLogout{}).Path(),
+				Timeout:      500,
+				MaxBodyBytes: app.KB,
+				IsPrivate:    false,
+				GetDefaultArgs: func() interface{} {
+					return &user.AdminLogout{}
+				},
+				GetExampleArgs: func() interface{} {
+					return &user.AdminLogout{
+						User: app.ExampleID(),
+					}
+				},
+				GetExampleResponse: func() interface{} {
+					return nil
+				},
+				Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
+					args := a.(*user.AdminLogout)
+					admin := mustBeAdmin(tlbx)
+					tx := service.Get(tlbx).User().BeginWrite()
+					defer tx.Rollback()
+					u := getUser(tx, nil, &args.User)
+					app.ReturnIf(u == nil, http.StatusNotFound, "")
+					adminAudit(tlbx, tx, admin, u.ID, "logout")
+					tx.Commit()
+					me.RevokeAll(tlbx, u.ID)
+					return nil
+				},
+			},
+			&app.Endpoint{
+				Description:  "admin: resend a users activate, confirmChangeEmail or resetPwd email",
+				Path:         (&user.AdminResendEmail{}).Path(),
+				Timeout:      1000,
+				MaxBodyBytes: app.KB,
+				IsPrivate:    false,
+				GetDefaultArgs: func() interface{} {
+					return &user.AdminResendEmail{}
+				},
+				GetExampleArgs: func() interface{} {
+					return &user.AdminResendEmail{
+						User:  app.ExampleID(),
+						Email: string(usermail.Activate),
+					}
+				},
+				GetExampleResponse: func() interface{} {
+					return nil
+				},
+				Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
+					args := a.(*user.AdminResendEmail)
+					admin := mustBeAdmin(tlbx)
+					tx := service.Get(tlbx).User().BeginWrite()
+					defer tx.Rollback()
+					u := getUser(tx, nil, &args.User)
+					app.ReturnIf(u == nil, http.StatusNotFound, "")
+					switch usermail.Name(args.Email) {
+					case usermail.Activate:
+						app.BadReqIf(u.ActivateCode == nil, "user is already activated")
+						sendEmail(tlbx, c, usermail.Activate, u.Email, fromEmail, Strf(activateFmtLink, u.ID, *u.ActivateCode), u.Handle, u.Locale, false)
+					case usermail.ConfirmChangeEmail:
+						app.BadReqIf(u.NewEmail == nil || u.ChangeEmailCode == nil, "user has no pending email change")
+						sendEmail(tlbx, c, usermail.ConfirmChangeEmail, *u.NewEmail, fromEmail, Strf(confirmChangeEmailFmtLink, u.ID, *u.ChangeEmailCode), u.Handle, u.Locale, false)
+					case usermail.ResetPwd:
+						u.LastPwdResetOn = ptr.Time(Now())
+						u.ResetPwdCode = ptr.String(crypt.UrlSafeString(250))
+						updateUser(tx, u)
+						sendEmail(tlbx, c, usermail.ResetPwd, u.Email, fromEmail, Strf(resetPwdFmtLink, u.ID, *u.ResetPwdCode), u.Handle, u.Locale, false)
+					default:
+						app.BadReqIf(true, "email must be one of %s, %s or %s", usermail.Activate, usermail.ConfirmChangeEmail, usermail.ResetPwd)
+					}
+					adminAudit(tlbx, tx, admin, u.ID, "resendEmail:"+args.Email)
+					tx.Commit()
+					return nil
+				},
+			},
+			&app.Endpoint{
+				Description:  "admin: login as another user, the current session is replaced",
+				Path:         (&user.AdminImpersonate{}).Path(),
+				Timeout:      500,
+				MaxBodyBytes: app.KB,
+				IsPrivate:    false,
+				GetDefaultArgs: func() interface{} {
+					return &user.AdminImpersonate{}
+				},
+				GetExampleArgs: func() interface{} {
+					return &user.AdminImpersonate{
+						User: app.ExampleID(),
+					}
+				},
+				GetExampleResponse: func() interface{} {
+					return &exampleAdminUser().Me
+				},
+				Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
+					args := a.(*user.AdminImpersonate)
+					admin := mustBeAdmin(tlbx)
+					tx := service.Get(tlbx).User().BeginWrite()
+					defer tx.Rollback()
+					u := getUser(tx, nil, &args.User)
+					app.ReturnIf(u == nil, http.StatusNotFound, "")
+					app.ReturnIf(u.IsAdmin, http.StatusForbidden, "can not impersonate another admin")
+					mustBeAbleToLogin(u)
+					adminAudit(tlbx, tx, admin, u.ID, "impersonate")
+					tx.Commit()
+					me.ImpersonateSet(tlbx, admin, u.ID)
+					return &u.Me
+				},
+			},
+			&app.Endpoint{
+				Description:  "admin: get the admin audit trail, most recent first, optionally for a single user",
+				Path:         (&user.AdminGetAudit{}).Path(),
+				Timeout:      500,
+				MaxBodyBytes: app.KB,
+				IsPrivate:    false,
+				GetDefaultArgs: func() interface{} {
+					return &user.AdminGetAudit{
+						Limit: 20,
+					}
+				},
+				GetExampleArgs: func() interface{} {
+					return &user.AdminGetAudit{
+						User:  ptr.ID(app.ExampleID()),
+						Limit: 20,
+					}
+				},
+				GetExampleResponse: func() interface{} {
+					return []*user.AdminAudit{
+						{
+							ID:        app.ExampleID(),
+							Admin:     app.ExampleID(),
+							User:      app.ExampleID(),
+							Action:    "impersonate",
+							CreatedOn: app.ExampleTime(),
+						},
+					}
+				},
+				Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
+					args := a.(*user.AdminGetAudit)
+					mustBeAdmin(tlbx)
+					app.BadReqIf(args.Limit < 1 || args.Limit > 100, "limit must be between 1 and 100")
+					res := make([]*user.AdminAudit, 0, args.Limit)
+					qArgs := make([]interface{}, 0, 2)
+					if args.User != nil {
+						qArgs = append(qArgs, *args.User)
+					}
+					qArgs = append(qArgs, args.Limit)
+					service.Get(tlbx).User().MustGetN(&res, qryAdminAuditGet(args.User != nil), qArgs...)
+					return res
+				},
+			},
+			&app.Endpoint{
+				Description:  "admin: get a users email change history, most recent first",
+				Path:         (&user.AdminGetEmailHistory{}).Path(),
+				Timeout:      500,
+				MaxBodyBytes: app.KB,
+				IsPrivate:    false,
+				GetDefaultArgs: func() interface{} {
+					return &user.AdminGetEmailHistory{
+						Limit: 20,
+					}
+				},
+				GetExampleArgs: func() interface{} {
+					return &user.AdminGetEmailHistory{
+						User:  app.ExampleID(),
+						Limit: 20,
+					}
+				},
+				GetExampleResponse: func() interface{} {
+					return []*user.EmailChange{
+						{
+							User:      app.ExampleID(),
+							OldEmail:  "joe@bloggs.example",
+							NewEmail:  "new_joe@bloggs.example",
+							ChangedOn: app.ExampleTime(),
+						},
+					}
+				},
+				Handler: func(tlbx app.Tlbx, a interface{}) interface{} {
+					args := a.(*user.AdminGetEmailHistory)
+					mustBeAdmin(tlbx)
+					app.BadReqIf(args.Limit < 1 || args.Limit > 100, "limit must be between 1 and 100")
+					res := make([]*user.EmailChange, 0, args.Limit)
+					service.Get(tlbx).User().MustGetN(&res, qryEmailChangesGet(), args.User, args.Limit)
+					return res
+				},
+			})
+	}
+	return eps
+}
+
+var (
+	handleRegex  = regexp.MustCompile(`\A[_a-z0-9]{1,20}\z`)
+	handleMinLen = 1
+	handleMaxLen = 20
+	emailRegex   = regexp.MustCompile(`\A.+@.+\..+\z`)
+	emailMaxLen  = 250
+	aliasMaxLen  = 50
+	localeRegex  = regexp.MustCompile(`\A[a-z]{2,8}(-[a-z0-9]{1,8})*\z`)
+	localeMinLen = 2
+	localeMaxLen = 20
+	pwdRegexs    = []*regexp.Regexp{
+		regexp.MustCompile(`[0-9]`),
+		regexp.MustCompile(`[a-z]`),
+		regexp.MustCompile(`[A-Z]`),
+		regexp.MustCompile(`[\w]`),
+	}
+	pwdMinLen              = 8
+	pwdMaxLen              = 100
+	avatarHashLen          = 16
+	searchPrefixMinLen     = 2
+	profileFieldNameMaxLen = 50
+	profileFieldValMaxLen  = 2000
+	// json escapes some runes to 6 bytes, e.g. "<" is "\u003c", this
+	// is the size of the profileFields.val column
+	profileFieldValMaxBytes = 6*profileFieldValMaxLen + 2
+	unlockCodeLen           = 250
+	resetPwdCodeValidFor    = time.Hour
+	exportName              = "export.zip"
+	restoreCodeLen          = 250
+	jinMaxLen               = 10000
+	inviteCodeLen           = 32
+	inviteMaxUses           = uint16(1000)
+	inviteGetLimit          = 100
+	purgeBatchSize          = 100
+	exampleJin              = json.MustFromString(`{"v":1, "saveDir":"/my/save/dir", "startTab":"favourites"}`)
+)
+
+// sends the named email rendered in the users preferred locale, falling
+// back to usermail.DefaultLocale. The requests Accept-Language is only
+// considered when toRequester is true, i.e. the recipient is the
+// authenticated or registering requester, never for emails an admin,
+// inviter or anonymous caller can trigger on someone else's behalf.
+func sendEmail(tlbx app.Tlbx, c *Config, name usermail.Name, sendTo, from, link string, handle, locale *string, toRequester bool) {
+	locales := make([]string, 0, 5)
+	if locale != nil {
+		locales = append(locales, *locale)
+	}
+	if toRequester {
+		locales = append(locales, usermail.ParseAcceptLanguage(tlbx.Req().Header.Get("Accept-Language"))...)
+	}
+	subject, html, txt := c.Emails.Render(name, &usermail.Data{
+		Handle: handle,
+		Link:   link,
+	}, locales...)
+	service.Get(tlbx).Email().MustSend([]string{sendTo}, from, subject, html, txt)
+}
+
+type emailChange struct {
+	user.EmailChange
+	RevertCode *string
+}
+
+type fullUser struct {
+	user.Me
+	Email                  string
+	RegisteredOn           time.Time
+	ActivatedOn            time.Time
+	NewEmail               *string
+	ActivateCode           *string
+	ChangeEmailCode        *string
+	LastPwdResetOn         *time.Time
+	ResetPwdCode           *string
+	LoginLinkCodeCreatedOn *time.Time
+	LoginLinkCode          *string
+	DeletedOn              *time.Time
+	RestoreCode            *string
+	IsAdmin                bool
+	DisabledOn             *time.Time
+	// AvatarExt is the AvatarEncoder.Ext the avatar was stored with
+	AvatarExt *string
+	// AvatarSizes are the comma separated sizes the avatar was stored at
+	AvatarSizes *string
+}
+
+func getUser(tx sql.Tx, email *string, id *ID) *fullUser {
+	PanicIf(email == nil && id == nil, "one of email or id must not be nil")
+	var arg interface{}
+	if email != nil {
+		arg = *email
+	} else {
+		arg = *id
+	}
+	res := &fullUser{}
+	err := tx.Get1(res, qryUserFullGet(id != nil), arg)
+	if sqlh.IsNoRows(err) {
+		return nil
+	}
+	PanicOn(err)
+	return res
+}
+
+func updateUser(tx sql.Tx, user *fullUser) {
+	PanicOn(tryUpdateUser(tx, user))
+}
+
+func tryUpdateUser(tx sql.Tx, user *fullUser) error {
+	_, err := tx.Exec(qryUserUpdate(), user.Email, user.Handle, user.Alias, user.HasAvatar, user.FcmEnabled, user.RegisteredOn, user.ActivatedOn, user.NewEmail, user.ActivateCode, user.ChangeEmailCode, user.LastPwdResetOn, user.ResetPwdCode, user.LoginLinkCodeCreatedOn, user.LoginLinkCode, user.Locale, user.DeletedOn, user.RestoreCode, user.DisabledOn, user.AvatarHash, user.AvatarExt, user.AvatarSizes, user.Discoverable, user.ID)
+	return err
 }
 
 type pwd struct {
-	ID   ID
-	Salt []byte
-	Pwd  []byte
-	N    int
-	R    int
-	P    int
+	ID ID
+	crypt.PwdHash
 }
 
 func getPwd(pwdtx sql.Tx, id ID) *pwd {
@@ -1112,20 +2283,890 @@ func getPwd(pwdtx sql.Tx, id ID) *pwd {
 	return res
 }
 
-func setPwd(tlbx app.Tlbx, pwdtx sql.Tx, id ID, pwd string) {
+func setPwd(tlbx app.Tlbx, c *Config, pwdtx sql.Tx, id ID, pwd string) {
 	validate.Str("pwd", pwd, pwdMinLen, pwdMaxLen, pwdRegexs...)
-	salt := crypt.Bytes(scryptSaltLen)
-	pwdBs := crypt.ScryptKey([]byte(pwd), salt, scryptN, scryptR, scryptP, scryptKeyLen)
-	_, err := pwdtx.Exec(qryPwdUpdate(), id, salt, pwdBs, scryptN, scryptR, scryptP)
+	hash := c.PwdHasher.Hash([]byte(pwd))
+	_, err := pwdtx.Exec(qryPwdUpdate(), id, hash.Alg, hash.Salt, hash.Pwd, hash.N, hash.R, hash.P)
 	PanicOn(err)
 }
 
-func getJin(tx sql.Tx, me ID, dst interface{}) {
-	if js, ok := dst.(*json.Json); ok {
-		sqlh.PanicIfIsntNoRows(tx.Get1(js, qryJinSelect(), me))
-	} else {
-		bs := []byte{}
-		sqlh.PanicIfIsntNoRows(tx.Get1(&bs, qryJinSelect(), me))
-		json.MustUnmarshal(bs, &dst)
+// validates pwd and checks it against c.PwdPolicy, failures are 400s
+// ending with the pwdpolicy.Reason so clients can explain them.
+func checkPwdPolicy(c *Config, pwd, email string, handle *string) {
+	validate.Str("pwd", pwd, pwdMinLen, pwdMaxLen, pwdRegexs...)
+	if c.PwdPolicy == nil {
+		return
+	}
+	reason := c.PwdPolicy.Check(pwd, email, handle)
+	app.BadReqIf(reason != pwdpolicy.OK, "pwd does not satisfy policy: %s", reason)
+}
+
+func pwdMatches(c *Config, pwd *pwd, attempt string) bool {
+	return pwd != nil && crypt.VerifyPwd([]byte(attempt), &pwd.PwdHash, append([]crypt.PwdHasher{c.PwdHasher}, c.OldPwdHashers...)...)
+}
+
+type exportUser struct {
+	user.Me
+	Email        string    `json:"email"`
+	RegisteredOn time.Time `json:"registeredOn"`
+	ActivatedOn  time.Time `json:"activatedOn"`
+	NewEmail     *string   `json:"newEmail,omitempty"`
+}
+
+type exportFCMToken struct {
+	Topic     string    `json:"topic"`
+	Token     string    `json:"token"`
+	Client    ID        `json:"client"`
+	CreatedOn time.Time `json:"createdOn"`
+}
+
+// exports me in the background emailing a time limited download link when
+// it is ready, users may only request one every ExportAsyncMinInterval.
+func exportAsync(tlbx app.Tlbx, c *Config, enableJin, enableFCM bool, fromEmail string, me ID) {
+	cnn := service.Get(tlbx).Cache().Get()
+	defer cnn.Close()
+	ok, err := redis.String(cnn.Do("SET", exportThrottleKey(me), 1, "PX", c.ExportAsyncMinInterval.Milliseconds(), "NX"))
+	if err != nil && err != redis.ErrNil {
+		PanicOn(err)
+	}
+	app.ReturnIf(ok != "OK", http.StatusTooManyRequests, "export already requested, you may request another after %s", c.ExportAsyncMinInterval)
+	app.Async(tlbx, func(tlbx app.Tlbx) {
+		srv := service.Get(tlbx)
+		tx := srv.User().BeginRead()
+		defer tx.Rollback()
+		user := getUser(tx, nil, &me)
+		tx.Commit()
+		// spool to a temp file as the store needs the size up front
+		f, err := os.CreateTemp("", "export_*.zip")
+		PanicOn(err)
+		defer os.Remove(f.Name())
+		defer f.Close()
+		writeExport(tlbx, c, enableJin, enableFCM, me, f)
+		size, err := f.Seek(0, io.SeekCurrent)
+		PanicOn(err)
+		_, err = f.Seek(0, io.SeekStart)
+		PanicOn(err)
+		key := store.GenKey(ExportPrefix, me)
+		srv.Store().MustStreamUp(
+			ExportBucket,
+			key,
+			exportName,
+			"application/zip",
+			size,
+			false,
+			true,
+			c.ExportUploadTimeout,
+			f)
+		link := srv.Store().MustPresignedGetUrlExpires(ExportBucket, key, exportName, true, c.ExportLinkValidFor)
+		sendEmail(tlbx, c, usermail.Export, user.Email, fromEmail, link, user.Handle, user.Locale, true)
+	})
+}
+
+// exportBuffer holds an export of at most max bytes, writes that would
+// exceed it fail and set over.
+type exportBuffer struct {
+	bytes.Buffer
+	max  int64
+	over bool
+}
+
+var errExportTooLarge = ToError("export too large")
+
+func (b *exportBuffer) Write(p []byte) (int, error) {
+	if int64(b.Len()+len(p)) > b.max {
+		b.over = true
+		return 0, errExportTooLarge
+	}
+	return b.Buffer.Write(p)
+}
+
+// writes a zip of everything stored about me to w, user.json is always
+// present, jin.json, avatar.png and fcm.json only if they have content,
+// then anything added by OnExport.
+func writeExport(tlbx app.Tlbx, c *Config, enableJin, enableFCM bool, me ID, w io.Writer) {
+	srv := service.Get(tlbx)
+	tx := srv.User().BeginRead()
+	defer tx.Rollback()
+	zw := zip.NewWriter(w)
+	addJson := func(name string, v interface{}) {
+		f, err := zw.Create(name)
+		PanicOn(err)
+		_, err = f.Write(json.MustMarshalIndent(v, "", "  "))
+		PanicOn(err)
+	}
+	u := getUser(tx, nil, &me)
+	u.Profile = getProfiles(tx, c, IDs{me}, user.ProfilePrivate)[me]
+	addJson("user.json", &exportUser{
+		Me:           u.Me,
+		Email:        u.Email,
+		RegisteredOn: u.RegisteredOn,
+		ActivatedOn:  u.ActivatedOn,
+		NewEmail:     u.NewEmail,
+	})
+	if enableJin {
+		jin := &user.Jin{}
+		sqlh.PanicIfIsntNoRows(tx.Get1(jin, qryJinSelect(false), me))
+		if jin.Val != nil {
+			addJson("jin.json", jin.Val)
+		}
+	}
+	if enableFCM {
+		tokens := make([]*exportFCMToken, 0, 5)
+		tx.MustGetN(&tokens, qryFCMTokensGet(), me)
+		if len(tokens) > 0 {
+			addJson("fcm.json", tokens)
+		}
+	}
+	tx.Commit()
+	if u.HasAvatar != nil && *u.HasAvatar {
+		_, _, _, content := srv.Store().MustGet(AvatarBucket, avatarKey(u, avatarSize(c, u, nil)))
+		defer content.Close()
+		f, err := zw.Create("avatar." + avatarExt(u))
+		PanicOn(err)
+		_, err = io.Copy(f, content)
+		PanicOn(err)
+	}
+	if c.OnExport != nil {
+		c.OnExport(tlbx, me, zw)
+	}
+	PanicOn(zw.Close())
+}
+
+// AvatarEncoder encodes each resized avatar, Ext is stored with the
+// users avatarHash and used in store keys and the avatar name in exports,
+// so the encoder can be changed without breaking existing avatars.
+type AvatarEncoder interface {
+	MimeType() string
+	Ext() string
+	Encode(w io.Writer, img image.Image) error
+}
+
+var (
+	AvatarPNG  AvatarEncoder = &avatarEncoder{mimeType: "image/png", ext: "png", encode: png.Encode}
+	AvatarWebP AvatarEncoder = &avatarEncoder{mimeType: webp.MimeType, ext: "webp", encode: webp.Encode}
+)
+
+type avatarEncoder struct {
+	mimeType string
+	ext      string
+	encode   func(w io.Writer, img image.Image) error
+}
+
+func (e *avatarEncoder) MimeType() string {
+	return e.mimeType
+}
+
+func (e *avatarEncoder) Ext() string {
+	return e.ext
+}
+
+func (e *avatarEncoder) Encode(w io.Writer, img image.Image) error {
+	return e.encode(w, img)
+}
+
+// replaces the users avatar with content resized to each of c.AvatarSizes,
+// empty content removes it. The new avatar is stored before the users row
+// is updated and the old one is only deleted once that has committed, so
+// a failed upload leaves the old avatar intact.
+func setAvatar(tlbx app.Tlbx, c *Config, onSetSocials func(app.Tlbx, *user.User), me ID, content []byte) {
+	srv := service.Get(tlbx)
+	tx := srv.User().BeginWrite()
+	defer tx.Rollback()
+	u := getUser(tx, nil, &me)
+	hadAvatar := *u.HasAvatar
+	oldHash := u.AvatarHash
+	oldKeys := avatarKeys(c, u)
+	u.HasAvatar = ptr.Bool(len(content) > 0)
+	u.AvatarHash = nil
+	u.AvatarExt = nil
+	u.AvatarSizes = nil
+	if len(content) > 0 {
+		avatar := decodeAvatar(content)
+		hash := sha256.Sum256(content)
+		u.AvatarHash = ptr.String(hex.EncodeToString(hash[:avatarHashLen/2]))
+		u.AvatarExt = ptr.String(c.AvatarEncoder.Ext())
+		sizes := make([]string, 0, len(c.AvatarSizes))
+		for _, size := range c.AvatarSizes {
+			sizes = append(sizes, strconv.Itoa(size))
+		}
+		u.AvatarSizes = ptr.String(strings.Join(sizes, ","))
+		for _, size := range c.AvatarSizes {
+			resized := avatar
+			if b := avatar.Bounds(); b.Dx() != size || b.Dy() != size {
+				resized = imaging.Fill(avatar, size, size, imaging.Center, imaging.Lanczos)
+			}
+			buf := &bytes.Buffer{}
+			PanicOn(c.AvatarEncoder.Encode(buf, resized))
+			srv.Store().MustPut(
+				AvatarBucket,
+				avatarKey(u, size),
+				Strf("avatar_%d.%s", size, *u.AvatarExt),
+				c.AvatarEncoder.MimeType(),
+				int64(buf.Len()),
+				true,
+				false,
+				bytes.NewReader(buf.Bytes()))
+		}
+	}
+	if onSetSocials != nil && (hadAvatar != *u.HasAvatar || ptr.StringOr(oldHash, "") != ptr.StringOr(u.AvatarHash, "")) {
+		onSetSocials(tlbx, &u.User)
+	}
+	updateUser(tx, u)
+	tx.Commit()
+	newKeys := map[string]bool{}
+	for _, key := range avatarKeys(c, u) {
+		newKeys[key] = true
+	}
+	for _, key := range oldKeys {
+		// the same content is stored at the same keys
+		if !newKeys[key] {
+			tlbx.Log().ErrorOn(srv.Store().Delete(AvatarBucket, key))
+		}
+	}
+}
+
+// decodes content applying any exif orientation, animated gifs are
+// flattened to their first frame drawn on their full canvas so the result
+// doesn't depend on the first frames bounds.
+func decodeAvatar(content []byte) image.Image {
+	if bytes.HasPrefix(content, []byte("GIF8")) {
+		g, err := gif.DecodeAll(bytes.NewReader(content))
+		app.BadReqIf(err != nil || len(g.Image) == 0, "invalid gif")
+		canvas := image.NewNRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+		draw.Draw(canvas, g.Image[0].Bounds(), g.Image[0], g.Image[0].Bounds().Min, draw.Over)
+		return canvas
+	}
+	avatar, err := imaging.Decode(bytes.NewReader(content), imaging.AutoOrientation(true))
+	app.BadReqIf(err != nil, "invalid image")
+	return avatar
+}
+
+// deletes every size of the users avatar.
+func deleteAvatar(tlbx app.Tlbx, c *Config, u *fullUser) {
+	srv := service.Get(tlbx)
+	for _, key := range avatarKeys(c, u) {
+		srv.Store().MustDelete(AvatarBucket, key)
+	}
+}
+
+// returns the key of every size of the users avatar, users who set their
+// avatar before multiple sizes were supported have a single key with no
+// hash.
+func avatarKeys(c *Config, u *fullUser) []string {
+	if u.HasAvatar == nil || !*u.HasAvatar {
+		return nil
+	}
+	if u.AvatarHash == nil {
+		return []string{store.GenKey(AvatarPrefix, u.ID)}
+	}
+	sizes := avatarSizes(c, u)
+	keys := make([]string, 0, len(sizes))
+	for _, size := range sizes {
+		keys = append(keys, avatarKey(u, size))
+	}
+	return keys
+}
+
+func avatarKey(u *fullUser, size int) string {
+	if u.AvatarHash == nil {
+		return store.GenKey(AvatarPrefix, u.ID)
+	}
+	return Strf("%s/%s_%d.%s", store.GenKey(AvatarPrefix, u.ID), *u.AvatarHash, size, avatarExt(u))
+}
+
+// returns the ascending sizes the users avatar was stored at, avatars
+// stored before avatarSizes was recorded are at c.AvatarSizes.
+func avatarSizes(c *Config, u *fullUser) []int {
+	if u.AvatarSizes == nil {
+		return c.AvatarSizes
+	}
+	strs := strings.Split(*u.AvatarSizes, ",")
+	sizes := make([]int, 0, len(strs))
+	for _, str := range strs {
+		size, err := strconv.Atoi(str)
+		PanicOn(err)
+		sizes = append(sizes, size)
+	}
+	return sizes
+}
+
+// avatars stored before avatarExt was recorded are all png.
+func avatarExt(u *fullUser) string {
+	return ptr.StringOr(u.AvatarExt, AvatarPNG.Ext())
+}
+
+// returns the smallest size the users avatar was stored at that is at
+// least size, or the largest if size is nil or bigger than all of them.
+func avatarSize(c *Config, u *fullUser, size *int) int {
+	sizes := avatarSizes(c, u)
+	if size != nil {
+		for _, s := range sizes {
+			if s >= *size {
+				return s
+			}
+		}
+	}
+	return sizes[len(sizes)-1]
+}
+
+// PendingDeletionOn returns when the user requested their account be
+// deleted, or nil if they are not pending deletion.
+func PendingDeletionOn(tlbx app.Tlbx, id ID) *time.Time {
+	tx := service.Get(tlbx).User().BeginRead()
+	defer tx.Rollback()
+	user := getUser(tx, nil, &id)
+	tx.Commit()
+	if user == nil {
+		return nil
+	}
+	return user.DeletedOn
+}
+
+func mustBeAbleToLogin(user *fullUser) {
+	app.ReturnIf(user.DisabledOn != nil, http.StatusForbidden, "account is disabled")
+	app.ReturnIf(user.DeletedOn != nil, http.StatusForbidden, "account is pending deletion, use the emailed restore link to restore it")
+}
+
+// returns the current users id if they are an admin, admins can only be
+// made by setting users.isAdmin directly in the db.
+func mustBeAdmin(tlbx app.Tlbx) ID {
+	me := me.AuthedGet(tlbx)
+	tx := service.Get(tlbx).User().BeginRead()
+	defer tx.Rollback()
+	u := getUser(tx, nil, &me)
+	tx.Commit()
+	app.ReturnIf(u == nil || !u.IsAdmin, http.StatusForbidden, "")
+	return me
+}
+
+func adminAudit(tlbx app.Tlbx, tx sql.Tx, admin, user ID, action string) {
+	tx.MustExec(qryAdminAuditInsert(), tlbx.NewID(), admin, user, action, tlbx.Start())
+	tlbx.Log().Info("admin %s performed %s on user %s", admin, action, user)
+}
+
+// returns the current users id if they are an admin or c.CanInvite
+// returns true for them.
+func mustBeAbleToInvite(tlbx app.Tlbx, c *Config) ID {
+	me := me.AuthedGet(tlbx)
+	if c.CanInvite != nil && c.CanInvite(tlbx, me) {
+		return me
+	}
+	tx := service.Get(tlbx).User().BeginRead()
+	defer tx.Rollback()
+	u := getUser(tx, nil, &me)
+	tx.Commit()
+	app.ReturnIf(u == nil || !u.IsAdmin, http.StatusForbidden, "")
+	return me
+}
+
+// consumes one use of the invite, invites sent to an email can only be
+// used to register that email.
+func useInvite(tx sql.Tx, code, email string) {
+	inv := &user.Invite{}
+	err := tx.Get1(inv, qryInviteGetForUpdate(), code)
+	if !sqlh.IsNoRows(err) {
+		PanicOn(err)
+	}
+	app.BadReqIf(sqlh.IsNoRows(err) ||
+		inv.Uses >= inv.MaxUses ||
+		!inv.ExpiresOn.After(Now()) ||
+		(inv.Email != nil && !strings.EqualFold(*inv.Email, email)), "invite code invalid")
+	tx.MustExec(qryInviteUse(), code)
+}
+
+func exampleInvite() *user.Invite {
+	return &user.Invite{
+		Code:      "123abc",
+		CreatedBy: app.ExampleID(),
+		CreatedOn: app.ExampleTime(),
+		Email:     ptr.String("joe@bloggs.example"),
+		MaxUses:   1,
+		Uses:      0,
+		ExpiresOn: app.ExampleTime(),
+	}
+}
+
+// RateLimitRules are stricter ratelimit rules for the endpoints that
+// send emails to arbitrary addresses or check pwds, pass them in
+// ratelimit.Config.Rules.
+func RateLimitRules() []*ratelimit.Rule {
+	return []*ratelimit.Rule{
+		{
+			Name: "user-email",
+			Paths: []string{
+				(&user.Register{}).Path(),
+				(&user.ResendActivateLink{}).Path(),
+				(&user.SendLoginLinkEmail{}).Path(),
+				(&user.ResetPwd{}).Path(),
+				(&user.ChangeEmail{}).Path(),
+				(&user.ResendChangeEmailLink{}).Path(),
+				(&user.CreateInvite{}).Path(),
+			},
+			Cost: 5,
+			Windows: []*ratelimit.Window{
+				{Period: time.Minute, Limit: 5},
+				{Period: time.Hour, Limit: 30},
+			},
+		},
+		{
+			Name: "user-pwd",
+			Paths: []string{
+				(&user.Login{}).Path(),
+				(&user.LoginLinkLogin{}).Path(),
+				(&user.SetPwd{}).Path(),
+				(&user.ConfirmResetPwd{}).Path(),
+				(&user.Delete{}).Path(),
+			},
+			Cost: 2,
+			Windows: []*ratelimit.Window{
+				{Period: time.Second, Limit: 2},
+				{Period: time.Minute, Limit: 20},
+			},
+		},
+	}
+}
+
+func mustBeValidProfileFields(fs []*ProfileField) {
+	names := make(map[string]bool, len(fs))
+	for _, f := range fs {
+		PanicIf(f.Name == "" || len(f.Name) > profileFieldNameMaxLen, "invalid profile field name %q", f.Name)
+		PanicIf(names[f.Name], "duplicate profile field name %s", f.Name)
+		names[f.Name] = true
+		switch f.Type {
+		case user.ProfileString, user.ProfileInt, user.ProfileFloat, user.ProfileBool:
+		default:
+			PanicIf(true, "invalid profile field %s type %q", f.Name, f.Type)
+		}
+		switch f.Visibility {
+		case user.ProfilePrivate, user.ProfileAuthed, user.ProfilePublic:
+		default:
+			PanicIf(true, "invalid profile field %s visibility %q", f.Name, f.Visibility)
+		}
+		PanicIf(f.MaxLen < 0 || f.MaxLen > profileFieldValMaxLen, "invalid profile field %s max len %d", f.Name, f.MaxLen)
+	}
+}
+
+func getProfileField(c *Config, name string) *ProfileField {
+	for _, f := range c.ProfileFields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func profileFieldDefs(c *Config) []*user.ProfileField {
+	res := make([]*user.ProfileField, 0, len(c.ProfileFields))
+	for _, f := range c.ProfileFields {
+		pf := f.ProfileField
+		res = append(res, &pf)
+	}
+	return res
+}
+
+// returns true if fields with visibility v should be included in a
+// response that may contain fields up to visibility max.
+func profileVisible(v, max string) bool {
+	switch max {
+	case user.ProfilePrivate:
+		return true
+	case user.ProfileAuthed:
+		return v != user.ProfilePrivate
+	default:
+		return v == user.ProfilePublic
+	}
+}
+
+func exampleProfile(c *Config, visibility string) map[string]interface{} {
+	if len(c.ProfileFields) == 0 {
+		return nil
+	}
+	res := map[string]interface{}{}
+	for _, f := range c.ProfileFields {
+		if f.Example != nil && profileVisible(f.Visibility, visibility) {
+			res[f.Name] = f.Example
+		}
+	}
+	return res
+}
+
+// checks val is of f.Type and returns it as that type, json numbers
+// are float64 so ints are converted to int64.
+func profileValue(f *ProfileField, val interface{}) interface{} {
+	switch f.Type {
+	case user.ProfileString:
+		str, ok := val.(string)
+		app.BadReqIf(!ok, "profile field %s must be a string", f.Name)
+		maxLen := f.MaxLen
+		if maxLen == 0 {
+			maxLen = profileFieldValMaxLen
+		}
+		validate.Str(f.Name, str, 0, maxLen)
+		return str
+	case user.ProfileInt:
+		switch n := val.(type) {
+		case int64:
+			return n
+		case float64:
+			app.BadReqIf(n != math.Trunc(n) || math.Abs(n) > 1<<53, "profile field %s must be an int", f.Name)
+			return int64(n)
+		}
+		app.BadReqIf(true, "profile field %s must be an int", f.Name)
+	case user.ProfileFloat:
+		n, ok := val.(float64)
+		app.BadReqIf(!ok, "profile field %s must be a number", f.Name)
+		return n
+	case user.ProfileBool:
+		b, ok := val.(bool)
+		app.BadReqIf(!ok, "profile field %s must be a bool", f.Name)
+		return b
+	}
+	return nil
+}
+
+type queryer interface {
+	MustQuery(rowsFn func(*sqlx.Rows), query string, args ...interface{})
+}
+
+// returns the profile fields visible at visibility for each user in ids,
+// users with no visible fields set are not in the returned map, stored
+// values for fields no longer in c.ProfileFields are ignored.
+func getProfiles(q queryer, c *Config, ids IDs, visibility string) map[ID]map[string]interface{} {
+	res := map[ID]map[string]interface{}{}
+	if len(c.ProfileFields) == 0 || len(ids) == 0 {
+		return res
+	}
+	q.MustQuery(func(r *sqlx.Rows) {
+		for r.Next() {
+			var id ID
+			var name string
+			var bs []byte
+			PanicOn(r.Scan(&id, &name, &bs))
+			f := getProfileField(c, name)
+			if f == nil || !profileVisible(f.Visibility, visibility) {
+				continue
+			}
+			var val interface{}
+			json.MustUnmarshal(bs, &val)
+			if f.Type == user.ProfileInt {
+				if n, ok := val.(float64); ok {
+					val = int64(n)
+				}
+			}
+			if res[id] == nil {
+				res[id] = map[string]interface{}{}
+			}
+			res[id][name] = val
+		}
+	}, qryProfileFieldsGet(len(ids)), ids.ToIs()...)
+	return res
+}
+
+func searchFilterDefs() filter.Base {
+	return filter.Defs(true, 20, 100, user.SortHandle, user.SortAlias)
+}
+
+// returns 429 once the user has made more than c.SearchPerMinute searches
+// in the current minute, redis errors are logged and ignored.
+func searchRateLimit(tlbx app.Tlbx, c *Config, me ID) {
+	if c.SearchPerMinute < 1 {
+		return
+	}
+	cnn := service.Get(tlbx).Cache().Get()
+	defer cnn.Close()
+	key := Strf("user_search_%s", me)
+	n, err := incrWithExpiry(cnn, key, 60)
+	if err != nil {
+		tlbx.Log().ErrorOn(err)
+		return
+	}
+	app.ReturnIf(n > c.SearchPerMinute, http.StatusTooManyRequests, "too many searches, max %d per minute", c.SearchPerMinute)
+}
+
+// sets the expiry and incrs atomically so a failure between them can't
+// leave a key that never expires.
+func incrWithExpiry(cnn redis.Conn, key string, seconds int) (int, error) {
+	if err := cnn.Send("MULTI"); err != nil {
+		return 0, err
+	}
+	if err := cnn.Send("SET", key, 0, "EX", seconds, "NX"); err != nil {
+		return 0, err
+	}
+	if err := cnn.Send("INCR", key); err != nil {
+		return 0, err
+	}
+	results, err := redis.Values(cnn.Do("EXEC"))
+	if err != nil {
+		return 0, err
+	}
+	return redis.Int(results[1], nil)
+}
+
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+}
+
+func (u *fullUser) toAdminUser() *user.AdminUser {
+	res := &user.AdminUser{
+		Me:           u.Me,
+		Email:        u.Email,
+		NewEmail:     u.NewEmail,
+		RegisteredOn: u.RegisteredOn,
+		IsAdmin:      u.IsAdmin,
+		DisabledOn:   u.DisabledOn,
+		DeletedOn:    u.DeletedOn,
+	}
+	if u.ActivateCode == nil {
+		res.ActivatedOn = ptr.Time(u.ActivatedOn)
+	}
+	return res
+}
+
+func exampleAdminUser() *user.AdminUser {
+	ex := &user.AdminUser{
+		Email:        "joe@bloggs.example",
+		RegisteredOn: app.ExampleTime(),
+		ActivatedOn:  ptr.Time(app.ExampleTime()),
+	}
+	ex.ID = app.ExampleID()
+	ex.Handle = ptr.String("bloe_joggs")
+	ex.Alias = ptr.String("Joe Bloggs")
+	return ex
+}
+
+// permanently removes the user, jin and fcm tokens tables are cleared by
+// foreign key cascade.
+func deleteUser(tlbx app.Tlbx, c *Config, onDelete func(app.Tlbx, ID), id ID) {
+	srv := service.Get(tlbx)
+	tx := srv.User().BeginWrite()
+	defer tx.Rollback()
+	pwdtx := srv.Pwd().BeginWrite()
+	defer pwdtx.Rollback()
+	if u := getUser(tx, nil, &id); u != nil {
+		deleteAvatar(tlbx, c, u)
+	}
+	tx.MustExec(qryUserDelete(), id)
+	pwdtx.MustExec(qryPwdDelete(), id)
+	// exports bucket may not exist if the app never used exports
+	tlbx.Log().ErrorOn(srv.Store().Delete(ExportBucket, store.GenKey(ExportPrefix, id)))
+	if onDelete != nil {
+		onDelete(tlbx, id)
+	}
+	tx.Commit()
+	pwdtx.Commit()
+}
+
+// purges accounts whose grace period has expired, at most once every
+// DeletePurgeInterval across all app instances.
+func purge(tlbx app.Tlbx, c *Config, onDelete func(app.Tlbx, ID)) {
+	cnn := service.Get(tlbx).Cache().Get()
+	defer cnn.Close()
+	ok, err := redis.String(cnn.Do("SET", purgeKey, 1, "PX", c.DeletePurgeInterval.Milliseconds(), "NX"))
+	if err != nil {
+		if err != redis.ErrNil {
+			tlbx.Log().ErrorOn(err)
+		}
+		return
+	}
+	if ok != "OK" {
+		return
+	}
+	for {
+		ids := make([]ID, 0, purgeBatchSize)
+		service.Get(tlbx).User().MustGetN(&ids, qryUsersToPurge(), Now().Add(-c.DeleteGracePeriod), purgeBatchSize)
+		for _, id := range ids {
+			deleteUser(tlbx, c, onDelete, id)
+		}
+		if len(ids) < purgeBatchSize {
+			return
+		}
+	}
+}
+
+func exportThrottleKey(me ID) string {
+	return Strf("user_export_%s", me)
+}
+
+// returns the current jin locked for update, or a 409 if rev is given and
+// does not match the current revision.
+func getJinForUpdate(tx sql.Tx, me ID, rev *uint64) *user.Jin {
+	res := &user.Jin{}
+	sqlh.PanicIfIsntNoRows(tx.Get1(res, qryJinSelect(true), me))
+	app.ReturnIf(rev != nil && *rev != res.Rev, http.StatusConflict, "jin revision mismatch, current revision is %d", res.Rev)
+	return res
+}
+
+// writes jin incrementing its revision, a nil val is stored as NULL rather
+// than deleting the row so revisions never repeat.
+func setJin(tx sql.Tx, me ID, jin *user.Jin) {
+	jin.Rev++
+	var val []byte
+	if jin.Val != nil {
+		val = jin.Val.MustToBytes()
+		app.ReturnIf(len(val) > jinMaxLen, http.StatusRequestEntityTooLarge, "jin must not exceed %d bytes", jinMaxLen)
+	}
+	tx.MustExec(qryJinUpsert(), me, jin.Rev, val)
+}
+
+func config(configs ...func(*Config)) *Config {
+	c := &Config{
+		LockoutAccountMaxFails: 5,
+		LockoutIPMaxFails:      50,
+		LockoutWindow:          time.Hour,
+		LockoutBase:            time.Minute,
+		LockoutMax:             24 * time.Hour,
+		UnlockFmtLink:          "",
+		PwdHasher:              crypt.NewArgon2idHasher(3, 64*1024, 2, 16, 32),
+		OldPwdHashers: []crypt.PwdHasher{
+			crypt.NewScryptHasher(32768, 8, 1, 256, 256),
+		},
+		Emails:                    usermail.Default(),
+		OnExport:                  nil,
+		ExportMaxSyncSize:         10 * app.MB,
+		ExportLinkValidFor:        24 * time.Hour,
+		ExportAsyncMinInterval:    time.Hour,
+		ExportUploadTimeout:       10 * time.Minute,
+		DeleteGracePeriod:         14 * 24 * time.Hour,
+		DeletePurgeInterval:       time.Hour,
+		RestoreFmtLink:            "",
+		EnableAdmin:               false,
+		RegistrationMode:          RegistrationOpen,
+		CanInvite:                 nil,
+		InviteMaxValidFor:         30 * 24 * time.Hour,
+		InviteFmtLink:             "",
+		RequirePow:                false,
+		PowConfigs:                nil,
+		RevertChangeEmailFmtLink:  "",
+		RevertChangeEmailValidFor: 7 * 24 * time.Hour,
+		SearchPerMinute:           30,
+		AvatarSizes:               []int{32, 64, 250},
+		AvatarEncoder:             AvatarPNG,
+		PwdPolicy: &pwdpolicy.Policy{
+			DisallowEmail:  true,
+			DisallowHandle: true,
+		},
+	}
+	for _, config := range configs {
+		config(c)
+	}
+	return c
+}
+
+func lockoutAccKey(id ID) string {
+	return Strf("user_lockout_acc_%s", id)
+}
+
+func lockoutIPKey(tlbx app.Tlbx) string {
+	return Strf("user_lockout_ip_%s", tlbx.IP())
+}
+
+func lockoutUnlockKey(id ID) string {
+	return Strf("user_lockout_unlock_%s", id)
+}
+
+func lockoutFailsKey(key string) string {
+	return key + "_fails"
+}
+
+// returns StatusLocked if the key is currently locked.
+func lockoutMustNotBeLocked(tlbx app.Tlbx, key string) {
+	if ms := lockoutLockedFor(tlbx, key); ms > 0 {
+		secs := int64(math.Ceil(float64(ms) / 1000))
+		tlbx.Resp().Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+		app.ReturnIf(true, http.StatusLocked, "too many failed attempts, locked for %d seconds", secs)
+	}
+}
+
+// returns the ms the key is locked for, redis errors are logged and
+// treated as not locked, same as the ratelimit mware.
+func lockoutLockedFor(tlbx app.Tlbx, key string) int64 {
+	cnn := service.Get(tlbx).Cache().Get()
+	defer cnn.Close()
+	ms, err := redis.Int64(cnn.Do("PTTL", key))
+	if err != nil {
+		tlbx.Log().ErrorOn(err)
+		return 0
+	}
+	return ms
+}
+
+// records a failed attempt against the requests ip and, if user is not nil,
+// against the users account, locking either once they reach their max fails.
+func lockoutFail(tlbx app.Tlbx, c *Config, srv service.Layer, fromEmail string, user *fullUser) {
+	lockoutIncr(tlbx, c, lockoutIPKey(tlbx), c.LockoutIPMaxFails)
+	if user == nil {
+		return
+	}
+	justLocked := lockoutIncr(tlbx, c, lockoutAccKey(user.ID), c.LockoutAccountMaxFails)
+	if !justLocked || c.UnlockFmtLink == "" {
+		return
+	}
+	code := crypt.UrlSafeString(unlockCodeLen)
+	cnn := srv.Cache().Get()
+	defer cnn.Close()
+	_, err := cnn.Do("SET", lockoutUnlockKey(user.ID), code, "PX", c.LockoutMax.Milliseconds())
+	if err != nil {
+		tlbx.Log().ErrorOn(err)
+		return
+	}
+	sendEmail(tlbx, c, usermail.Unlock, user.Email, fromEmail, Strf(c.UnlockFmtLink, user.ID, code), user.Handle, user.Locale, false)
+}
+
+// returns true if this call transitioned the key into the locked state.
+func lockoutIncr(tlbx app.Tlbx, c *Config, key string, maxFails int) bool {
+	if maxFails < 1 {
+		return false
+	}
+	cnn := service.Get(tlbx).Cache().Get()
+	defer cnn.Close()
+	failsKey := lockoutFailsKey(key)
+	fails, err := redis.Int(cnn.Do("INCR", failsKey))
+	if err != nil {
+		tlbx.Log().ErrorOn(err)
+		return false
+	}
+	if fails == 1 {
+		_, err = cnn.Do("PEXPIRE", failsKey, c.LockoutWindow.Milliseconds())
+		tlbx.Log().ErrorOn(err)
+	}
+	if fails < maxFails {
+		return false
+	}
+	dur := c.LockoutBase
+	for i := maxFails; i < fails && dur < c.LockoutMax; i++ {
+		dur *= 2
+	}
+	if dur > c.LockoutMax {
+		dur = c.LockoutMax
+	}
+	_, err = cnn.Do("SET", key, 1, "PX", dur.Milliseconds())
+	if err != nil {
+		tlbx.Log().ErrorOn(err)
+		return false
+	}
+	// keep the fails count alive for at least as long as the lock so the
+	// next failure after the lock expires backs off further
+	_, err = cnn.Do("PEXPIRE", failsKey, (dur + c.LockoutWindow).Milliseconds())
+	tlbx.Log().ErrorOn(err)
+	tlbx.Log().Warning("lockout: %s locked for %s after %d failed attempts", key, dur, fails)
+	tlbx.LogActionStats(&app.ActionStats{
+		Type:   "LOCKOUT",
+		Name:   key,
+		Action: Strf("LOCK %d %s", fails, dur),
+	})
+	return fails == maxFails
+}
+
+// clears the accounts lock and fails count, and if clearIPFails is true
+// the requests ip fails count, used on successful logins.
+func lockoutClear(tlbx app.Tlbx, id ID, clearIPFails bool) {
+	accKey := lockoutAccKey(id)
+	keys := []interface{}{accKey, lockoutFailsKey(accKey), lockoutUnlockKey(id)}
+	if clearIPFails {
+		keys = append(keys, lockoutFailsKey(lockoutIPKey(tlbx)))
 	}
+	cnn := service.Get(tlbx).Cache().Get()
+	defer cnn.Close()
+	_, err := cnn.Do("DEL", keys...)
+	tlbx.Log().ErrorOn(err)
 }
@@ -1,4 +1,6 @@
+{% import . "github.com/0xor1/tlbx/pkg/core" %}
 {% import "github.com/0xor1/tlbx/pkg/sqlh" %}
+{% import "github.com/0xor1/tlbx/pkg/web/app/user" %}
 
 {%- func qryUserFullGet(byID bool) -%}
 {%- collapsespace -%}
@@ -14,8 +16,18 @@ SELECT id,
     activateCode,
     changeEmailCode,
     lastPwdResetOn,
+    resetPwdCode,
     loginLinkCodeCreatedOn,
-    loginLinkCode
+    loginLinkCode,
+    locale,
+    deletedOn,
+    restoreCode,
+    isAdmin,
+    disabledOn,
+    avatarHash,
+    avatarExt,
+    avatarSizes,
+    discoverable
 FROM users
 WHERE
 {%- if byID -%}
@@ -41,8 +53,17 @@ SET email=?,
     activateCode=?,
     changeEmailCode=?,
     lastPwdResetOn=?,
+    resetPwdCode=?,
     loginLinkCodeCreatedOn=?,
-    loginLinkCode=?
+    loginLinkCode=?,
+    locale=?,
+    deletedOn=?,
+    restoreCode=?,
+    disabledOn=?,
+    avatarHash=?,
+    avatarExt=?,
+    avatarSizes=?,
+    discoverable=?
 WHERE id=?
 {%- endcollapsespace -%}
 {%- endfunc -%}
@@ -56,6 +77,7 @@ INSERT INTO users (
     alias,
     hasAvatar,
     fcmEnabled,
+    discoverable,
     registeredOn,
     activatedOn,
     activateCode
@@ -68,11 +90,20 @@ INSERT INTO users (
     ?,
     ?,
     ?,
+    ?,
     ?
 )
 {%- endcollapsespace -%}
 {%- endfunc -%}
 
+{%- func qryUserDisabledOn() -%}
+{%- collapsespace -%}
+SELECT disabledOn
+FROM users
+WHERE id=?
+{%- endcollapsespace -%}
+{%- endfunc -%}
+
 {%- func qryUserDelete() -%}
 {%- collapsespace -%}
 DELETE FROM users
@@ -83,14 +114,26 @@ WHERE id=?
 {%- func qryUsersGet(n int) -%}
 {%- collapsespace -%}
 SELECT id,
-    handle,
-    alias,
-    hasAvatar
+    IF(deletedOn IS NULL, handle, NULL) AS handle,
+    IF(deletedOn IS NULL, alias, NULL) AS alias,
+    IF(deletedOn IS NULL, hasAvatar, NULL) AS hasAvatar,
+    IF(deletedOn IS NULL, avatarHash, NULL) AS avatarHash
 FROM users
 WHERE id IN ({%s sqlh.PList(n)%})
 {%- endcollapsespace -%}
 {%- endfunc -%}
 
+{%- func qryUsersToPurge() -%}
+{%- collapsespace -%}
+SELECT id
+FROM users
+WHERE deletedOn IS NOT NULL
+AND deletedOn<?
+ORDER BY deletedOn
+LIMIT ?
+{%- endcollapsespace -%}
+{%- endfunc -%}
+
 {%- func qryPwdDelete() -%}
 {%- collapsespace -%}
 DELETE FROM pwds
@@ -101,6 +144,7 @@ WHERE id=?
 {%- func qryPwdGet() -%}
 {%- collapsespace -%}
 SELECT id,
+    alg,
     salt,
     pwd,
     n,
@@ -115,6 +159,7 @@ WHERE id=?
 {%- collapsespace -%}
 INSERT INTO pwds (
     id,
+    alg,
     salt,
     pwd,
     n,
@@ -126,8 +171,10 @@ INSERT INTO pwds (
     ?,
     ?,
     ?,
+    ?,
     ?
 ) ON DUPLICATE KEY UPDATE
+alg=VALUE(alg),
 salt=VALUE(salt),
 pwd=VALUE(pwd),
 n=VALUE(n),
@@ -185,6 +232,18 @@ WHERE user=?
 {%- endcollapsespace -%}
 {%- endfunc -%}
 
+{%- func qryFCMTokensGet() -%}
+{%- collapsespace -%}
+SELECT topic,
+    token,
+    client,
+    createdOn
+FROM fcmTokens
+WHERE user=?
+ORDER BY createdOn
+{%- endcollapsespace -%}
+{%- endfunc -%}
+
 {%- func qryFCMTokensDelete() -%}
 {%- collapsespace -%}
 DELETE FROM fcmTokens
@@ -200,26 +259,33 @@ AND client=?
 {%- endcollapsespace -%}
 {%- endfunc -%}
 
-{%- func qryJinInsert() -%}
+{%- func qryJinUpsert() -%}
 {%- collapsespace -%}
 INSERT INTO jin(
     user,
+    rev,
     val
 )
 VALUES (
+    ?,
     ?,
     ?
 )
 ON DUPLICATE KEY UPDATE 
+rev=VALUES(rev),
 val=VALUES(val)
 {%- endcollapsespace -%}
 {%- endfunc -%}
 
-{%- func qryJinSelect() -%}
+{%- func qryJinSelect(forUpdate bool) -%}
 {%- collapsespace -%}
-SELECT val
+SELECT rev,
+    val
 FROM jin
 WHERE user=?
+{%- if forUpdate -%}
+FOR UPDATE
+{%- endif -%}
 {%- endcollapsespace -%}
 {%- endfunc -%}
 
@@ -228,4 +294,277 @@ WHERE user=?
 Delete FROM jin
 WHERE user=?
 {%- endcollapsespace -%}
+{%- endfunc -%}
+
+{%- func qryUsersFullSearch() -%}
+{%- collapsespace -%}
+SELECT id,
+    email,
+    handle,
+    alias,
+    hasAvatar,
+    fcmEnabled,
+    registeredOn,
+    activatedOn,
+    newEmail,
+    activateCode,
+    changeEmailCode,
+    lastPwdResetOn,
+    resetPwdCode,
+    loginLinkCodeCreatedOn,
+    loginLinkCode,
+    locale,
+    deletedOn,
+    restoreCode,
+    isAdmin,
+    disabledOn,
+    avatarHash,
+    avatarExt,
+    avatarSizes,
+    discoverable
+FROM users
+WHERE email LIKE ?
+OR handle LIKE ?
+ORDER BY email
+LIMIT ?
+{%- endcollapsespace -%}
+{%- endfunc -%}
+
+{%- func qryAdminAuditInsert() -%}
+{%- collapsespace -%}
+INSERT INTO adminAudit (
+    id,
+    admin,
+    user,
+    action,
+    createdOn
+) VALUES (
+    ?,
+    ?,
+    ?,
+    ?,
+    ?
+)
+{%- endcollapsespace -%}
+{%- endfunc -%}
+
+{%- func qryAdminAuditGet(byUser bool) -%}
+{%- collapsespace -%}
+SELECT id,
+    admin,
+    user,
+    action,
+    createdOn
+FROM adminAudit
+{%- if byUser -%}
+WHERE user=?
+{%- endif -%}
+ORDER BY createdOn DESC
+LIMIT ?
+{%- endcollapsespace -%}
+{%- endfunc -%}
+
+{%- func qryInviteInsert() -%}
+{%- collapsespace -%}
+INSERT INTO invites (
+    code,
+    createdBy,
+    createdOn,
+    email,
+    maxUses,
+    uses,
+    expiresOn
+) VALUES (
+    ?,
+    ?,
+    ?,
+    ?,
+    ?,
+    ?,
+    ?
+)
+{%- endcollapsespace -%}
+{%- endfunc -%}
+
+{%- func qryInviteGetForUpdate() -%}
+{%- collapsespace -%}
+SELECT code,
+    createdBy,
+    createdOn,
+    email,
+    maxUses,
+    uses,
+    expiresOn
+FROM invites
+WHERE code=?
+FOR UPDATE
+{%- endcollapsespace -%}
+{%- endfunc -%}
+
+{%- func qryInvitesGet() -%}
+{%- collapsespace -%}
+SELECT code,
+    createdBy,
+    createdOn,
+    email,
+    maxUses,
+    uses,
+    expiresOn
+FROM invites
+WHERE createdBy=?
+ORDER BY createdOn DESC
+LIMIT ?
+{%- endcollapsespace -%}
+{%- endfunc -%}
+
+{%- func qryInviteUse() -%}
+{%- collapsespace -%}
+UPDATE invites
+SET uses=uses+1
+WHERE code=?
+{%- endcollapsespace -%}
+{%- endfunc -%}
+
+{%- func qryInviteDelete() -%}
+{%- collapsespace -%}
+DELETE FROM invites
+WHERE code=?
+AND createdBy=?
+{%- endcollapsespace -%}
+{%- endfunc -%}
+
+{%- func qryEmailChangeInsert() -%}
+{%- collapsespace -%}
+INSERT INTO emailChanges (
+    user,
+    changedOn,
+    oldEmail,
+    newEmail,
+    revertCode
+) VALUES (
+    ?,
+    ?,
+    ?,
+    ?,
+    ?
+)
+{%- endcollapsespace -%}
+{%- endfunc -%}
+
+{%- func qryEmailChangesGetRevertable() -%}
+{%- collapsespace -%}
+SELECT user,
+    oldEmail,
+    newEmail,
+    changedOn,
+    revertedOn,
+    revertCode
+FROM emailChanges
+WHERE user=?
+AND changedOn>?
+AND revertedOn IS NULL
+AND revertCode IS NOT NULL
+ORDER BY changedOn ASC
+FOR UPDATE
+{%- endcollapsespace -%}
+{%- endfunc -%}
+
+{%- func qryEmailChangeRevert() -%}
+{%- collapsespace -%}
+UPDATE emailChanges
+SET revertedOn=?,
+    revertCode=NULL
+WHERE user=?
+AND changedOn>=?
+AND revertedOn IS NULL
+{%- endcollapsespace -%}
+{%- endfunc -%}
+
+{%- func qryEmailChangesGet() -%}
+{%- collapsespace -%}
+SELECT user,
+    oldEmail,
+    newEmail,
+    changedOn,
+    revertedOn
+FROM emailChanges
+WHERE user=?
+ORDER BY changedOn DESC
+LIMIT ?
+{%- endcollapsespace -%}
+{%- endfunc -%}
+
+{%- func qryUsersSearch(sqlArgs *sqlh.Args, args *user.Search) -%}
+{%- collapsespace -%}
+SELECT id,
+    handle,
+    alias,
+    hasAvatar,
+    avatarHash
+FROM users
+WHERE (discoverable IS NULL OR discoverable=1)
+AND handle IS NOT NULL
+AND activatedOn>'0001-01-01'
+AND deletedOn IS NULL
+AND disabledOn IS NULL
+AND (handle LIKE ? OR alias LIKE ?)
+{%- code
+    sqlArgs.Append(likePrefix(StrLower(args.Prefix)), likePrefix(args.Prefix))
+-%}
+{%- if len(args.Base.IDs) > 0 -%}
+    AND id IN ({%s sqlh.PList(len(args.Base.IDs)) %})
+    ORDER BY FIELD (id,{%s sqlh.PList(len(args.Base.IDs)) %})
+    {%- code
+        is := args.Base.IDs.ToIs()
+        sqlArgs.Append(is...)
+        sqlArgs.Append(is...)
+    -%}
+{%- else -%}
+    {%- if args.Base.After != nil -%}
+        AND (COALESCE({%s args.Base.Sort %}, ''), id) {%s= sqlh.GtLtSymbol(*args.Base.Asc) %} (SELECT COALESCE({%s args.Base.Sort %}, ''), id FROM users WHERE id=?)
+        {%- code
+            sqlArgs.Append(*args.Base.After)
+        -%}
+    {%- endif -%}
+    ORDER BY COALESCE({%s args.Base.Sort %}, '') {%s sqlh.Asc(*args.Base.Asc) %}, id {%s sqlh.Asc(*args.Base.Asc) %}
+    LIMIT {%d int(args.Base.Limit)+1 %}
+{%- endif -%}
+{%- endcollapsespace -%}
+{%- endfunc -%}
+
+{%- func qryProfileFieldUpsert() -%}
+{%- collapsespace -%}
+INSERT INTO profileFields(
+    user,
+    name,
+    val
+)
+VALUES (
+    ?,
+    ?,
+    ?
+)
+ON DUPLICATE KEY UPDATE
+val=VALUES(val)
+{%- endcollapsespace -%}
+{%- endfunc -%}
+
+{%- func qryProfileFieldDelete() -%}
+{%- collapsespace -%}
+DELETE FROM profileFields
+WHERE user=?
+AND name=?
+{%- endcollapsespace -%}
+{%- endfunc -%}
+
+{%- func qryProfileFieldsGet(n int) -%}
+{%- collapsespace -%}
+SELECT p.user,
+    p.name,
+    p.val
+FROM profileFields p
+JOIN users u ON u.id=p.user
+WHERE p.user IN ({%s sqlh.PList(n)%})
+AND u.deletedOn IS NULL
+{%- endcollapsespace -%}
 {%- endfunc -%}
\ No newline at end of file
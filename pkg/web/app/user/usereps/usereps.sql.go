@@ -3,8 +3,12 @@
 
 package usereps
 
+import . "github.com/0xor1/tlbx/pkg/core"
+
 import "github.com/0xor1/tlbx/pkg/sqlh"
 
+import "github.com/0xor1/tlbx/pkg/web/app/user"
+
 import (
 	qtio422016 "io"
 
@@ -17,7 +21,7 @@ var (
 )
 
 func streamqryUserFullGet(qw422016 *qt422016.Writer, byID bool) {
-	qw422016.N().S(`SELECT id, email, handle, alias, hasAvatar, fcmEnabled, registeredOn, activatedOn, newEmail, activateCode, changeEmailCode, lastPwdResetOn, loginLinkCodeCreatedOn, loginLinkCode FROM users WHERE `)
+	qw422016.N().S(`SELECT id, email, handle, alias, hasAvatar, fcmEnabled, registeredOn, activatedOn, newEmail, activateCode, changeEmailCode, lastPwdResetOn, resetPwdCode, loginLinkCodeCreatedOn, loginLinkCode, locale, deletedOn, restoreCode, isAdmin, disabledOn, avatarHash, avatarExt, avatarSizes, discoverable FROM users WHERE `)
 	if byID {
 		qw422016.N().S(`id `)
 	} else {
@@ -41,7 +45,7 @@ func qryUserFullGet(byID bool) string {
 }
 
 func streamqryUserUpdate(qw422016 *qt422016.Writer) {
-	qw422016.N().S(`UPDATE users SET email=?, handle=?, alias=?, hasAvatar=?, fcmEnabled=?, registeredOn=?, activatedOn=?, newEmail=?, activateCode=?, changeEmailCode=?, lastPwdResetOn=?, loginLinkCodeCreatedOn=?, loginLinkCode=? WHERE id=? `)
+	qw422016.N().S(`UPDATE users SET email=?, handle=?, alias=?, hasAvatar=?, fcmEnabled=?, registeredOn=?, activatedOn=?, newEmail=?, activateCode=?, changeEmailCode=?, lastPwdResetOn=?, resetPwdCode=?, loginLinkCodeCreatedOn=?, loginLinkCode=?, locale=?, deletedOn=?, restoreCode=?, disabledOn=?, avatarHash=?, avatarExt=?, avatarSizes=?, discoverable=? WHERE id=? `)
 }
 
 func writeqryUserUpdate(qq422016 qtio422016.Writer) {
@@ -59,7 +63,7 @@ func qryUserUpdate() string {
 }
 
 func streamqryUserInsert(qw422016 *qt422016.Writer) {
-	qw422016.N().S(`INSERT INTO users ( id, email, handle, alias, hasAvatar, fcmEnabled, registeredOn, activatedOn, activateCode ) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ? ) `)
+	qw422016.N().S(`INSERT INTO users ( id, email, handle, alias, hasAvatar, fcmEnabled, discoverable, registeredOn, activatedOn, activateCode ) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ? ) `)
 }
 
 func writeqryUserInsert(qq422016 qtio422016.Writer) {
@@ -76,6 +80,24 @@ func qryUserInsert() string {
 	return qs422016
 }
 
+func streamqryUserDisabledOn(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`SELECT disabledOn FROM users WHERE id=? `)
+}
+
+func writeqryUserDisabledOn(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryUserDisabledOn(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryUserDisabledOn() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryUserDisabledOn(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
 func streamqryUserDelete(qw422016 *qt422016.Writer) {
 	qw422016.N().S(`DELETE FROM users WHERE id=? `)
 }
@@ -95,7 +117,7 @@ func qryUserDelete() string {
 }
 
 func streamqryUsersGet(qw422016 *qt422016.Writer, n int) {
-	qw422016.N().S(`SELECT id, handle, alias, hasAvatar FROM users WHERE id IN (`)
+	qw422016.N().S(`SELECT id, IF(deletedOn IS NULL, handle, NULL) AS handle, IF(deletedOn IS NULL, alias, NULL) AS alias, IF(deletedOn IS NULL, hasAvatar, NULL) AS hasAvatar, IF(deletedOn IS NULL, avatarHash, NULL) AS avatarHash FROM users WHERE id IN (`)
 	qw422016.E().S(sqlh.PList(n))
 	qw422016.N().S(`) `)
 }
@@ -114,6 +136,24 @@ func qryUsersGet(n int) string {
 	return qs422016
 }
 
+func streamqryUsersToPurge(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`SELECT id FROM users WHERE deletedOn IS NOT NULL AND deletedOn<? ORDER BY deletedOn LIMIT ? `)
+}
+
+func writeqryUsersToPurge(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryUsersToPurge(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryUsersToPurge() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryUsersToPurge(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
 func streamqryPwdDelete(qw422016 *qt422016.Writer) {
 	qw422016.N().S(`DELETE FROM pwds WHERE id=? `)
 }
@@ -133,7 +173,7 @@ func qryPwdDelete() string {
 }
 
 func streamqryPwdGet(qw422016 *qt422016.Writer) {
-	qw422016.N().S(`SELECT id, salt, pwd, n, r, p FROM pwds WHERE id=? `)
+	qw422016.N().S(`SELECT id, alg, salt, pwd, n, r, p FROM pwds WHERE id=? `)
 }
 
 func writeqryPwdGet(qq422016 qtio422016.Writer) {
@@ -151,7 +191,7 @@ func qryPwdGet() string {
 }
 
 func streamqryPwdUpdate(qw422016 *qt422016.Writer) {
-	qw422016.N().S(`INSERT INTO pwds ( id, salt, pwd, n, r, p ) VALUES ( ?, ?, ?, ?, ?, ? ) ON DUPLICATE KEY UPDATE salt=VALUE(salt), pwd=VALUE(pwd), n=VALUE(n), r=VALUE(r), p=VALUE(p) `)
+	qw422016.N().S(`INSERT INTO pwds ( id, alg, salt, pwd, n, r, p ) VALUES ( ?, ?, ?, ?, ?, ?, ? ) ON DUPLICATE KEY UPDATE alg=VALUE(alg), salt=VALUE(salt), pwd=VALUE(pwd), n=VALUE(n), r=VALUE(r), p=VALUE(p) `)
 }
 
 func writeqryPwdUpdate(qq422016 qtio422016.Writer) {
@@ -240,6 +280,24 @@ func qryDistinctFCMTokens() string {
 	return qs422016
 }
 
+func streamqryFCMTokensGet(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`SELECT topic, token, client, createdOn FROM fcmTokens WHERE user=? ORDER BY createdOn `)
+}
+
+func writeqryFCMTokensGet(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryFCMTokensGet(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryFCMTokensGet() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryFCMTokensGet(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
 func streamqryFCMTokensDelete(qw422016 *qt422016.Writer) {
 	qw422016.N().S(`DELETE FROM fcmTokens WHERE user=? `)
 }
@@ -276,37 +334,40 @@ func qryFCMUnregister() string {
 	return qs422016
 }
 
-func streamqryJinInsert(qw422016 *qt422016.Writer) {
-	qw422016.N().S(`INSERT INTO jin( user, val ) VALUES ( ?, ? ) ON DUPLICATE KEY UPDATE val=VALUES(val) `)
+func streamqryJinUpsert(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`INSERT INTO jin( user, rev, val ) VALUES ( ?, ?, ? ) ON DUPLICATE KEY UPDATE rev=VALUES(rev), val=VALUES(val) `)
 }
 
-func writeqryJinInsert(qq422016 qtio422016.Writer) {
+func writeqryJinUpsert(qq422016 qtio422016.Writer) {
 	qw422016 := qt422016.AcquireWriter(qq422016)
-	streamqryJinInsert(qw422016)
+	streamqryJinUpsert(qw422016)
 	qt422016.ReleaseWriter(qw422016)
 }
 
-func qryJinInsert() string {
+func qryJinUpsert() string {
 	qb422016 := qt422016.AcquireByteBuffer()
-	writeqryJinInsert(qb422016)
+	writeqryJinUpsert(qb422016)
 	qs422016 := string(qb422016.B)
 	qt422016.ReleaseByteBuffer(qb422016)
 	return qs422016
 }
 
-func streamqryJinSelect(qw422016 *qt422016.Writer) {
-	qw422016.N().S(`SELECT val FROM jin WHERE user=? `)
+func streamqryJinSelect(qw422016 *qt422016.Writer, forUpdate bool) {
+	qw422016.N().S(`SELECT rev, val FROM jin WHERE user=? `)
+	if forUpdate {
+		qw422016.N().S(`FOR UPDATE `)
+	}
 }
 
-func writeqryJinSelect(qq422016 qtio422016.Writer) {
+func writeqryJinSelect(qq422016 qtio422016.Writer, forUpdate bool) {
 	qw422016 := qt422016.AcquireWriter(qq422016)
-	streamqryJinSelect(qw422016)
+	streamqryJinSelect(qw422016, forUpdate)
 	qt422016.ReleaseWriter(qw422016)
 }
 
-func qryJinSelect() string {
+func qryJinSelect(forUpdate bool) string {
 	qb422016 := qt422016.AcquireByteBuffer()
-	writeqryJinSelect(qb422016)
+	writeqryJinSelect(qb422016, forUpdate)
 	qs422016 := string(qb422016.B)
 	qt422016.ReleaseByteBuffer(qb422016)
 	return qs422016
@@ -329,3 +390,331 @@ func qryJinDelete() string {
 	qt422016.ReleaseByteBuffer(qb422016)
 	return qs422016
 }
+
+func streamqryUsersFullSearch(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`SELECT id, email, handle, alias, hasAvatar, fcmEnabled, registeredOn, activatedOn, newEmail, activateCode, changeEmailCode, lastPwdResetOn, resetPwdCode, loginLinkCodeCreatedOn, loginLinkCode, locale, deletedOn, restoreCode, isAdmin, disabledOn, avatarHash, avatarExt, avatarSizes, discoverable FROM users WHERE email LIKE ? OR handle LIKE ? ORDER BY email LIMIT ? `)
+}
+
+func writeqryUsersFullSearch(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryUsersFullSearch(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryUsersFullSearch() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryUsersFullSearch(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func streamqryAdminAuditInsert(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`INSERT INTO adminAudit ( id, admin, user, action, createdOn ) VALUES ( ?, ?, ?, ?, ? ) `)
+}
+
+func writeqryAdminAuditInsert(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryAdminAuditInsert(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryAdminAuditInsert() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryAdminAuditInsert(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func streamqryAdminAuditGet(qw422016 *qt422016.Writer, byUser bool) {
+	qw422016.N().S(`SELECT id, admin, user, action, createdOn FROM adminAudit `)
+	if byUser {
+		qw422016.N().S(`WHERE user=? `)
+	}
+	qw422016.N().S(`ORDER BY createdOn DESC LIMIT ? `)
+}
+
+func writeqryAdminAuditGet(qq422016 qtio422016.Writer, byUser bool) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryAdminAuditGet(qw422016, byUser)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryAdminAuditGet(byUser bool) string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryAdminAuditGet(qb422016, byUser)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func streamqryInviteInsert(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`INSERT INTO invites ( code, createdBy, createdOn, email, maxUses, uses, expiresOn ) VALUES ( ?, ?, ?, ?, ?, ?, ? ) `)
+}
+
+func writeqryInviteInsert(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryInviteInsert(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryInviteInsert() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryInviteInsert(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func streamqryInviteGetForUpdate(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`SELECT code, createdBy, createdOn, email, maxUses, uses, expiresOn FROM invites WHERE code=? FOR UPDATE `)
+}
+
+func writeqryInviteGetForUpdate(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryInviteGetForUpdate(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryInviteGetForUpdate() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryInviteGetForUpdate(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func streamqryInvitesGet(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`SELECT code, createdBy, createdOn, email, maxUses, uses, expiresOn FROM invites WHERE createdBy=? ORDER BY createdOn DESC LIMIT ? `)
+}
+
+func writeqryInvitesGet(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryInvitesGet(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryInvitesGet() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryInvitesGet(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func streamqryInviteUse(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`UPDATE invites SET uses=uses+1 WHERE code=? `)
+}
+
+func writeqryInviteUse(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryInviteUse(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryInviteUse() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryInviteUse(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func streamqryInviteDelete(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`DELETE FROM invites WHERE code=? AND createdBy=? `)
+}
+
+func writeqryInviteDelete(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryInviteDelete(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryInviteDelete() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryInviteDelete(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func streamqryEmailChangeInsert(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`INSERT INTO emailChanges ( user, changedOn, oldEmail, newEmail, revertCode ) VALUES ( ?, ?, ?, ?, ? ) `)
+}
+
+func writeqryEmailChangeInsert(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryEmailChangeInsert(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryEmailChangeInsert() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryEmailChangeInsert(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func streamqryEmailChangesGetRevertable(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`SELECT user, oldEmail, newEmail, changedOn, revertedOn, revertCode FROM emailChanges WHERE user=? AND changedOn>? AND revertedOn IS NULL AND revertCode IS NOT NULL ORDER BY changedOn ASC FOR UPDATE `)
+}
+
+func writeqryEmailChangesGetRevertable(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryEmailChangesGetRevertable(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryEmailChangesGetRevertable() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryEmailChangesGetRevertable(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func streamqryEmailChangeRevert(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`UPDATE emailChanges SET revertedOn=?, revertCode=NULL WHERE user=? AND changedOn>=? AND revertedOn IS NULL `)
+}
+
+func writeqryEmailChangeRevert(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryEmailChangeRevert(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryEmailChangeRevert() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryEmailChangeRevert(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func streamqryEmailChangesGet(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`SELECT user, oldEmail, newEmail, changedOn, revertedOn FROM emailChanges WHERE user=? ORDER BY changedOn DESC LIMIT ? `)
+}
+
+func writeqryEmailChangesGet(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryEmailChangesGet(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryEmailChangesGet() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryEmailChangesGet(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func streamqryUsersSearch(qw422016 *qt422016.Writer, sqlArgs *sqlh.Args, args *user.Search) {
+	qw422016.N().S(`SELECT id, handle, alias, hasAvatar, avatarHash FROM users WHERE (discoverable IS NULL OR discoverable=1) AND handle IS NOT NULL AND activatedOn>'0001-01-01' AND deletedOn IS NULL AND disabledOn IS NULL AND (handle LIKE ? OR alias LIKE ?) `)
+	sqlArgs.Append(likePrefix(StrLower(args.Prefix)), likePrefix(args.Prefix))
+
+	if len(args.Base.IDs) > 0 {
+		qw422016.N().S(`AND id IN (`)
+		qw422016.E().S(sqlh.PList(len(args.Base.IDs)))
+		qw422016.N().S(`) ORDER BY FIELD (id,`)
+		qw422016.E().S(sqlh.PList(len(args.Base.IDs)))
+		qw422016.N().S(`) `)
+		is := args.Base.IDs.ToIs()
+		sqlArgs.Append(is...)
+		sqlArgs.Append(is...)
+
+	} else {
+		if args.Base.After != nil {
+			qw422016.N().S(`AND (COALESCE(`)
+			qw422016.E().S(args.Base.Sort)
+			qw422016.N().S(`, ''), id) `)
+			qw422016.N().S(sqlh.GtLtSymbol(*args.Base.Asc))
+			qw422016.N().S(` (SELECT COALESCE(`)
+			qw422016.E().S(args.Base.Sort)
+			qw422016.N().S(`, ''), id FROM users WHERE id=?) `)
+			sqlArgs.Append(*args.Base.After)
+
+		}
+		qw422016.N().S(`ORDER BY COALESCE(`)
+		qw422016.E().S(args.Base.Sort)
+		qw422016.N().S(`, '') `)
+		qw422016.E().S(sqlh.Asc(*args.Base.Asc))
+		qw422016.N().S(`, id `)
+		qw422016.E().S(sqlh.Asc(*args.Base.Asc))
+		qw422016.N().S(` LIMIT `)
+		qw422016.N().D(int(args.Base.Limit) + 1)
+		qw422016.N().S(` `)
+	}
+}
+
+func writeqryUsersSearch(qq422016 qtio422016.Writer, sqlArgs *sqlh.Args, args *user.Search) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryUsersSearch(qw422016, sqlArgs, args)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryUsersSearch(sqlArgs *sqlh.Args, args *user.Search) string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryUsersSearch(qb422016, sqlArgs, args)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func streamqryProfileFieldUpsert(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`INSERT INTO profileFields( user, name, val ) VALUES ( ?, ?, ? ) ON DUPLICATE KEY UPDATE val=VALUES(val) `)
+}
+
+func writeqryProfileFieldUpsert(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryProfileFieldUpsert(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryProfileFieldUpsert() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryProfileFieldUpsert(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func streamqryProfileFieldDelete(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`DELETE FROM profileFields WHERE user=? AND name=? `)
+}
+
+func writeqryProfileFieldDelete(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryProfileFieldDelete(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryProfileFieldDelete() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryProfileFieldDelete(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func streamqryProfileFieldsGet(qw422016 *qt422016.Writer, n int) {
+	qw422016.N().S(`SELECT p.user, p.name, p.val FROM profileFields p JOIN users u ON u.id=p.user WHERE p.user IN (`)
+	qw422016.E().S(sqlh.PList(n))
+	qw422016.N().S(`) AND u.deletedOn IS NULL `)
+}
+
+func writeqryProfileFieldsGet(qq422016 qtio422016.Writer, n int) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryProfileFieldsGet(qw422016, n)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryProfileFieldsGet(n int) string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryProfileFieldsGet(qb422016, n)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
@@ -0,0 +1,213 @@
+package usermail
+
+//go:generate go install github.com/valyala/quicktemplate/qtc
+//go:generate qtc -file=usermail.qtpl -skipLineComments
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	. "github.com/0xor1/tlbx/pkg/core"
+)
+
+type Name string
+
+const (
+	Activate           Name = "activate"
+	LoginLink          Name = "loginLink"
+	Unlock             Name = "unlock"
+	ConfirmChangeEmail Name = "confirmChangeEmail"
+	ResetPwd           Name = "resetPwd"
+	Export             Name = "export"
+	Restore            Name = "restore"
+	Invite             Name = "invite"
+	EmailChanged       Name = "emailChanged"
+
+	DefaultLocale = "en"
+)
+
+// Names lists every email usereps sends, every locale in a Set should
+// provide all of them, any that are missing fall back to DefaultLocale.
+var Names = []Name{
+	Activate,
+	LoginLink,
+	Unlock,
+	ConfirmChangeEmail,
+	ResetPwd,
+	Export,
+	Restore,
+	Invite,
+	EmailChanged,
+}
+
+// Data is everything available to an email template.
+type Data struct {
+	Handle *string
+	Link   string
+}
+
+// Tpl returns the Email body to render inside the shared layout.
+type Tpl func(d *Data) Email
+
+// Locale maps each email Name to its template for a single locale.
+type Locale map[Name]Tpl
+
+// Set maps lowercase locale tags, e.g. "en" or "en-gb", to their templates.
+type Set map[string]Locale
+
+// Default returns the built in english templates.
+func Default() Set {
+	return Set{
+		DefaultLocale: Locale{
+			Activate:           func(d *Data) Email { return &enActivate{d: d} },
+			LoginLink:          func(d *Data) Email { return &enLoginLink{d: d} },
+			Unlock:             func(d *Data) Email { return &enUnlock{d: d} },
+			ConfirmChangeEmail: func(d *Data) Email { return &enConfirmChangeEmail{d: d} },
+			ResetPwd:           func(d *Data) Email { return &enResetPwd{d: d} },
+			Export:             func(d *Data) Email { return &enExport{d: d} },
+			Restore:            func(d *Data) Email { return &enRestore{d: d} },
+			Invite:             func(d *Data) Email { return &enInvite{d: d} },
+			EmailChanged:       func(d *Data) Email { return &enEmailChanged{d: d} },
+		},
+	}
+}
+
+// Override returns a new Set with every template in o replacing or adding
+// to those in s, s and o are not modified.
+func (s Set) Override(o Set) Set {
+	res := Set{}
+	for _, set := range []Set{s, o} {
+		for locale, tpls := range set {
+			locale = strings.ToLower(locale)
+			if res[locale] == nil {
+				res[locale] = Locale{}
+			}
+			for name, tpl := range tpls {
+				res[locale][name] = tpl
+			}
+		}
+	}
+	return res
+}
+
+// Get returns the template for the first of locales that has one, trying
+// each locales base language, e.g. "en" for "en-gb", before moving on,
+// and finally falling back to DefaultLocale.
+func (s Set) Get(name Name, locales ...string) Tpl {
+	for _, l := range append(locales, DefaultLocale) {
+		l = strings.ToLower(l)
+		if tpl := s[l][name]; tpl != nil {
+			return tpl
+		}
+		if i := strings.Index(l, "-"); i > 0 {
+			if tpl := s[l[:i]][name]; tpl != nil {
+				return tpl
+			}
+		}
+	}
+	PanicOn(Err("no email template found for %s", name))
+	return nil
+}
+
+// Render returns the subject, html and plain text bodies for the named email.
+func (s Set) Render(name Name, d *Data, locales ...string) (subject, html, txt string) {
+	e := s.Get(name, locales...)(d)
+	return e.Subject(), LayoutHTML(e, d), LayoutTxt(e, d)
+}
+
+// ParseAcceptLanguage returns the locale tags in an Accept-Language header
+// value ordered by descending quality, "*" and tags with q=0 are dropped.
+func ParseAcceptLanguage(header string) []string {
+	type tag struct {
+		locale string
+		q      float64
+	}
+	tags := []tag{}
+	for _, part := range strings.Split(header, ",") {
+		pieces := strings.Split(strings.TrimSpace(part), ";")
+		locale := strings.ToLower(strings.TrimSpace(pieces[0]))
+		if locale == "" || locale == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range pieces[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				var err error
+				q, err = strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					q = 0
+				}
+			}
+		}
+		if q > 0 {
+			tags = append(tags, tag{locale: locale, q: q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+	res := make([]string, 0, len(tags))
+	for _, t := range tags {
+		res = append(res, t.locale)
+	}
+	return res
+}
+
+// ExampleData is used by Preview to render every template.
+func ExampleData() *Data {
+	handle := "bloe_joggs"
+	return &Data{
+		Handle: &handle,
+		Link:   "http://localhost:8081/#/example?me=example-id&code=example-code",
+	}
+}
+
+// Preview renders every template in every locale of s with ExampleData,
+// locales are visited in lexical order and templates in Names order.
+func (s Set) Preview(fn func(locale string, name Name, subject, html, txt string)) {
+	locales := make([]string, 0, len(s))
+	for locale := range s {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	for _, locale := range locales {
+		for _, name := range Names {
+			if s[locale][name] == nil {
+				continue
+			}
+			subject, html, txt := s.Render(name, ExampleData(), locale)
+			fn(locale, name, subject, html, txt)
+		}
+	}
+}
+
+// PreviewCmd is the body of an email preview command, it parses args for
+// "-o <dir>" and writes <locale>_<name>.html and .txt files for every
+// template in s to dir, or prints them to stdout if dir is empty. Apps
+// that override templates can preview exactly what they send with:
+//
+//	usermail.Default().Override(yourSet).PreviewCmd(os.Args[1:]...)
+func (s Set) PreviewCmd(args ...string) {
+	fs := flag.NewFlagSet("emailpreview", flag.ExitOnError)
+	var dir string
+	fs.StringVar(&dir, "o", "", "dir to write <locale>_<name>.html and .txt files to, prints to stdout if empty")
+	PanicOn(fs.Parse(args))
+	if dir != "" {
+		PanicOn(os.MkdirAll(dir, os.ModePerm))
+	}
+	s.Preview(func(locale string, name Name, subject, html, txt string) {
+		if dir == "" {
+			Println(Strf("locale: %s\nname: %s\nsubject: %s\nhtml:\n%s\ntxt:\n%s\n", locale, name, subject, html, txt))
+			return
+		}
+		base := filepath.Join(dir, Strf("%s_%s", locale, name))
+		PanicOn(ioutil.WriteFile(base+".html", []byte(html), 0644))
+		PanicOn(ioutil.WriteFile(base+".txt", []byte(subject+"\n\n"+txt), 0644))
+	})
+}
@@ -0,0 +1,668 @@
+// Code generated by qtc from "usermail.qtpl". DO NOT EDIT.
+// See https://github.com/valyala/quicktemplate for details.
+
+package usermail
+
+import (
+	qtio422016 "io"
+
+	qt422016 "github.com/valyala/quicktemplate"
+)
+
+var (
+	_ = qtio422016.Copy
+	_ = qt422016.AcquireByteBuffer
+)
+
+type Email interface {
+	Subject() string
+	StreamSubject(qw422016 *qt422016.Writer)
+	WriteSubject(qq422016 qtio422016.Writer)
+	HTML() string
+	StreamHTML(qw422016 *qt422016.Writer)
+	WriteHTML(qq422016 qtio422016.Writer)
+	Txt() string
+	StreamTxt(qw422016 *qt422016.Writer)
+	WriteTxt(qq422016 qtio422016.Writer)
+}
+
+func StreamLayoutHTML(qw422016 *qt422016.Writer, e Email, d *Data) {
+	qw422016.N().S(`<!DOCTYPE html><html><head><meta charset="utf-8"><title>`)
+	e.StreamSubject(qw422016)
+	qw422016.N().S(`</title></head><body>
+`)
+	if d.Handle != nil {
+		qw422016.N().S(`<p>Hi `)
+		qw422016.E().S(*d.Handle)
+		qw422016.N().S(`,</p>
+`)
+	}
+	e.StreamHTML(qw422016)
+	qw422016.N().S(`
+</body></html>`)
+}
+
+func WriteLayoutHTML(qq422016 qtio422016.Writer, e Email, d *Data) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	StreamLayoutHTML(qw422016, e, d)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func LayoutHTML(e Email, d *Data) string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	WriteLayoutHTML(qb422016, e, d)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func StreamLayoutTxt(qw422016 *qt422016.Writer, e Email, d *Data) {
+	if d.Handle != nil {
+		qw422016.N().S(`Hi `)
+		qw422016.N().S(*d.Handle)
+		qw422016.N().S(`,`)
+		qw422016.N().S(`
+`)
+		qw422016.N().S(`
+`)
+	}
+	e.StreamTxt(qw422016)
+}
+
+func WriteLayoutTxt(qq422016 qtio422016.Writer, e Email, d *Data) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	StreamLayoutTxt(qw422016, e, d)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func LayoutTxt(e Email, d *Data) string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	WriteLayoutTxt(qb422016, e, d)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+type enActivate struct{ d *Data }
+
+func (e *enActivate) StreamSubject(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`Activate`)
+}
+
+func (e *enActivate) WriteSubject(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamSubject(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enActivate) Subject() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteSubject(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func (e *enActivate) StreamHTML(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`<p>Thank you for registering.</p><p>Click this link to activate your account:</p><p><a href="`)
+	qw422016.E().S(e.d.Link)
+	qw422016.N().S(`">Activate</a></p><p>If you didn't register for this account you can simply ignore this email.</p>`)
+}
+
+func (e *enActivate) WriteHTML(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamHTML(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enActivate) HTML() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteHTML(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func (e *enActivate) StreamTxt(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`Thank you for registering.
+Click this link to activate your account:
+
+`)
+	qw422016.N().S(e.d.Link)
+	qw422016.N().S(`
+
+If you didn't register for this account you can simply ignore this email.`)
+}
+
+func (e *enActivate) WriteTxt(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamTxt(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enActivate) Txt() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteTxt(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+type enLoginLink struct{ d *Data }
+
+func (e *enLoginLink) StreamSubject(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`Login Link`)
+}
+
+func (e *enLoginLink) WriteSubject(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamSubject(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enLoginLink) Subject() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteSubject(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func (e *enLoginLink) StreamHTML(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`<p>Here is the login link you requested.</p><p>Click this link to login to your account:</p><p><a href="`)
+	qw422016.E().S(e.d.Link)
+	qw422016.N().S(`">Login</a></p><p>This link will only be valid for 10 minutes.</p><p>If you didn't request this link you can simply ignore this email.</p>`)
+}
+
+func (e *enLoginLink) WriteHTML(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamHTML(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enLoginLink) HTML() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteHTML(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func (e *enLoginLink) StreamTxt(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`Here is the login link you requested.
+Click this link to login to your account:
+
+`)
+	qw422016.N().S(e.d.Link)
+	qw422016.N().S(`
+
+This link will only be valid for 10 minutes.
+
+If you didn't request this link you can simply ignore this email.`)
+}
+
+func (e *enLoginLink) WriteTxt(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamTxt(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enLoginLink) Txt() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteTxt(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+type enUnlock struct{ d *Data }
+
+func (e *enUnlock) StreamSubject(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`Account Locked`)
+}
+
+func (e *enUnlock) WriteSubject(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamSubject(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enUnlock) Subject() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteSubject(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func (e *enUnlock) StreamHTML(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`<p>Your account has been temporarily locked due to too many failed login attempts.</p><p>If this was you, click this link to unlock your account:</p><p><a href="`)
+	qw422016.E().S(e.d.Link)
+	qw422016.N().S(`">Unlock</a></p><p>If this wasn't you, someone may be trying to access your account, you may wish to change your password.</p>`)
+}
+
+func (e *enUnlock) WriteHTML(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamHTML(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enUnlock) HTML() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteHTML(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func (e *enUnlock) StreamTxt(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`Your account has been temporarily locked due to too many failed login attempts.
+If this was you, click this link to unlock your account:
+
+`)
+	qw422016.N().S(e.d.Link)
+	qw422016.N().S(`
+
+If this wasn't you, someone may be trying to access your account, you may wish to change your password.`)
+}
+
+func (e *enUnlock) WriteTxt(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamTxt(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enUnlock) Txt() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteTxt(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+type enConfirmChangeEmail struct{ d *Data }
+
+func (e *enConfirmChangeEmail) StreamSubject(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`Confirm change email`)
+}
+
+func (e *enConfirmChangeEmail) WriteSubject(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamSubject(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enConfirmChangeEmail) Subject() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteSubject(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func (e *enConfirmChangeEmail) StreamHTML(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`<p>Click this link to change the email associated with your account:</p><p><a href="`)
+	qw422016.E().S(e.d.Link)
+	qw422016.N().S(`">Confirm change email</a></p>`)
+}
+
+func (e *enConfirmChangeEmail) WriteHTML(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamHTML(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enConfirmChangeEmail) HTML() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteHTML(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func (e *enConfirmChangeEmail) StreamTxt(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`Click this link to change the email associated with your account:
+
+`)
+	qw422016.N().S(e.d.Link)
+}
+
+func (e *enConfirmChangeEmail) WriteTxt(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamTxt(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enConfirmChangeEmail) Txt() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteTxt(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+type enResetPwd struct{ d *Data }
+
+func (e *enResetPwd) StreamSubject(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`Reset Password`)
+}
+
+func (e *enResetPwd) WriteSubject(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamSubject(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enResetPwd) Subject() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteSubject(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func (e *enResetPwd) StreamHTML(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`<p>Here is the reset password link you requested.</p><p>Click this link to set a new password for your account:</p><p><a href="`)
+	qw422016.E().S(e.d.Link)
+	qw422016.N().S(`">Reset Password</a></p><p>This link will only be valid for 1 hour.</p><p>If you didn't request this link you can simply ignore this email.</p>`)
+}
+
+func (e *enResetPwd) WriteHTML(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamHTML(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enResetPwd) HTML() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteHTML(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func (e *enResetPwd) StreamTxt(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`Here is the reset password link you requested.
+Click this link to set a new password for your account:
+
+`)
+	qw422016.N().S(e.d.Link)
+	qw422016.N().S(`
+
+This link will only be valid for 1 hour.
+
+If you didn't request this link you can simply ignore this email.`)
+}
+
+func (e *enResetPwd) WriteTxt(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamTxt(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enResetPwd) Txt() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteTxt(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+type enExport struct{ d *Data }
+
+func (e *enExport) StreamSubject(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`Data Export`)
+}
+
+func (e *enExport) WriteSubject(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamSubject(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enExport) Subject() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteSubject(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func (e *enExport) StreamHTML(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`<p>Here is the data export you requested.</p><p>Click this link to download it:</p><p><a href="`)
+	qw422016.E().S(e.d.Link)
+	qw422016.N().S(`">Download</a></p><p>This link will only be valid for a limited time.</p><p>If you didn't request this export you may wish to change your password.</p>`)
+}
+
+func (e *enExport) WriteHTML(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamHTML(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enExport) HTML() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteHTML(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func (e *enExport) StreamTxt(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`Here is the data export you requested.
+Click this link to download it:
+
+`)
+	qw422016.N().S(e.d.Link)
+	qw422016.N().S(`
+
+This link will only be valid for a limited time.
+
+If you didn't request this export you may wish to change your password.`)
+}
+
+func (e *enExport) WriteTxt(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamTxt(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enExport) Txt() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteTxt(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+type enRestore struct{ d *Data }
+
+func (e *enRestore) StreamSubject(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`Account Deleted`)
+}
+
+func (e *enRestore) WriteSubject(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamSubject(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enRestore) Subject() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteSubject(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func (e *enRestore) StreamHTML(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`<p>Your account has been scheduled for deletion and you have been logged out everywhere.</p><p>If you change your mind, click this link to restore your account:</p><p><a href="`)
+	qw422016.E().S(e.d.Link)
+	qw422016.N().S(`">Restore</a></p><p>If you do nothing your account and all of its data will be permanently deleted.</p>`)
+}
+
+func (e *enRestore) WriteHTML(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamHTML(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enRestore) HTML() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteHTML(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func (e *enRestore) StreamTxt(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`Your account has been scheduled for deletion and you have been logged out everywhere.
+If you change your mind, click this link to restore your account:
+
+`)
+	qw422016.N().S(e.d.Link)
+	qw422016.N().S(`
+
+If you do nothing your account and all of its data will be permanently deleted.`)
+}
+
+func (e *enRestore) WriteTxt(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamTxt(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enRestore) Txt() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteTxt(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+type enInvite struct{ d *Data }
+
+func (e *enInvite) StreamSubject(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`Invitation`)
+}
+
+func (e *enInvite) WriteSubject(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamSubject(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enInvite) Subject() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteSubject(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func (e *enInvite) StreamHTML(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`<p>You have been invited to register an account.</p><p>Click this link to register:</p><p><a href="`)
+	qw422016.E().S(e.d.Link)
+	qw422016.N().S(`">Register</a></p><p>If you weren't expecting this invitation you can simply ignore this email.</p>`)
+}
+
+func (e *enInvite) WriteHTML(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamHTML(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enInvite) HTML() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteHTML(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func (e *enInvite) StreamTxt(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`You have been invited to register an account.
+Click this link to register:
+
+`)
+	qw422016.N().S(e.d.Link)
+	qw422016.N().S(`
+
+If you weren't expecting this invitation you can simply ignore this email.`)
+}
+
+func (e *enInvite) WriteTxt(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamTxt(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enInvite) Txt() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteTxt(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+type enEmailChanged struct{ d *Data }
+
+func (e *enEmailChanged) StreamSubject(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`Your Email Address Was Changed`)
+}
+
+func (e *enEmailChanged) WriteSubject(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamSubject(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enEmailChanged) Subject() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteSubject(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func (e *enEmailChanged) StreamHTML(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`<p>The email address on your account has been changed and this address will no longer be used.</p><p>If this wasn't you click this link to change it back, this will log out all sessions and you will be sent a link to reset your password:</p><p><a href="`)
+	qw422016.E().S(e.d.Link)
+	qw422016.N().S(`">This Wasn't Me</a></p>`)
+}
+
+func (e *enEmailChanged) WriteHTML(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamHTML(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enEmailChanged) HTML() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteHTML(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func (e *enEmailChanged) StreamTxt(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`The email address on your account has been changed and this address will no longer be used.
+If this wasn't you click this link to change it back, this will log out all sessions and you will be sent a link to reset your password:
+
+`)
+	qw422016.N().S(e.d.Link)
+}
+
+func (e *enEmailChanged) WriteTxt(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	e.StreamTxt(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (e *enEmailChanged) Txt() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	e.WriteTxt(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
@@ -0,0 +1,66 @@
+package usermail
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseAcceptLanguage(t *testing.T) {
+	a := assert.New(t)
+	a.Equal([]string{}, ParseAcceptLanguage(""))
+	a.Equal([]string{"fr-ch", "fr", "en", "de"}, ParseAcceptLanguage("fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5"))
+	a.Equal([]string{"en", "es"}, ParseAcceptLanguage("es;q=0.5, en, it;q=0"))
+}
+
+func Test_Set(t *testing.T) {
+	a := assert.New(t)
+	s := Default().Override(Set{
+		"ES": Locale{
+			Activate: func(d *Data) Email { return &enResetPwd{d: d} },
+		},
+	})
+	d := ExampleData()
+	subject, html, txt := s.Render(Activate, d)
+	a.Equal("Activate", subject)
+	a.Contains(html, "<p>Hi bloe_joggs,</p>")
+	a.Contains(html, `href="http://localhost:8081/#/example?me=example-id&amp;code=example-code"`)
+	a.Contains(txt, "Hi bloe_joggs,\n\nThank you for registering.")
+	a.Contains(txt, d.Link)
+
+	subject, _, _ = s.Render(Activate, d, "es-mx")
+	a.Equal("Reset Password", subject)
+	subject, _, _ = s.Render(LoginLink, d, "es-mx")
+	a.Equal("Login Link", subject)
+
+	_, html, txt = s.Render(Unlock, &Data{Link: "http://x"}, "de")
+	a.NotContains(html, "Hi ")
+	a.NotContains(txt, "Hi ")
+
+	count := 0
+	s.Preview(func(_ string, _ Name, _, _, _ string) {
+		count++
+	})
+	a.Equal(len(Names)+1, count)
+}
+
+func Test_PreviewCmd(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+	Default().Override(Set{
+		"es": Locale{
+			Activate: func(d *Data) Email { return &enResetPwd{d: d} },
+		},
+	}).PreviewCmd("-o", dir)
+	txt, err := ioutil.ReadFile(filepath.Join(dir, "es_activate.txt"))
+	a.NoError(err)
+	a.Contains(string(txt), "Reset Password\n\n")
+	_, err = ioutil.ReadFile(filepath.Join(dir, "es_activate.html"))
+	a.NoError(err)
+	_, err = ioutil.ReadFile(filepath.Join(dir, "en_activate.html"))
+	a.NoError(err)
+	_, err = ioutil.ReadFile(filepath.Join(dir, "es_loginLink.html"))
+	a.Error(err)
+}
@@ -1,11 +1,15 @@
 package usertest
 
 import (
+	"archive/zip"
+	"bytes"
 	"encoding/base64"
 	"io/ioutil"
+	"net/http"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	. "github.com/0xor1/tlbx/pkg/core"
 	"github.com/0xor1/tlbx/pkg/json"
@@ -14,16 +18,18 @@ import (
 	"github.com/0xor1/tlbx/pkg/web/app/config"
 	"github.com/0xor1/tlbx/pkg/web/app/service"
 	"github.com/0xor1/tlbx/pkg/web/app/service/sql"
+	"github.com/0xor1/tlbx/pkg/web/app/session/me"
 	"github.com/0xor1/tlbx/pkg/web/app/test"
 	"github.com/0xor1/tlbx/pkg/web/app/user"
 	"github.com/0xor1/tlbx/pkg/web/app/user/usereps"
+	"github.com/gomodule/redigo/redis"
 	"github.com/stretchr/testify/assert"
 )
 
 func Everything(t *testing.T) {
 	r := test.NewMeRig(
 		config.GetProcessed(config.GetBase()),
-		nil,
+		[]*app.Endpoint{anonIDEp},
 		func(tlbx app.Tlbx, id ID) {},
 		usereps.NopOnSetSocials,
 		func(t app.Tlbx, i IDs) (sql.Tx, error) {
@@ -35,6 +41,12 @@ func Everything(t *testing.T) {
 
 	a := assert.New(t)
 
+	a.Panics(func() {
+		usereps.New("", "", "", "", "", nil, nil, nil, false, func(c *usereps.Config) {
+			c.RegistrationMode = "invite"
+		})
+	})
+
 	// do a test of IDs.Scan here
 	foundIDs := IDs{}
 	PanicOn(r.User().Primary().Get(&foundIDs, `SELECT GROUP_CONCAT(id SEPARATOR '') FROM users`))
@@ -61,6 +73,7 @@ func Everything(t *testing.T) {
 		Alias:  ptr.String(alias),
 		Email:  email,
 		Pwd:    pwd,
+		Pow:    r.Pow(c),
 	}).MustDo(c)
 
 	// check existing email err
@@ -68,6 +81,7 @@ func Everything(t *testing.T) {
 		Handle: ptr.String("not_used"),
 		Email:  email,
 		Pwd:    pwd,
+		Pow:    r.Pow(c),
 	}).Do(c)
 	a.Equal(&app.ErrMsg{Status: 400, Msg: "email or handle already registered"}, err)
 
@@ -76,11 +90,41 @@ func Everything(t *testing.T) {
 		Handle: ptr.String(handle),
 		Email:  "email@email.test",
 		Pwd:    pwd,
+		Pow:    r.Pow(c),
 	}).Do(c)
 	a.Equal(&app.ErrMsg{Status: 400, Msg: "email or handle already registered"}, err)
 
+	// check pow is required and each solution can only be used once
+	err = (&user.Register{
+		Email: "pow@test.localhost" + r.UniqueStr(),
+		Pwd:   pwd,
+	}).Do(c)
+	a.Equal(&app.ErrMsg{Status: 400, Msg: "proof of work required"}, err)
+	err = (&user.SendLoginLinkEmail{Email: email}).Do(c)
+	a.Equal(&app.ErrMsg{Status: 400, Msg: "proof of work required"}, err)
+	err = (&user.ResetPwd{Email: email}).Do(c)
+	a.Equal(&app.ErrMsg{Status: 400, Msg: "proof of work required"}, err)
+	powSolution := r.Pow(c)
 	(&user.ResendActivateLink{
 		Email: email,
+		Pow:   powSolution,
+	}).MustDo(c)
+	err = (&user.ResendActivateLink{
+		Email: email,
+		Pow:   powSolution,
+	}).Do(c)
+	a.Equal(&app.ErrMsg{Status: 400, Msg: "proof of work invalid"}, err)
+	// solutions are only accepted from the client the challenge was
+	// issued to
+	err = (&user.ResendActivateLink{
+		Email: email,
+		Pow:   r.Pow(r.Ali().Client()),
+	}).Do(c)
+	a.Equal(&app.ErrMsg{Status: 400, Msg: "proof of work invalid"}, err)
+
+	(&user.ResendActivateLink{
+		Email: email,
+		Pow:   r.Pow(c),
 	}).MustDo(c)
 
 	var myID ID
@@ -96,6 +140,7 @@ func Everything(t *testing.T) {
 	// check return ealry path
 	(&user.ResendActivateLink{
 		Email: email,
+		Pow:   r.Pow(c),
 	}).MustDo(c)
 
 	id := (&user.Login{
@@ -111,7 +156,7 @@ func Everything(t *testing.T) {
 		PanicOn(err)
 	}()
 
-	(&user.SendLoginLinkEmail{Email: email}).MustDo(c)
+	(&user.SendLoginLinkEmail{Email: email, Pow: r.Pow(c)}).MustDo(c)
 	row = r.User().Primary().QueryRow(`SELECT loginLinkCode FROM users WHERE id=?`, id)
 	loginLinkCode := ""
 	PanicOn(row.Scan(&loginLinkCode))
@@ -146,6 +191,12 @@ func Everything(t *testing.T) {
 		Code: code,
 	}).MustDo(c)
 
+	err = (&user.SetPwd{
+		OldPwd: pwd,
+		NewPwd: pwd + handle,
+	}).Do(c)
+	a.Equal(&app.ErrMsg{Status: http.StatusBadRequest, Msg: "pwd does not satisfy policy: containsHandle"}, err)
+
 	newPwd := pwd + "123abc"
 	(&user.SetPwd{
 		OldPwd: pwd,
@@ -154,6 +205,40 @@ func Everything(t *testing.T) {
 
 	(&user.Logout{}).MustDo(c)
 
+	// check lockout after too many failed logins
+	for i := 0; i < 5; i++ {
+		_, err = (&user.Login{
+			Email: email,
+			Pwd:   pwd,
+		}).Do(c)
+		a.Equal(http.StatusNotFound, err.(*app.ErrMsg).Status)
+	}
+	// a locked account gets a distinct status, even with the right pwd
+	_, err = (&user.Login{
+		Email: email,
+		Pwd:   newPwd,
+	}).Do(c)
+	a.Equal(http.StatusLocked, err.(*app.ErrMsg).Status)
+	err = (&user.SendLoginLinkEmail{
+		Email: email,
+		Pow:   r.Pow(c),
+	}).Do(c)
+	a.Equal(http.StatusLocked, err.(*app.ErrMsg).Status)
+	_, err = (&user.Login{
+		Email: "unknown_" + email,
+		Pwd:   newPwd,
+	}).Do(c)
+	a.Equal(&app.ErrMsg{Status: http.StatusNotFound, Msg: "email and/or pwd are not valid"}, err)
+
+	cnn := r.Cache().Get()
+	unlockCode, err := redis.String(cnn.Do("GET", Strf("user_lockout_unlock_%s", id)))
+	cnn.Close()
+	PanicOn(err)
+	(&user.Unlock{
+		Me:   id,
+		Code: unlockCode,
+	}).MustDo(c)
+
 	(&user.Login{
 		Email: email,
 		Pwd:   newPwd,
@@ -173,6 +258,20 @@ func Everything(t *testing.T) {
 	a.Equal(handle, *me.Handle)
 	a.Equal(alias, *me.Alias)
 	a.False(*me.HasAvatar)
+	a.Nil(me.Locale)
+
+	(&user.SetLocale{
+		Locale: ptr.String(" EN-gb "),
+	}).MustDo(c)
+	a.Equal("en-gb", *(&user.GetMe{}).MustDo(c).Locale)
+
+	err = (&user.SetLocale{
+		Locale: ptr.String("not a locale"),
+	}).Do(c)
+	a.Equal(http.StatusBadRequest, err.(*app.ErrMsg).Status)
+
+	(&user.SetLocale{}).MustDo(c)
+	a.Nil((&user.GetMe{}).MustDo(c).Locale)
 
 	(&user.SetAvatar{
 		Avatar: ioutil.NopCloser(base64.NewDecoder(base64.StdEncoding, strings.NewReader(testImgOk))),
@@ -189,13 +288,66 @@ func Everything(t *testing.T) {
 	a.False(avatar.IsDownload)
 	a.Equal(int64(126670), avatar.Size)
 	avatar.Content.Close()
+	a.NotNil(me.AvatarHash)
+	// the ext is stored so the encoder can be changed
+	var avatarExt *string
+	PanicOn(r.User().Primary().QueryRow(`SELECT avatarExt FROM users WHERE id=?`, me.ID).Scan(&avatarExt))
+	a.Equal("png", *avatarExt)
+	// as are the sizes so AvatarSizes can be changed
+	var avatarSizes *string
+	PanicOn(r.User().Primary().QueryRow(`SELECT avatarSizes FROM users WHERE id=?`, me.ID).Scan(&avatarSizes))
+	a.Equal("32,64,250", *avatarSizes)
+
+	avatar = (&user.GetAvatar{
+		User: me.ID,
+		Size: ptr.Int(40),
+		Hash: me.AvatarHash,
+	}).MustDo(c)
+	a.Equal("image/png", avatar.Type)
+	a.True(avatar.Size < int64(126670))
+	avatar.Content.Close()
 
 	(&user.SetAvatar{
 		Avatar: ioutil.NopCloser(base64.NewDecoder(base64.StdEncoding, strings.NewReader(testImgNotSquare))),
 	}).MustDo(c)
 
+	oldAvatarHash := me.AvatarHash
 	me = (&user.GetMe{}).MustDo(c)
 	a.True(*me.HasAvatar)
+	a.NotEqual(*oldAvatarHash, *me.AvatarHash)
+
+	_, err = (&user.GetAvatar{
+		User: me.ID,
+		Hash: oldAvatarHash,
+	}).Do(c)
+	a.Equal(http.StatusNotFound, err.(*app.ErrMsg).Status)
+
+	// an invalid upload leaves the current avatar intact
+	err = (&user.SetAvatar{
+		Avatar: ioutil.NopCloser(strings.NewReader("not an image")),
+	}).Do(c)
+	a.Equal(&app.ErrMsg{Status: http.StatusBadRequest, Msg: "invalid image"}, err)
+	// as does uploading the same avatar again
+	(&user.SetAvatar{
+		Avatar: ioutil.NopCloser(base64.NewDecoder(base64.StdEncoding, strings.NewReader(testImgNotSquare))),
+	}).MustDo(c)
+	a.Equal(*me.AvatarHash, *(&user.GetMe{}).MustDo(c).AvatarHash)
+	(&user.GetAvatar{
+		User: me.ID,
+		Hash: me.AvatarHash,
+	}).MustDo(c).Content.Close()
+
+	(&user.DeleteAvatar{}).MustDo(c)
+
+	me = (&user.GetMe{}).MustDo(c)
+	a.False(*me.HasAvatar)
+	a.Nil(me.AvatarHash)
+	PanicOn(r.User().Primary().QueryRow(`SELECT avatarExt FROM users WHERE id=?`, me.ID).Scan(&avatarExt))
+	a.Nil(avatarExt)
+
+	(&user.SetAvatar{
+		Avatar: ioutil.NopCloser(base64.NewDecoder(base64.StdEncoding, strings.NewReader(testImgOk))),
+	}).MustDo(c)
 
 	(&user.SetAvatar{
 		Avatar: nil,
@@ -218,11 +370,67 @@ func Everything(t *testing.T) {
 	(&user.Delete{
 		Pwd: newPwd,
 	}).MustDo(c)
+	// deleted accounts are logged out everywhere and pending deletion
+	a.Nil((&user.GetMe{}).MustDo(c))
+	var deletedOn *time.Time
+	PanicOn(r.User().Primary().QueryRow(`SELECT deletedOn FROM users WHERE id=?`, id).Scan(&deletedOn))
+	a.NotNil(deletedOn)
+	users = (&user.Get{
+		Users: []ID{id},
+	}).MustDo(c)
+	a.Nil(users[0].Handle)
+	_, err = (&user.Login{
+		Email: email,
+		Pwd:   newPwd,
+	}).Do(c)
+	a.Equal(http.StatusForbidden, err.(*app.ErrMsg).Status)
+	// reset pwd responds the same as for unknown emails
+	a.Nil((&user.ResetPwd{
+		Email: email,
+		Pow:   r.Pow(c),
+	}).Do(c))
+	var resetPwdCode *string
+	PanicOn(r.User().Primary().QueryRow(`SELECT resetPwdCode FROM users WHERE id=?`, id).Scan(&resetPwdCode))
+	a.Nil(resetPwdCode)
+
+	var restoreCode string
+	row = r.User().Primary().QueryRow(`SELECT restoreCode FROM users WHERE id=?`, id)
+	PanicOn(row.Scan(&restoreCode))
+	err = (&user.Restore{
+		Me:   id,
+		Code: "bad",
+	}).Do(c)
+	a.Equal(http.StatusBadRequest, err.(*app.ErrMsg).Status)
+	(&user.Restore{
+		Me:   id,
+		Code: restoreCode,
+	}).MustDo(c)
+	a.Equal(id, (&user.Login{
+		Email: email,
+		Pwd:   newPwd,
+	}).MustDo(c).ID)
+
+	// delete again and backdate it to test the purge
+	(&user.Delete{
+		Pwd: newPwd,
+	}).MustDo(c)
+	_, err = r.User().Primary().Exec(`UPDATE users SET deletedOn=? WHERE id=?`, Now().Add(-365*24*time.Hour), id)
+	PanicOn(err)
+	// purges are run by the rigs ticker
+	purged := false
+	for i := 0; i < 50 && !purged; i++ {
+		time.Sleep(100 * time.Millisecond)
+		var n int
+		PanicOn(r.User().Primary().QueryRow(`SELECT COUNT(*) FROM users WHERE id=?`, id).Scan(&n))
+		purged = n == 0
+	}
+	a.True(purged)
 
 	(&user.Register{
 		Handle: ptr.String(handle),
 		Email:  email,
 		Pwd:    pwd,
+		Pow:    r.Pow(c),
 	}).MustDo(c)
 
 	row = r.User().Primary().QueryRow(`SELECT id, activateCode FROM users WHERE email=?`, email)
@@ -248,16 +456,118 @@ func Everything(t *testing.T) {
 
 	(&user.ResetPwd{
 		Email: email,
+		Pow:   r.Pow(c),
 	}).MustDo(c)
 
 	err = (&user.ResetPwd{
 		Email: email,
+		Pow:   r.Pow(c),
 	}).Do(c)
 	a.Equal(400, err.(*app.ErrMsg).Status)
 	a.True(regexp.MustCompile(`must wait [1-9][0-9]{2} seconds before reseting pwd again`).MatchString(err.(*app.ErrMsg).Msg))
 
-	// test fcm eps
+	row = r.User().Primary().QueryRow(`SELECT resetPwdCode FROM users WHERE id=?`, id)
+	PanicOn(row.Scan(&code))
+
+	err = (&user.ConfirmResetPwd{
+		Me:     id,
+		Code:   "not_the_code",
+		NewPwd: newPwd,
+	}).Do(c)
+	a.Equal(400, err.(*app.ErrMsg).Status)
+
+	(&user.ConfirmResetPwd{
+		Me:     id,
+		Code:   code,
+		NewPwd: newPwd,
+	}).MustDo(c)
+
+	// reset pwd logs out all existing sessions
+	a.Nil((&user.GetMe{}).MustDo(c))
+
+	// code is single use
+	err = (&user.ConfirmResetPwd{
+		Me:     id,
+		Code:   code,
+		NewPwd: pwd,
+	}).Do(c)
+	a.Equal(400, err.(*app.ErrMsg).Status)
+
+	a.Equal(id, (&user.Login{
+		Email: email,
+		Pwd:   newPwd,
+	}).MustDo(c).ID)
+
+	// test search eps
 	ac := r.Ali().Client()
+	searchRes := (&user.Search{
+		Prefix: Strf("bob%d", r.Unique()),
+	}).MustDo(ac)
+	a.Len(searchRes.Set, 1)
+	a.Equal(r.Bob().ID(), searchRes.Set[0].ID)
+	a.False(searchRes.More)
+
+	_, err = (&user.Search{
+		Prefix: "b",
+	}).Do(ac)
+	a.Equal(400, err.(*app.ErrMsg).Status)
+
+	(&user.SetDiscoverable{
+		Val: false,
+	}).MustDo(r.Bob().Client())
+	searchRes = (&user.Search{
+		Prefix: Strf("bob%d", r.Unique()),
+	}).MustDo(ac)
+	a.Len(searchRes.Set, 0)
+	(&user.SetDiscoverable{
+		Val: true,
+	}).MustDo(r.Bob().Client())
+	// accounts from before discoverable was added are discoverable
+	_, err = r.User().Primary().Exec(`UPDATE users SET discoverable=NULL WHERE id=?`, r.Bob().ID())
+	PanicOn(err)
+	a.True(*(&user.GetMe{}).MustDo(r.Bob().Client()).Discoverable)
+	searchRes = (&user.Search{
+		Prefix: Strf("bob%d", r.Unique()),
+	}).MustDo(ac)
+	a.Len(searchRes.Set, 1)
+
+	// test profile eps
+	a.Len((&user.GetProfileFields{}).MustDo(ac), 2)
+	(&user.SetProfile{
+		Fields: map[string]interface{}{
+			"bio":      "hi",
+			"timezone": "Europe/London",
+		},
+	}).MustDo(ac)
+	a.Equal("Europe/London", (&user.GetMe{}).MustDo(ac).Profile["timezone"])
+	profileRes := (&user.Get{
+		Users: IDs{r.Ali().ID()},
+	}).MustDo(r.Bob().Client())
+	a.Equal("hi", profileRes[0].Profile["bio"])
+	a.Nil(profileRes[0].Profile["timezone"])
+	err = (&user.SetProfile{
+		Fields: map[string]interface{}{
+			"bio": 1,
+		},
+	}).Do(ac)
+	a.Equal(400, err.(*app.ErrMsg).Status)
+	// max len values which json escapes to 6 bytes per rune still fit
+	escaped := strings.Repeat("<", 200)
+	(&user.SetProfile{
+		Fields: map[string]interface{}{
+			"bio": escaped,
+		},
+	}).MustDo(ac)
+	a.Equal(escaped, (&user.GetMe{}).MustDo(ac).Profile["bio"])
+	(&user.SetProfile{
+		Fields: map[string]interface{}{
+			"bio":      nil,
+			"timezone": nil,
+		},
+	}).MustDo(ac)
+	a.Nil((&user.GetMe{}).MustDo(ac).Profile)
+
+	// test fcm eps
 	fcmToken := "123:abc"
 	(&user.SetFCMEnabled{
 		Val: false,
@@ -324,22 +634,318 @@ func Everything(t *testing.T) {
 		Val: true,
 	}).MustDo(ac)
 
-	js := (&user.GetJin{}).MustDo(ac)
-	a.Nil(js)
+	jin := (&user.GetJin{}).MustDo(ac)
+	a.Nil(jin.Val)
+	a.Zero(jin.Rev)
 
-	(&user.SetJin{
+	rev := (&user.SetJin{
+		Rev: ptr.Uint64(0),
 		Val: json.MustFromString(`{"test":"yolo"}`),
 	}).MustDo(ac)
+	a.Equal(uint64(1), rev)
+
+	_, err = (&user.SetJin{
+		Rev: ptr.Uint64(0),
+		Val: json.MustFromString(`{"test":"clobbered"}`),
+	}).Do(ac)
+	a.Equal(http.StatusConflict, err.(*app.ErrMsg).Status)
 
-	js = (&user.GetJin{}).MustDo(ac)
-	a.Equal("yolo", js.MustString("test"))
+	jin = (&user.PatchJin{
+		Rev:   ptr.Uint64(1),
+		Patch: json.MustFromString(`{"other":{"a":1},"gone":null}`),
+	}).MustDo(ac)
+	a.Equal(uint64(2), jin.Rev)
+	a.Equal(`{"other":{"a":1},"test":"yolo"}`, jin.Val.MustToString())
+
+	_, err = (&user.PatchJin{
+		Patch: json.MustFromString(Strf(`{"big":"%s"}`, strings.Repeat("a", 10000))),
+	}).Do(ac)
+	a.Equal(http.StatusRequestEntityTooLarge, err.(*app.ErrMsg).Status)
+
+	jin = (&user.GetJin{}).MustDo(ac)
+	a.Equal(uint64(2), jin.Rev)
+	a.Equal("yolo", jin.Val.MustString("test"))
+
+	export := (&user.Export{}).MustDo(ac)
+	a.Equal("application/zip", export.Type)
+	exportBs, err := ioutil.ReadAll(export.Content)
+	PanicOn(err)
+	export.Content.Close()
+	zr, err := zip.NewReader(bytes.NewReader(exportBs), int64(len(exportBs)))
+	PanicOn(err)
+	exportFiles := map[string]*json.Json{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		PanicOn(err)
+		bs, err := ioutil.ReadAll(rc)
+		PanicOn(err)
+		rc.Close()
+		exportFiles[f.Name] = json.MustFromBytes(bs)
+	}
+	a.Equal(3, len(exportFiles))
+	a.Equal(r.Ali().Email(), exportFiles["user.json"].MustString("email"))
+	a.Equal("yolo", exportFiles["jin.json"].MustString("test"))
+	a.Equal(5, len(exportFiles["fcm.json"].MustSlice()))
+
+	(&user.ExportAsync{}).MustDo(ac)
+	err = (&user.ExportAsync{}).Do(ac)
+	a.Equal(http.StatusTooManyRequests, err.(*app.ErrMsg).Status)
 
 	(&user.SetJin{}).MustDo(ac)
 
-	js = (&user.GetJin{}).MustDo(ac)
-	a.Nil(js)
+	jin = (&user.GetJin{}).MustDo(ac)
+	a.Nil(jin.Val)
+	a.Equal(uint64(3), jin.Rev)
 
 	(&user.UnregisterFromFCM{
 		Client: app.ExampleID(),
 	}).MustDo(ac)
+
+	// test admin eps
+	bc := r.Bob().Client()
+	cc := r.Cat().Client()
+	_, err = (&user.AdminSearch{
+		Prefix: "cat",
+		Limit:  10,
+	}).Do(bc)
+	a.Equal(http.StatusForbidden, err.(*app.ErrMsg).Status)
+	_, err = r.User().Primary().Exec(`UPDATE users SET isAdmin=1 WHERE id=?`, r.Bob().ID())
+	PanicOn(err)
+	defer func() {
+		_, err = r.User().Primary().Exec(`DELETE FROM adminAudit WHERE admin=?`, r.Bob().ID())
+		PanicOn(err)
+	}()
+
+	found := (&user.AdminSearch{
+		Prefix: r.Cat().Email(),
+		Limit:  10,
+	}).MustDo(bc)
+	a.Equal(1, len(found))
+	a.Equal(r.Cat().ID(), found[0].ID)
+	a.NotNil(found[0].ActivatedOn)
+	a.Nil(found[0].DisabledOn)
+
+	(&user.AdminSetDisabled{
+		User:     r.Cat().ID(),
+		Disabled: true,
+	}).MustDo(bc)
+	a.NotNil((&user.AdminGet{
+		User: r.Cat().ID(),
+	}).MustDo(bc).DisabledOn)
+	a.Nil((&user.GetMe{}).MustDo(cc))
+	// users.disabledOn is the authority when the cache is evicted
+	cnn = r.Cache().Get()
+	_, err = cnn.Do("DEL", Strf("me_disabled_%s", r.Cat().ID()))
+	cnn.Close()
+	PanicOn(err)
+	a.Nil((&user.GetMe{}).MustDo(r.Cat().Client()))
+	_, err = (&user.Login{
+		Email: r.Cat().Email(),
+		Pwd:   r.Cat().Pwd(),
+	}).Do(cc)
+	a.Equal(http.StatusForbidden, err.(*app.ErrMsg).Status)
+
+	(&user.AdminSetDisabled{
+		User:     r.Cat().ID(),
+		Disabled: false,
+	}).MustDo(bc)
+	(&user.Login{
+		Email: r.Cat().Email(),
+		Pwd:   r.Cat().Pwd(),
+	}).MustDo(cc)
+	a.NotNil((&user.GetMe{}).MustDo(cc))
+
+	(&user.AdminLogout{
+		User: r.Cat().ID(),
+	}).MustDo(bc)
+	a.Nil((&user.GetMe{}).MustDo(cc))
+	(&user.Login{
+		Email: r.Cat().Email(),
+		Pwd:   r.Cat().Pwd(),
+	}).MustDo(cc)
+
+	(&user.AdminResendEmail{
+		User:  r.Cat().ID(),
+		Email: "resetPwd",
+	}).MustDo(bc)
+
+	ic := r.NewClient()
+	(&user.Login{
+		Email: r.Bob().Email(),
+		Pwd:   r.Bob().Pwd(),
+	}).MustDo(ic)
+	a.Equal(r.Cat().ID(), (&user.AdminImpersonate{
+		User: r.Cat().ID(),
+	}).MustDo(ic).ID)
+	a.Equal(r.Cat().ID(), (&user.GetMe{}).MustDo(ic).ID)
+
+	audit := (&user.AdminGetAudit{
+		User:  ptr.ID(r.Cat().ID()),
+		Limit: 10,
+	}).MustDo(bc)
+	a.Equal(6, len(audit))
+	a.Equal("impersonated:/api/user/me", audit[0].Action)
+	a.Equal(r.Bob().ID(), audit[0].Admin)
+	a.Equal("impersonate", audit[1].Action)
+	a.Equal(r.Bob().ID(), audit[1].Admin)
+
+	// test invites
+	_, err = (&user.CreateInvite{
+		MaxUses:   1,
+		ExpiresOn: Now().Add(time.Hour),
+	}).Do(r.Cat().Client())
+	a.Equal(http.StatusForbidden, err.(*app.ErrMsg).Status)
+
+	inviteEmail := "invited@test.localhost" + r.UniqueStr()
+	inv := (&user.CreateInvite{
+		Email:     ptr.String(inviteEmail),
+		MaxUses:   1,
+		ExpiresOn: Now().Add(time.Hour),
+	}).MustDo(bc)
+	a.Equal(r.Bob().ID(), inv.CreatedBy)
+	a.Equal(1, len((&user.GetInvites{}).MustDo(bc)))
+
+	nc := r.NewClient()
+	err = (&user.Register{
+		Email:      "not_invited@test.localhost" + r.UniqueStr(),
+		Pwd:        pwd,
+		InviteCode: ptr.String(inv.Code),
+		Pow:        r.Pow(nc),
+	}).Do(nc)
+	a.Equal(&app.ErrMsg{Status: http.StatusBadRequest, Msg: "invite code invalid"}, err)
+
+	nc = r.NewClient()
+	(&user.Register{
+		Email:      inviteEmail,
+		Pwd:        pwd,
+		InviteCode: ptr.String(inv.Code),
+		Pow:        r.Pow(nc),
+	}).MustDo(nc)
+	a.Equal(uint16(1), (&user.GetInvites{}).MustDo(bc)[0].Uses)
+
+	nc = r.NewClient()
+	err = (&user.Register{
+		Email:      "invite_used@test.localhost" + r.UniqueStr(),
+		Pwd:        pwd,
+		InviteCode: ptr.String(inv.Code),
+		Pow:        r.Pow(nc),
+	}).Do(nc)
+	a.Equal(&app.ErrMsg{Status: http.StatusBadRequest, Msg: "invite code invalid"}, err)
+
+	(&user.DeleteInvite{
+		Code: inv.Code,
+	}).MustDo(bc)
+	a.Equal(0, len((&user.GetInvites{}).MustDo(bc)))
+	_, err = r.User().Primary().Exec(`DELETE FROM users WHERE email=?`, inviteEmail)
+	PanicOn(err)
+
+	// test reverting a change of email, even after it has been changed
+	// again so the latest revert link goes to the new owner
+	dc := r.Dan().Client()
+	for _, newEmail := range []string{
+		Strf("takeover@test.localhost%d", r.Unique()),
+		Strf("takeover2@test.localhost%d", r.Unique()),
+	} {
+		(&user.ChangeEmail{
+			NewEmail: newEmail,
+		}).MustDo(dc)
+		row = r.User().Primary().QueryRow(`SELECT changeEmailCode FROM users WHERE id=?`, r.Dan().ID())
+		PanicOn(row.Scan(&code))
+		(&user.ConfirmChangeEmail{
+			Me:   r.Dan().ID(),
+			Code: code,
+		}).MustDo(dc)
+	}
+	row = r.User().Primary().QueryRow(`SELECT revertCode FROM emailChanges WHERE user=? AND oldEmail=?`, r.Dan().ID(), r.Dan().Email())
+	PanicOn(row.Scan(&code))
+	err = (&user.RevertChangeEmail{
+		Me:   r.Dan().ID(),
+		Code: "wrong",
+	}).Do(r.NewClient())
+	a.Equal(&app.ErrMsg{Status: http.StatusBadRequest, Msg: "revert change email code invalid"}, err)
+	// the old email may have been taken since
+	_, err = r.User().Primary().Exec(`UPDATE users SET email=? WHERE id=?`, r.Dan().Email(), r.Cat().ID())
+	PanicOn(err)
+	err = (&user.RevertChangeEmail{
+		Me:   r.Dan().ID(),
+		Code: code,
+	}).Do(r.NewClient())
+	a.Equal(&app.ErrMsg{Status: http.StatusBadRequest, Msg: "old email already registered"}, err)
+	_, err = r.User().Primary().Exec(`UPDATE users SET email=? WHERE id=?`, r.Cat().Email(), r.Cat().ID())
+	PanicOn(err)
+	a.NotNil((&user.GetMe{}).MustDo(dc))
+	(&user.RevertChangeEmail{
+		Me:   r.Dan().ID(),
+		Code: code,
+	}).MustDo(r.NewClient())
+	a.Nil((&user.GetMe{}).MustDo(dc))
+	_, err = (&user.Login{
+		Email: r.Dan().Email(),
+		Pwd:   r.Dan().Pwd(),
+	}).Do(r.NewClient())
+	a.Equal(&app.ErrMsg{Status: http.StatusNotFound, Msg: "email and/or pwd are not valid"}, err)
+	history := (&user.AdminGetEmailHistory{
+		User:  r.Dan().ID(),
+		Limit: 10,
+	}).MustDo(bc)
+	a.Equal(2, len(history))
+	a.Equal(r.Dan().Email(), history[1].OldEmail)
+	a.NotNil(history[0].RevertedOn)
+	a.NotNil(history[1].RevertedOn)
+	// reverted changes can't be reverted again
+	err = (&user.RevertChangeEmail{
+		Me:   r.Dan().ID(),
+		Code: code,
+	}).Do(r.NewClient())
+	a.Equal(&app.ErrMsg{Status: http.StatusBadRequest, Msg: "revert change email code invalid"}, err)
+
+	// test upgrading an anonymous session on login
+	anonC := r.NewClient()
+	anon := getAnonID(anonC)
+	a.Equal(anon, getAnonID(anonC))
+	fixated := r.NewClient()
+	for name, value := range anonC.Cookies() {
+		fixated.SetCookie(name, value)
+	}
+	a.Equal(anon, getAnonID(fixated))
+	a.Equal(r.Ali().ID(), (&user.Login{
+		Email: r.Ali().Email(),
+		Pwd:   r.Ali().Pwd(),
+	}).MustDo(anonC).ID)
+	a.Equal(r.Ali().ID(), *r.Upgraded(anon))
+	a.Equal(r.Ali().ID(), (&user.GetMe{}).MustDo(anonC).ID)
+	// the old anonymous session can't be used to follow the user
+	a.NotEqual(anon, getAnonID(fixated))
+	a.Nil((&user.GetMe{}).MustDo(fixated))
+	a.Nil(r.Upgraded(getAnonID(fixated)))
+}
+
+const anonIDPath = "/test/anonId"
+
+// returns the requests session id, creating an anonymous session if it
+// doesn't have one.
+var anonIDEp = &app.Endpoint{
+	Description:  "get my session id",
+	Path:         anonIDPath,
+	Timeout:      500,
+	MaxBodyBytes: app.KB,
+	IsPrivate:    false,
+	GetDefaultArgs: func() interface{} {
+		return nil
+	},
+	GetExampleArgs: func() interface{} {
+		return nil
+	},
+	GetExampleResponse: func() interface{} {
+		return app.ExampleID()
+	},
+	Handler: func(tlbx app.Tlbx, _ interface{}) interface{} {
+		return me.Get(tlbx).ID()
+	},
+}
+
+func getAnonID(c *app.Client) ID {
+	var res ID
+	PanicOn(app.Call(c, anonIDPath, nil, &res))
+	return res
 }
@@ -1,45 +1,90 @@
 package autocertcache
 
 import (
+	"bytes"
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"time"
 
 	. "github.com/0xor1/tlbx/pkg/core"
+	"github.com/0xor1/tlbx/pkg/crypt"
 	"github.com/0xor1/tlbx/pkg/iredis"
 	"github.com/gomodule/redigo/redis"
 	"golang.org/x/crypto/acme/autocert"
 )
 
-const (
-	keyPrefix = "acme_autocert_"
-	daySecs   = 86400
-)
+// prefixes encrypted values so values stored before encryption was
+// enabled can still be read.
+var encrPrefix = []byte("tlbx_encr_v1:")
+
+type Config struct {
+	// EncrKey32s encrypt values at rest with AES-256-GCM, certificates
+	// are stored in the same value as their private key so all values are
+	// encrypted. The first key encrypts, all are tried to decrypt so keys
+	// can be rotated.
+	EncrKey32s [][]byte
+	// KeyPrefix is prepended to keys by Redis and Store.
+	KeyPrefix string
+	// Expiry is only used by Redis, it is reset on every read, 0 never
+	// expires.
+	Expiry time.Duration
+}
 
-func Dir(dir string) autocert.Cache {
-	return autocert.DirCache(dir)
+func Dir(dir string, configs ...func(*Config)) autocert.Cache {
+	return encrypt(config(configs...), autocert.DirCache(dir))
 }
 
-func Redis(p iredis.Pool) autocert.Cache {
-	return &redisCache{pool: p}
+func Redis(p iredis.Pool, configs ...func(*Config)) autocert.Cache {
+	c := config(configs...)
+	return encrypt(c, &redisCache{
+		pool:   p,
+		prefix: c.KeyPrefix,
+		expiry: int64(c.Expiry / time.Second),
+	})
+}
+
+func config(configs ...func(*Config)) *Config {
+	c := &Config{
+		EncrKey32s: nil,
+		KeyPrefix:  "acme_autocert_",
+		Expiry:     24 * time.Hour,
+	}
+	for _, config := range configs {
+		config(c)
+	}
+	return c
 }
 
 type redisCache struct {
-	pool iredis.Pool
+	pool   iredis.Pool
+	prefix string
+	// seconds
+	expiry int64
 }
 
 func (c *redisCache) Get(ctx context.Context, key string) ([]byte, error) {
 	cnn := c.pool.Get()
 	defer cnn.Close()
 
+	if c.expiry <= 0 {
+		data, err := redis.Bytes(cnn.Do("GET", c.prefix+key))
+		if err == redis.ErrNil {
+			return nil, autocert.ErrCacheMiss
+		}
+		return data, ToError(err)
+	}
+
 	if err := cnn.Send("MULTI"); err != nil {
 		return nil, err
 	}
 
-	if err := cnn.Send("GET", keyPrefix+key); err != nil {
+	if err := cnn.Send("GET", c.prefix+key); err != nil {
 		return nil, err
 	}
 
-	// set to expire after 1 day after last read
-	if err := cnn.Send("EXPIRE", keyPrefix+key, daySecs); err != nil {
+	// set to expire after expiry since last read
+	if err := cnn.Send("EXPIRE", c.prefix+key, c.expiry); err != nil {
 		return nil, err
 	}
 
@@ -48,14 +93,23 @@ func (c *redisCache) Get(ctx context.Context, key string) ([]byte, error) {
 		return nil, err
 	}
 
-	return redis.Bytes(results[len(results)-1], err)
+	data, err := redis.Bytes(results[0], nil)
+	if err == redis.ErrNil {
+		return nil, autocert.ErrCacheMiss
+	}
+	return data, ToError(err)
 }
 
 func (c *redisCache) Put(ctx context.Context, key string, data []byte) error {
 	cnn := c.pool.Get()
 	defer cnn.Close()
 
-	_, err := cnn.Do("SETEX", keyPrefix+key, daySecs, data)
+	var err error
+	if c.expiry <= 0 {
+		_, err = cnn.Do("SET", c.prefix+key, data)
+	} else {
+		_, err = cnn.Do("SETEX", c.prefix+key, c.expiry, data)
+	}
 	return ToError(err)
 }
 
@@ -63,6 +117,67 @@ func (c *redisCache) Delete(ctx context.Context, key string) error {
 	cnn := c.pool.Get()
 	defer cnn.Close()
 
-	_, err := cnn.Do("DEL", keyPrefix+key)
+	_, err := cnn.Do("DEL", c.prefix+key)
 	return ToError(err)
 }
+
+func encrypt(c *Config, cache autocert.Cache) autocert.Cache {
+	if len(c.EncrKey32s) == 0 {
+		return cache
+	}
+	aeads := make([]cipher.AEAD, 0, len(c.EncrKey32s))
+	for _, key := range c.EncrKey32s {
+		PanicIf(len(key) != 32, "autocertcache encr keys must be 32 bytes")
+		block, err := aes.NewCipher(key)
+		PanicOn(err)
+		aead, err := cipher.NewGCM(block)
+		PanicOn(err)
+		aeads = append(aeads, aead)
+	}
+	return &encrypted{
+		cache: cache,
+		aeads: aeads,
+	}
+}
+
+// encrypted seals values with the cache key as additional data so a
+// value can't be moved to another key.
+type encrypted struct {
+	cache autocert.Cache
+	aeads []cipher.AEAD
+}
+
+func (e *encrypted) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := e.cache.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, encrPrefix) {
+		// stored before encryption was enabled
+		return data, nil
+	}
+	data = data[len(encrPrefix):]
+	for _, aead := range e.aeads {
+		ns := aead.NonceSize()
+		if len(data) < ns {
+			continue
+		}
+		if plain, err := aead.Open(nil, data[:ns], data[ns:], []byte(key)); err == nil {
+			return plain, nil
+		}
+	}
+	return nil, ToError(Strf("autocertcache unable to decrypt %s with any key", key))
+}
+
+func (e *encrypted) Put(ctx context.Context, key string, data []byte) error {
+	aead := e.aeads[0]
+	nonce := crypt.Bytes(aead.NonceSize())
+	res := make([]byte, 0, len(encrPrefix)+len(nonce)+len(data)+aead.Overhead())
+	res = append(res, encrPrefix...)
+	res = append(res, nonce...)
+	return e.cache.Put(ctx, key, aead.Seal(res, nonce, data, []byte(key)))
+}
+
+func (e *encrypted) Delete(ctx context.Context, key string) error {
+	return e.cache.Delete(ctx, key)
+}
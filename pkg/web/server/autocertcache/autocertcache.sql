@@ -0,0 +1,27 @@
+{%- func qryGet() -%}
+{%- collapsespace -%}
+SELECT val
+FROM autocerts
+WHERE name=?
+{%- endcollapsespace -%}
+{%- endfunc -%}
+
+{%- func qryPut() -%}
+{%- collapsespace -%}
+INSERT INTO autocerts (
+    name,
+    val
+) VALUES (
+    ?,
+    ?
+) ON DUPLICATE KEY UPDATE
+val=VALUES(val)
+{%- endcollapsespace -%}
+{%- endfunc -%}
+
+{%- func qryDelete() -%}
+{%- collapsespace -%}
+DELETE FROM autocerts
+WHERE name=?
+{%- endcollapsespace -%}
+{%- endfunc -%}
\ No newline at end of file
@@ -0,0 +1,69 @@
+// Code generated by qtc from "autocertcache.sql". DO NOT EDIT.
+// See https://github.com/valyala/quicktemplate for details.
+
+package autocertcache
+
+import (
+	qtio422016 "io"
+
+	qt422016 "github.com/valyala/quicktemplate"
+)
+
+var (
+	_ = qtio422016.Copy
+	_ = qt422016.AcquireByteBuffer
+)
+
+func streamqryGet(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`SELECT val FROM autocerts WHERE name=? `)
+}
+
+func writeqryGet(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryGet(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryGet() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryGet(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func streamqryPut(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`INSERT INTO autocerts ( name, val ) VALUES ( ?, ? ) ON DUPLICATE KEY UPDATE val=VALUES(val) `)
+}
+
+func writeqryPut(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryPut(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryPut() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryPut(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func streamqryDelete(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`DELETE FROM autocerts WHERE name=? `)
+}
+
+func writeqryDelete(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	streamqryDelete(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func qryDelete() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	writeqryDelete(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
@@ -0,0 +1,46 @@
+package autocertcache
+
+import (
+	"context"
+	"database/sql"
+
+	. "github.com/0xor1/tlbx/pkg/core"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// DB is satisfied by *sql.DB and *sqlx.DB, pass a primary, e.g.
+// sqlh.ReplicaSet.Primary(), so a Put is immediately visible to every
+// instance.
+type DB interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// SQL stores values in the autocerts table, see sql/data.sql, values
+// never expire.
+func SQL(db DB, configs ...func(*Config)) autocert.Cache {
+	return encrypt(config(configs...), &sqlCache{db: db})
+}
+
+type sqlCache struct {
+	db DB
+}
+
+func (c *sqlCache) Get(ctx context.Context, key string) ([]byte, error) {
+	var data []byte
+	err := c.db.QueryRowContext(ctx, qryGet(), key).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, autocert.ErrCacheMiss
+	}
+	return data, ToError(err)
+}
+
+func (c *sqlCache) Put(ctx context.Context, key string, data []byte) error {
+	_, err := c.db.ExecContext(ctx, qryPut(), key, data)
+	return ToError(err)
+}
+
+func (c *sqlCache) Delete(ctx context.Context, key string) error {
+	_, err := c.db.ExecContext(ctx, qryDelete(), key)
+	return ToError(err)
+}
@@ -0,0 +1,48 @@
+package autocertcache_test
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/0xor1/tlbx/pkg/core"
+	"github.com/0xor1/tlbx/pkg/crypt"
+	"github.com/0xor1/tlbx/pkg/web/app/config"
+	"github.com/0xor1/tlbx/pkg/web/server/autocertcache"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestSQL(t *testing.T) {
+	db := config.GetProcessed(config.GetBase()).SQL.Data.Primary()
+	testCache(t, autocertcache.SQL(db))
+	testCache(t, autocertcache.SQL(db, func(c *autocertcache.Config) {
+		c.EncrKey32s = [][]byte{crypt.Bytes(32)}
+	}))
+}
+
+// testCache checks c misses, puts, overwrites and deletes a key unique
+// to this run.
+func testCache(t *testing.T, c autocert.Cache) {
+	a := assert.New(t)
+	ctx := context.Background()
+	key := Strf("autocertcache-test-%d", NowUnixMilli())
+
+	_, err := c.Get(ctx, key)
+	a.Equal(autocert.ErrCacheMiss, err)
+
+	a.Nil(c.Put(ctx, key, []byte("a")))
+	data, err := c.Get(ctx, key)
+	a.Nil(err)
+	a.Equal([]byte("a"), data)
+
+	a.Nil(c.Put(ctx, key, []byte("b")))
+	data, err = c.Get(ctx, key)
+	a.Nil(err)
+	a.Equal([]byte("b"), data)
+
+	a.Nil(c.Delete(ctx, key))
+	_, err = c.Get(ctx, key)
+	a.Equal(autocert.ErrCacheMiss, err)
+	// deleting a missing key isnt an error
+	a.Nil(c.Delete(ctx, key))
+}
@@ -0,0 +1,60 @@
+package autocertcache
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+
+	. "github.com/0xor1/tlbx/pkg/core"
+	"github.com/0xor1/tlbx/pkg/store"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Store stores values as private objects in bucket, values never
+// expire.
+func Store(s store.Client, bucket string, configs ...func(*Config)) autocert.Cache {
+	c := config(configs...)
+	return encrypt(c, &storeCache{
+		store:  s,
+		bucket: bucket,
+		prefix: c.KeyPrefix,
+	})
+}
+
+type storeCache struct {
+	store  store.Client
+	bucket string
+	prefix string
+}
+
+func (c *storeCache) Get(ctx context.Context, key string) ([]byte, error) {
+	_, _, _, content, err := c.store.Get(c.bucket, c.prefix+key)
+	if isNotFound(err) {
+		return nil, autocert.ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	data, err := ioutil.ReadAll(content)
+	return data, ToError(err)
+}
+
+func (c *storeCache) Put(ctx context.Context, key string, data []byte) error {
+	return c.store.Put(c.bucket, c.prefix+key, "", "", int64(len(data)), false, false, bytes.NewReader(data))
+}
+
+func (c *storeCache) Delete(ctx context.Context, key string) error {
+	return c.store.Delete(c.bucket, c.prefix+key)
+}
+
+func isNotFound(err error) bool {
+	e, ok := err.(Error)
+	if !ok {
+		return false
+	}
+	aerr, ok := e.Value().(awserr.Error)
+	return ok && (aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound")
+}
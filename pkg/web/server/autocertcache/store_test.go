@@ -0,0 +1,20 @@
+package autocertcache_test
+
+import (
+	"testing"
+
+	"github.com/0xor1/tlbx/pkg/crypt"
+	"github.com/0xor1/tlbx/pkg/web/app/config"
+	"github.com/0xor1/tlbx/pkg/web/server/autocertcache"
+)
+
+func TestStore(t *testing.T) {
+	s := config.GetProcessed(config.GetBase()).Store
+	bucket := "autocerts"
+	s.MustCreateBucket(bucket, "private")
+	testCache(t, autocertcache.Store(s, bucket))
+	testCache(t, autocertcache.Store(s, bucket, func(c *autocertcache.Config) {
+		c.KeyPrefix = "prefixed/"
+		c.EncrKey32s = [][]byte{crypt.Bytes(32)}
+	}))
+}
@@ -89,3 +89,129 @@ func FromRequest(r *http.Request) string {
 func RealIP(r *http.Request) string {
 	return FromRequest(r)
 }
+
+// PrivateCIDRs are the private and local ranges, they are a sensible set
+// of trusted proxies when the app is only reachable through a load
+// balancer on a private network.
+func PrivateCIDRs() []string {
+	res := make([]string, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		res = append(res, cidr.String())
+	}
+	return res
+}
+
+// Resolver only trusts forwarding headers set by trusted proxies, unlike
+// FromRequest which trusts them from anyone.
+type Resolver struct {
+	trusted []*net.IPNet
+}
+
+// New returns a Resolver trusting proxies in trustedCIDRs, single
+// addresses without a mask are also accepted.
+func New(trustedCIDRs ...string) (*Resolver, error) {
+	r := &Resolver{
+		trusted: make([]*net.IPNet, 0, len(trustedCIDRs)),
+	}
+	for _, c := range trustedCIDRs {
+		if !strings.Contains(c, "/") {
+			if strings.Contains(c, ":") {
+				c += "/128"
+			} else {
+				c += "/32"
+			}
+		}
+		_, cidr, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, err
+		}
+		r.trusted = append(r.trusted, cidr)
+	}
+	return r, nil
+}
+
+func MustNew(trustedCIDRs ...string) *Resolver {
+	r, err := New(trustedCIDRs...)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func (r *Resolver) isTrusted(ip net.IP) bool {
+	for _, cidr := range r.trusted {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// FromRequest returns the address of the first untrusted hop, walking
+// the Forwarded header, or X-Forwarded-For if there is no Forwarded
+// header, right to left from the remote address, only while each hop is
+// a trusted proxy. If the remote address is untrusted it is returned.
+func (r *Resolver) FromRequest(req *http.Request) string {
+	remote := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	ip := net.ParseIP(remote)
+	if ip == nil || !r.isTrusted(ip) {
+		return remote
+	}
+	chain := forwardedFor(req.Header.Values("Forwarded"))
+	if len(chain) == 0 {
+		for _, xff := range req.Header.Values("X-Forwarded-For") {
+			for _, address := range strings.Split(xff, ",") {
+				chain = append(chain, strings.TrimSpace(address))
+			}
+		}
+	}
+	if len(chain) == 0 {
+		if xRealIP := net.ParseIP(strings.TrimSpace(req.Header.Get("X-Real-Ip"))); xRealIP != nil {
+			return xRealIP.String()
+		}
+		return remote
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		hop := net.ParseIP(chain[i])
+		if hop == nil {
+			// unknown or obfuscated hops can't be walked past, so the
+			// last trusted hop is the best we know
+			return remote
+		}
+		remote = hop.String()
+		if !r.isTrusted(hop) {
+			return remote
+		}
+	}
+	return remote
+}
+
+// forwardedFor returns the for parameter of each element of RFC 7239
+// Forwarded headers, without ports, brackets or quotes, in order.
+func forwardedFor(headers []string) []string {
+	res := []string{}
+	for _, h := range headers {
+		for _, element := range strings.Split(h, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) != 2 || !strings.EqualFold(kv[0], "for") {
+					continue
+				}
+				v := strings.Trim(strings.TrimSpace(kv[1]), `"`)
+				if strings.HasPrefix(v, "[") {
+					// [ipv6] or [ipv6]:port
+					if end := strings.Index(v, "]"); end > 0 {
+						v = v[1:end]
+					}
+				} else if host, _, err := net.SplitHostPort(v); err == nil {
+					v = host
+				}
+				res = append(res, v)
+			}
+		}
+	}
+	return res
+}
@@ -93,3 +93,65 @@ func TestRealIP(t *testing.T) {
 		}
 	}
 }
+
+func TestResolver(t *testing.T) {
+	r := MustNew("10.0.0.0/8", "192.0.2.60")
+	newRequest := func(remoteAddr string, headers ...string) *http.Request {
+		h := http.Header{}
+		for i := 0; i < len(headers); i += 2 {
+			h.Add(headers[i], headers[i+1])
+		}
+		return &http.Request{
+			RemoteAddr: remoteAddr,
+			Header:     h,
+		}
+	}
+	testData := []struct {
+		name     string
+		request  *http.Request
+		expected string
+	}{
+		{
+			name:     "untrusted remote ignores headers",
+			request:  newRequest("144.12.54.87:1234", "X-Forwarded-For", "1.1.1.1", "X-Real-Ip", "1.1.1.1"),
+			expected: "144.12.54.87",
+		}, {
+			name:     "trusted remote no headers",
+			request:  newRequest("10.0.0.1:1234"),
+			expected: "10.0.0.1",
+		}, {
+			name:     "trusted remote X-Real-Ip",
+			request:  newRequest("10.0.0.1:1234", "X-Real-Ip", "144.12.54.87"),
+			expected: "144.12.54.87",
+		}, {
+			name:     "spoofed X-Forwarded-For prefix is skipped",
+			request:  newRequest("10.0.0.1:1234", "X-Forwarded-For", "1.1.1.1, 144.12.54.87, 10.0.0.2"),
+			expected: "144.12.54.87",
+		}, {
+			name:     "multiple X-Forwarded-For headers",
+			request:  newRequest("10.0.0.1:1234", "X-Forwarded-For", "1.1.1.1", "X-Forwarded-For", "144.12.54.87"),
+			expected: "144.12.54.87",
+		}, {
+			name:     "Forwarded takes precedence",
+			request:  newRequest("10.0.0.1:1234", "Forwarded", `for=1.1.1.1, for="[2001:db8:cafe::17]:4711";proto=https, for=192.0.2.60`, "X-Forwarded-For", "144.12.54.87"),
+			expected: "2001:db8:cafe::17",
+		}, {
+			name:     "Forwarded with port",
+			request:  newRequest("10.0.0.1:1234", "Forwarded", `for="144.12.54.87:80"`),
+			expected: "144.12.54.87",
+		}, {
+			name:     "obfuscated hop stops the walk",
+			request:  newRequest("10.0.0.1:1234", "Forwarded", `for=1.1.1.1, for=_hidden, for=10.0.0.2`),
+			expected: "10.0.0.2",
+		}, {
+			name:     "all trusted returns the leftmost",
+			request:  newRequest("10.0.0.1:1234", "X-Forwarded-For", "10.0.0.3, 10.0.0.2"),
+			expected: "10.0.0.3",
+		},
+	}
+	for _, v := range testData {
+		if actual := r.FromRequest(v.request); v.expected != actual {
+			t.Errorf("%s: expected %s but get %s", v.name, v.expected, actual)
+		}
+	}
+}
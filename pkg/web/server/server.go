@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"crypto/tls"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,6 +14,9 @@ import (
 	"github.com/0xor1/tlbx/pkg/log"
 	"github.com/0xor1/tlbx/pkg/web/server/autocertcache"
 	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/net/netutil"
 )
 
 type Config struct {
@@ -26,6 +30,41 @@ type Config struct {
 	CertWriteTimeout      time.Duration
 	CertCache             autocert.Cache
 	Handler               http.HandlerFunc
+	// app server settings, ReadTimeout and WriteTimeout are 0 by default
+	// as they would end large uploads and long lived responses, e.g. SSE,
+	// endpoints have their own timeouts.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	// DrainPeriod is how long shutdown waits for in flight requests to
+	// finish before closing their connections, OnShutdown is called when
+	// shutdown starts so apps can end SSE and hijacked, e.g. WebSocket,
+	// connections which shutdown does not wait for, app.Run provides one
+	// that closes Tlbx.ShuttingDown.
+	DrainPeriod time.Duration
+	OnShutdown  func()
+	// H2C enables HTTP/2 without tls for running behind proxies that
+	// terminate tls, it is only used when UseHttps is false.
+	H2C bool
+	// MaxConns limits the app servers concurrent connections, 0 is no
+	// limit, connections over the limit wait to be accepted.
+	MaxConns int
+	// CertFile and KeyFile are used instead of autocert when set, they are
+	// reloaded on SIGHUP and when either file changes, checked every
+	// CertReloadInterval, 0 disables checking.
+	CertFile           string
+	KeyFile            string
+	CertReloadInterval time.Duration
+	// ClientCAFile enables client certificate verification against the
+	// pem encoded CAs in it, ClientAuth defaults to
+	// tls.RequireAndVerifyClientCert when it is set.
+	ClientCAFile  string
+	ClientAuth    tls.ClientAuthType
+	MinTLSVersion uint16
+	// CipherSuites nil uses the go defaults.
+	CipherSuites []uint16
 }
 
 func Run(configs ...func(c *Config)) {
@@ -33,49 +72,87 @@ func Run(configs ...func(c *Config)) {
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
+	done := make(chan struct{})
 	shutdownServers := func(servers ...*http.Server) func() {
 		return func() {
+			defer close(done)
 			<-quit
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			ctx, cancel := context.WithTimeout(context.Background(), c.DrainPeriod)
 			defer cancel()
 
 			for _, server := range servers {
 				server.SetKeepAlivesEnabled(false)
-				c.Log.Info("Server %s shutting down", server.Addr)
-				c.Log.ErrorOn(server.Shutdown(ctx))
+				c.Log.Info("Server %s shutting down, draining for up to %s", server.Addr, c.DrainPeriod)
+				if err := server.Shutdown(ctx); err != nil {
+					c.Log.ErrorOn(err)
+					// drain period has passed, force close remaining
+					// connections
+					c.Log.ErrorOn(server.Close())
+				}
 			}
 		}
 	}
-	logDoneError := func(err error) {
-		if err != nil && err.Error() != "http: Server closed" {
-			c.Log.ErrorOn(err)
-		}
-	}
+	var err error
 
 	if !c.UseHttps {
+		handler := http.Handler(c.Handler)
+		if c.H2C {
+			handler = h2c.NewHandler(handler, &http2.Server{
+				IdleTimeout: c.IdleTimeout,
+			})
+		}
+		appServer := appServer(c, handler, nil)
 		c.Log.Info("Insecure app server running bound to %s", c.AppBindTo)
-		appServer := appServer(c, c.Handler, nil)
 		Go(shutdownServers(appServer), c.Log.ErrorOn)
-		logDoneError(appServer.ListenAndServe())
+		err = appServer.Serve(listen(c))
 	} else {
-		certManager := certManager(c)
-		certServer := certServer(c, certManager)
-		c.Log.Info("cert server running bound to %s", c.CertBindTo)
-		go certServer.ListenAndServe()
+		var getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+		// the cert server redirects everything but acme challenges to the
+		// app server, set CertBindTo to "" to not run it with cert files
+		var certHandler http.Handler = redirect(c)
+		if c.CertFile != "" {
+			certReloader := newCertReloader(c)
+			Go(func() {
+				certReloader.watch(c.CertReloadInterval, done)
+			}, c.Log.ErrorOn)
+			getCertificate = certReloader.getCertificate
+		} else {
+			certManager := certManager(c)
+			certHandler = certManager.HTTPHandler(certHandler)
+			getCertificate = certManager.GetCertificate
+		}
 
-		appServer := &http.Server{
-			Addr:      c.AppBindTo,
-			Handler:   c.Handler,
-			TLSConfig: &tls.Config{GetCertificate: certManager.GetCertificate},
+		appServer := appServer(c, c.Handler, tlsConfig(c, getCertificate))
+		servers := []*http.Server{appServer}
+		if c.CertBindTo != "" {
+			certServer := certServer(c, certHandler)
+			c.Log.Info("cert server running bound to %s", c.CertBindTo)
+			go certServer.ListenAndServe()
+			servers = append(servers, certServer)
 		}
 
 		c.Log.Info("Secure app server running bound to %s", c.AppBindTo)
-		Go(shutdownServers(appServer, certServer), c.Log.ErrorOn)
-		logDoneError(appServer.ListenAndServeTLS("", ""))
+		Go(shutdownServers(servers...), c.Log.ErrorOn)
+		err = appServer.ServeTLS(listen(c), "", "")
+	}
+	if err == http.ErrServerClosed {
+		// Serve returns as soon as shutdown starts so wait for the drain
+		<-done
+	} else {
+		c.Log.ErrorOn(err)
 	}
 	c.Log.Info("Server stopped")
 }
 
+func listen(c *Config) net.Listener {
+	l, err := net.Listen("tcp", c.AppBindTo)
+	PanicOn(err)
+	if c.MaxConns > 0 {
+		l = netutil.LimitListener(l, c.MaxConns)
+	}
+	return l
+}
+
 func config(configs ...func(c *Config)) *Config {
 	c := &Config{
 		Log:                   log.New(),
@@ -87,6 +164,22 @@ func config(configs ...func(c *Config)) *Config {
 		CertReadHeaderTimeout: 50 * time.Millisecond,
 		CertWriteTimeout:      50 * time.Millisecond,
 		CertCache:             autocertcache.Dir("acme_certs"),
+		ReadHeaderTimeout:     5 * time.Second,
+		ReadTimeout:           0,
+		WriteTimeout:          0,
+		IdleTimeout:           2 * time.Minute,
+		MaxHeaderBytes:        http.DefaultMaxHeaderBytes,
+		DrainPeriod:           10 * time.Second,
+		OnShutdown:            nil,
+		H2C:                   false,
+		MaxConns:              0,
+		CertFile:              "",
+		KeyFile:               "",
+		CertReloadInterval:    10 * time.Second,
+		ClientCAFile:          "",
+		ClientAuth:            tls.NoClientCert,
+		MinTLSVersion:         tls.VersionTLS12,
+		CipherSuites:          nil,
 		Handler: func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusNotImplemented)
 			w.Write([]byte(http.StatusText(http.StatusNotImplemented)))
@@ -106,20 +199,29 @@ func certManager(c *Config) *autocert.Manager {
 	}
 }
 
-func certServer(c *Config, certManager *autocert.Manager) *http.Server {
+func certServer(c *Config, handler http.Handler) *http.Server {
 	return &http.Server{
 		Addr:              c.CertBindTo,
-		Handler:           certManager.HTTPHandler(nil),
+		Handler:           handler,
 		ReadTimeout:       c.CertReadTimeout,
 		ReadHeaderTimeout: c.CertReadHeaderTimeout,
 		WriteTimeout:      c.CertWriteTimeout,
 	}
 }
 
-func appServer(c *Config, handler http.HandlerFunc, tlsConfig *tls.Config) *http.Server {
-	return &http.Server{
-		Addr:      c.AppBindTo,
-		Handler:   handler,
-		TLSConfig: tlsConfig,
+func appServer(c *Config, handler http.Handler, tlsConfig *tls.Config) *http.Server {
+	s := &http.Server{
+		Addr:              c.AppBindTo,
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		ReadTimeout:       c.ReadTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       c.IdleTimeout,
+		MaxHeaderBytes:    c.MaxHeaderBytes,
+	}
+	if c.OnShutdown != nil {
+		s.RegisterOnShutdown(c.OnShutdown)
 	}
+	return s
 }
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	. "github.com/0xor1/tlbx/pkg/core"
+	"github.com/0xor1/tlbx/pkg/log"
+)
+
+// TLSVersion returns the tls version for a name of the form "1.2",
+// panics if the name is unknown.
+func TLSVersion(name string) uint16 {
+	v, exists := map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}[name]
+	PanicIf(!exists, "unknown tls version %q", name)
+	return v
+}
+
+// CipherSuites returns the ids of the named cipher suites, e.g.
+// "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", only suites in
+// tls.CipherSuites() are allowed, panics if a name is unknown. Cipher
+// suites are not configurable in tls 1.3.
+func CipherSuites(names []string) []uint16 {
+	if len(names) == 0 {
+		return nil
+	}
+	ids := make(map[string]uint16, len(names))
+	for _, s := range tls.CipherSuites() {
+		ids[s.Name] = s.ID
+	}
+	res := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, exists := ids[name]
+		PanicIf(!exists, "unknown or insecure cipher suite %q", name)
+		res = append(res, id)
+	}
+	return res
+}
+
+// ClientAuth returns the client auth type for one of "", "none",
+// "request", "requireAny", "verifyIfGiven" or "requireAndVerify", panics
+// if the name is unknown.
+func ClientAuth(name string) tls.ClientAuthType {
+	t, exists := map[string]tls.ClientAuthType{
+		"":                 tls.NoClientCert,
+		"none":             tls.NoClientCert,
+		"request":          tls.RequestClientCert,
+		"requireAny":       tls.RequireAnyClientCert,
+		"verifyIfGiven":    tls.VerifyClientCertIfGiven,
+		"requireAndVerify": tls.RequireAndVerifyClientCert,
+	}[name]
+	PanicIf(!exists, "unknown client auth %q", name)
+	return t
+}
+
+func tlsConfig(c *Config, getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) *tls.Config {
+	t := &tls.Config{
+		GetCertificate: getCertificate,
+		MinVersion:     c.MinTLSVersion,
+		CipherSuites:   c.CipherSuites,
+		ClientAuth:     c.ClientAuth,
+	}
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		PanicOn(err)
+		t.ClientCAs = x509.NewCertPool()
+		PanicIf(!t.ClientCAs.AppendCertsFromPEM(pem), "no certificates found in %s", c.ClientCAFile)
+		if t.ClientAuth == tls.NoClientCert {
+			t.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return t
+}
+
+// redirect sends requests to the same host and uri on the https app
+// server.
+func redirect(c *Config) http.HandlerFunc {
+	_, port, _ := net.SplitHostPort(c.AppBindTo)
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" && port != "https" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	}
+}
+
+// certReloader serves a certificate loaded from files, reloading them on
+// SIGHUP or when either files modification time changes. If a reload
+// fails the current certificate continues to be served.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	log      log.Log
+	mtx      sync.RWMutex
+	cert     *tls.Certificate
+	modTime  time.Time
+}
+
+func newCertReloader(c *Config) *certReloader {
+	r := &certReloader{
+		certFile: c.CertFile,
+		keyFile:  c.KeyFile,
+		log:      c.Log,
+	}
+	PanicOn(r.load())
+	return r
+}
+
+func (r *certReloader) getCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.cert, nil
+}
+
+// modified returns the latest modification time of the files, or the
+// zero time if either can't be read.
+func (r *certReloader) modified() time.Time {
+	var latest time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+func (r *certReloader) load() error {
+	modTime := r.modified()
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return ToError(err)
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+func (r *certReloader) changed() bool {
+	modTime := r.modified()
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return modTime.After(r.modTime)
+}
+
+func (r *certReloader) reload(reason string) {
+	if err := r.load(); err != nil {
+		r.log.Warning("tls certificate reload on %s failed, still using previous certificate: %s", reason, err)
+		return
+	}
+	r.log.Info("tls certificate reloaded on %s", reason)
+}
+
+// watch reloads the certificate on SIGHUP and polls the files for
+// changes every interval, 0 disables polling, until stop is closed.
+func (r *certReloader) watch(interval time.Duration, stop <-chan struct{}) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-stop:
+			return
+		case <-hup:
+			r.reload("SIGHUP")
+		case <-tick:
+			if r.changed() {
+				r.reload("file change")
+			}
+		}
+	}
+}
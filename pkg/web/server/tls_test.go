@@ -0,0 +1,103 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0xor1/tlbx/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(uint16(tls.VersionTLS13), TLSVersion("1.3"))
+	a.Panics(func() { TLSVersion("1.4") })
+	a.Nil(CipherSuites(nil))
+	a.Equal([]uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, CipherSuites([]string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}))
+	a.Panics(func() { CipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"}) })
+	a.Equal(tls.NoClientCert, ClientAuth(""))
+	a.Equal(tls.RequireAndVerifyClientCert, ClientAuth("requireAndVerify"))
+	a.Panics(func() { ClientAuth("always") })
+}
+
+func TestRedirect(t *testing.T) {
+	a := assert.New(t)
+	testData := map[string]string{
+		":https": "https://a.com/b?c=d",
+		":443":   "https://a.com/b?c=d",
+		":8443":  "https://a.com:8443/b?c=d",
+	}
+	for bindTo, expected := range testData {
+		w := httptest.NewRecorder()
+		redirect(&Config{AppBindTo: bindTo})(w, httptest.NewRequest(http.MethodPost, "http://a.com:80/b?c=d", nil))
+		a.Equal(http.StatusPermanentRedirect, w.Code)
+		a.Equal(expected, w.Header().Get("Location"))
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+	c := &Config{
+		Log:      log.New(),
+		CertFile: filepath.Join(dir, "cert.pem"),
+		KeyFile:  filepath.Join(dir, "key.pem"),
+	}
+	writeCert(t, c, "a")
+	r := newCertReloader(c)
+	cert, err := r.getCertificate(nil)
+	a.Nil(err)
+	a.Equal("a", commonName(t, cert))
+	a.False(r.changed())
+
+	// a failed reload keeps the current certificate
+	a.Nil(os.WriteFile(c.KeyFile, []byte("bad"), 0600))
+	r.reload("test")
+	cert, _ = r.getCertificate(nil)
+	a.Equal("a", commonName(t, cert))
+
+	writeCert(t, c, "b")
+	future := time.Now().Add(time.Minute)
+	a.Nil(os.Chtimes(c.CertFile, future, future))
+	a.True(r.changed())
+	r.reload("test")
+	cert, _ = r.getCertificate(nil)
+	a.Equal("b", commonName(t, cert))
+	a.False(r.changed())
+}
+
+func writeCert(t *testing.T, c *Config, name string) {
+	a := assert.New(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.Nil(err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	a.Nil(err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	a.Nil(err)
+	a.Nil(os.WriteFile(c.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	a.Nil(os.WriteFile(c.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.Nil(t, err)
+	return leaf.Subject.CommonName
+}
@@ -0,0 +1,304 @@
+// Package webp encodes images as lossless WebP (VP8L), it uses no
+// transforms, color cache or backward references so output is larger than
+// that of libwebp but it is pure go and decodable by every WebP decoder.
+package webp
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+
+	. "github.com/0xor1/tlbx/pkg/core"
+)
+
+const (
+	MimeType = "image/webp"
+
+	maxDim             = 1 << 14
+	maxCodeLen         = 15
+	maxCodeLenCodeLen  = 7
+	greenAlphabetSize  = 256 + 24
+	colorAlphabetSize  = 256
+	distAlphabetSize   = 40
+	numCodeLengthCodes = 19
+)
+
+// the order code length code lengths are written in, from the spec.
+var codeLengthCodeOrder = [numCodeLengthCodes]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// Encode writes img to w as a lossless WebP.
+func Encode(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > maxDim || height > maxDim {
+		return Err("webp: invalid image dimensions %dx%d", width, height)
+	}
+
+	pixels := make([]color.NRGBA, 0, width*height)
+	hasAlpha := false
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			hasAlpha = hasAlpha || c.A != 0xff
+			pixels = append(pixels, c)
+		}
+	}
+
+	var green, red, blue, alpha [colorAlphabetSize]int
+	for _, c := range pixels {
+		green[c.G]++
+		red[c.R]++
+		blue[c.B]++
+		alpha[c.A]++
+	}
+
+	bw := &bitWriter{}
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if hasAlpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3) // version
+	bw.write(0, 1) // no transforms
+	bw.write(0, 1) // no color cache
+	bw.write(0, 1) // no meta prefix codes
+
+	greenCodes := writeCode(bw, green[:], greenAlphabetSize)
+	redCodes := writeCode(bw, red[:], colorAlphabetSize)
+	blueCodes := writeCode(bw, blue[:], colorAlphabetSize)
+	alphaCodes := writeCode(bw, alpha[:], colorAlphabetSize)
+	writeCode(bw, nil, distAlphabetSize)
+
+	for _, c := range pixels {
+		greenCodes[c.G].write(bw)
+		redCodes[c.R].write(bw)
+		blueCodes[c.B].write(bw)
+		alphaCodes[c.A].write(bw)
+	}
+	data := bw.bytes()
+
+	chunkLen := len(data)
+	pad := chunkLen & 1
+	buf := &bytes.Buffer{}
+	buf.WriteString("RIFF")
+	binary.Write(buf, binary.LittleEndian, uint32(4+8+chunkLen+pad))
+	buf.WriteString("WEBPVP8L")
+	binary.Write(buf, binary.LittleEndian, uint32(chunkLen))
+	buf.Write(data)
+	if pad == 1 {
+		buf.WriteByte(0)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nBits uint
+}
+
+// write appends the n low bits of v, least significant bit first.
+func (w *bitWriter) write(v uint32, n uint) {
+	w.acc |= uint64(v) << w.nBits
+	w.nBits += n
+	for w.nBits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nBits -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.nBits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc = 0
+		w.nBits = 0
+	}
+	return w.buf
+}
+
+type code struct {
+	bits uint32
+	len  uint
+}
+
+func (c code) write(w *bitWriter) {
+	w.write(c.bits, c.len)
+}
+
+// writeCode writes the prefix code for histogram and returns the code for
+// each symbol, histogram may be shorter than alphabetSize.
+func writeCode(w *bitWriter, histogram []int, alphabetSize int) []code {
+	symbols := make([]int, 0, 2)
+	for s, n := range histogram {
+		if n > 0 {
+			symbols = append(symbols, s)
+		}
+	}
+	codes := make([]code, alphabetSize)
+	if len(symbols) <= 2 {
+		// simple code, a single symbol takes 0 bits
+		if len(symbols) == 0 {
+			symbols = append(symbols, 0)
+		}
+		w.write(1, 1)
+		w.write(uint32(len(symbols)-1), 1)
+		if symbols[0] < 2 {
+			w.write(0, 1)
+			w.write(uint32(symbols[0]), 1)
+		} else {
+			w.write(1, 1)
+			w.write(uint32(symbols[0]), 8)
+		}
+		if len(symbols) == 2 {
+			w.write(uint32(symbols[1]), 8)
+			codes[symbols[1]] = code{bits: 1, len: 1}
+		}
+		return codes
+	}
+
+	lens := codeLengths(histogram, alphabetSize, maxCodeLen)
+
+	// code lengths are written using the code length code, without the
+	// repeat codes 16, 17 and 18 as each symbol is at most 15 bits.
+	clHistogram := make([]int, numCodeLengthCodes)
+	for _, l := range lens {
+		clHistogram[l]++
+	}
+	clUsed := 0
+	for _, n := range clHistogram {
+		if n > 0 {
+			clUsed++
+		}
+	}
+	if clUsed == 1 {
+		// every symbol has the same length, add an unused length so the
+		// code length code is a complete tree
+		if clHistogram[0] == 0 {
+			clHistogram[0] = 1
+		} else {
+			clHistogram[1] = 1
+		}
+	}
+	clLens := codeLengths(clHistogram, numCodeLengthCodes, maxCodeLenCodeLen)
+	numCodes := numCodeLengthCodes
+	for numCodes > 4 && clLens[codeLengthCodeOrder[numCodes-1]] == 0 {
+		numCodes--
+	}
+	w.write(0, 1)
+	w.write(uint32(numCodes-4), 4)
+	for i := 0; i < numCodes; i++ {
+		w.write(uint32(clLens[codeLengthCodeOrder[i]]), 3)
+	}
+	w.write(0, 1) // max_symbol is the alphabet size
+	clCodes := canonicalCodes(clLens)
+	for _, l := range lens {
+		clCodes[l].write(w)
+	}
+	copy(codes, canonicalCodes(lens))
+	return codes
+}
+
+// codeLengths returns length limited huffman code lengths for histogram,
+// when the limit is exceeded small counts are raised and it is retried.
+func codeLengths(histogram []int, alphabetSize int, limit int) []int {
+	for countMin := 1; ; countMin *= 2 {
+		h := &nodeHeap{}
+		for s, n := range histogram {
+			if n > 0 {
+				if n < countMin {
+					n = countMin
+				}
+				*h = append(*h, &node{count: n, symbol: s})
+			}
+		}
+		heap.Init(h)
+		for h.Len() > 1 {
+			a := heap.Pop(h).(*node)
+			b := heap.Pop(h).(*node)
+			heap.Push(h, &node{count: a.count + b.count, symbol: -1, left: a, right: b})
+		}
+		lens := make([]int, alphabetSize)
+		tooLong := false
+		var walk func(n *node, depth int)
+		walk = func(n *node, depth int) {
+			if n.left == nil {
+				lens[n.symbol] = depth
+				tooLong = tooLong || depth > limit
+				return
+			}
+			walk(n.left, depth+1)
+			walk(n.right, depth+1)
+		}
+		walk(heap.Pop(h).(*node), 0)
+		if !tooLong {
+			return lens
+		}
+	}
+}
+
+// canonicalCodes returns the canonical code for each length, bit reversed
+// as codes are read from the stream most significant bit first.
+func canonicalCodes(lens []int) []code {
+	var lenCounts [maxCodeLen + 1]uint32
+	for _, l := range lens {
+		lenCounts[l]++
+	}
+	lenCounts[0] = 0
+	var next [maxCodeLen + 1]uint32
+	c := uint32(0)
+	for l := 1; l <= maxCodeLen; l++ {
+		c = (c + lenCounts[l-1]) << 1
+		next[l] = c
+	}
+	codes := make([]code, len(lens))
+	for s, l := range lens {
+		if l > 0 {
+			codes[s] = code{bits: reverse(next[l], uint(l)), len: uint(l)}
+			next[l]++
+		}
+	}
+	return codes
+}
+
+func reverse(v uint32, n uint) uint32 {
+	r := uint32(0)
+	for i := uint(0); i < n; i++ {
+		r = r<<1 | v&1
+		v >>= 1
+	}
+	return r
+}
+
+type node struct {
+	count  int
+	symbol int
+	left   *node
+	right  *node
+}
+
+// nodeHeap orders by count then symbol so output is deterministic.
+type nodeHeap []*node
+
+func (h nodeHeap) Len() int { return len(h) }
+func (h nodeHeap) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count < h[j].count
+	}
+	return h[i].symbol < h[j].symbol
+}
+func (h nodeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *nodeHeap) Push(x interface{}) { *h = append(*h, x.(*node)) }
+func (h *nodeHeap) Pop() interface{} {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
@@ -0,0 +1,65 @@
+package webp
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	. "github.com/0xor1/tlbx/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/webp"
+)
+
+func roundTrip(a *assert.Assertions, img image.Image) {
+	buf := &bytes.Buffer{}
+	PanicOn(Encode(buf, img))
+	res, err := webp.Decode(buf)
+	PanicOn(err)
+	a.Equal(img.Bounds().Dx(), res.Bounds().Dx())
+	a.Equal(img.Bounds().Dy(), res.Bounds().Dy())
+	b := img.Bounds()
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			a.Equal(color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)), color.NRGBAModel.Convert(res.At(x, y)))
+		}
+	}
+}
+
+func Test_Encode(t *testing.T) {
+	a := assert.New(t)
+
+	// single pixel, every code is a simple single symbol code
+	one := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	one.Set(0, 0, color.NRGBA{R: 1, G: 2, B: 3, A: 4})
+	roundTrip(a, one)
+
+	// two colours, simple two symbol codes
+	two := image.NewNRGBA(image.Rect(5, 5, 8, 7))
+	for y := 5; y < 7; y++ {
+		for x := 5; x < 8; x++ {
+			two.Set(x, y, color.NRGBA{R: uint8(x * 20), G: uint8(x * 30), B: uint8(x * 40), A: 0xff})
+		}
+	}
+	roundTrip(a, two)
+
+	// noise uses every symbol giving full normal codes
+	r := rand.New(rand.NewSource(1))
+	noise := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	r.Read(noise.Pix)
+	roundTrip(a, noise)
+
+	// skewed counts require length limiting
+	skewed := image.NewNRGBA(image.Rect(0, 0, 300, 200))
+	for i := range skewed.Pix {
+		v := 0
+		for v < 255 && r.Intn(2) == 0 {
+			v++
+		}
+		skewed.Pix[i] = uint8(v)
+	}
+	roundTrip(a, skewed)
+
+	a.NotNil(Encode(&bytes.Buffer{}, image.NewNRGBA(image.Rect(0, 0, 0, 1))))
+}
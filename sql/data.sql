@@ -10,6 +10,14 @@ CREATE TABLE data (
     PRIMARY KEY id (id)
 );
 
+# used by autocertcache.SQL
+DROP TABLE IF EXISTS autocerts;
+CREATE TABLE autocerts (
+    name VARCHAR(250) NOT NULL,
+    val MEDIUMBLOB NOT NULL,
+    PRIMARY KEY name (name)
+);
+
 DROP USER IF EXISTS 'data'@'%';
 CREATE USER 'data'@'%' IDENTIFIED BY 'C0-Mm-0n-Da-Ta';
 GRANT SELECT ON data.* TO 'data'@'%';
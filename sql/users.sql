@@ -11,6 +11,10 @@ CREATE TABLE users (
     handle VARCHAR(20) NULL,
     alias VARCHAR(50) NULL,
     hasAvatar BOOLEAN NULL,
+    avatarHash VARCHAR(16) NULL,
+    avatarExt VARCHAR(8) NULL,
+    avatarSizes VARCHAR(100) NULL,
+    discoverable BOOLEAN NULL,
     fcmEnabled BOOLEAN NULL,
     registeredOn DATETIME(3) NOT NULL,
     activatedOn DATETIME(3) NOT NULL,
@@ -18,22 +22,89 @@ CREATE TABLE users (
 	activateCode VARCHAR(250) NULL,
 	changeEmailCode VARCHAR(250) NULL,
 	lastPwdResetOn DATETIME(3) NULL,
+	resetPwdCode VARCHAR(250) NULL,
     loginLinkCodeCreatedOn DATETIME(3) NULL,
     loginLinkCode VARCHAR(250) NULL,
+    locale VARCHAR(20) NULL,
+    deletedOn DATETIME(3) NULL,
+    restoreCode VARCHAR(250) NULL,
+    isAdmin BOOLEAN NOT NULL DEFAULT 0,
+    disabledOn DATETIME(3) NULL,
     PRIMARY KEY email (email),
     UNIQUE INDEX id (id),
     INDEX(activatedOn, registeredOn),
-    UNIQUE INDEX handle (handle)
+    INDEX(deletedOn),
+    UNIQUE INDEX handle (handle),
+    INDEX(alias)
+);
+
+# admin actions are never deleted so have no foreign key to users
+DROP TABLE IF EXISTS adminAudit;
+CREATE TABLE adminAudit (
+    id BINARY(16) NOT NULL,
+    admin BINARY(16) NOT NULL,
+    user BINARY(16) NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    createdOn DATETIME(3) NOT NULL,
+    PRIMARY KEY id (id),
+    INDEX(user, createdOn),
+    INDEX(createdOn)
+);
+
+DROP TABLE IF EXISTS invites;
+CREATE TABLE invites (
+    code VARCHAR(50) NOT NULL,
+    createdBy BINARY(16) NOT NULL,
+    createdOn DATETIME(3) NOT NULL,
+    email VARCHAR(250) NULL,
+    maxUses SMALLINT UNSIGNED NOT NULL,
+    uses SMALLINT UNSIGNED NOT NULL,
+    expiresOn DATETIME(3) NOT NULL,
+    PRIMARY KEY code (code),
+    INDEX(createdBy, createdOn),
+    INDEX(expiresOn),
+    FOREIGN KEY (createdBy) REFERENCES users (id) ON DELETE CASCADE
+);
+
+# cleanup expired invites
+SET GLOBAL event_scheduler=ON;
+DROP EVENT IF EXISTS inviteCleanup;
+CREATE EVENT inviteCleanup
+ON SCHEDULE EVERY 24 HOUR
+STARTS CURRENT_TIMESTAMP + INTERVAL 1 HOUR
+DO DELETE FROM invites WHERE expiresOn < NOW();
+
+DROP TABLE IF EXISTS emailChanges;
+CREATE TABLE emailChanges (
+    user BINARY(16) NOT NULL,
+    changedOn DATETIME(3) NOT NULL,
+    oldEmail VARCHAR(250) NOT NULL,
+    newEmail VARCHAR(250) NOT NULL,
+    revertCode VARCHAR(250) NULL,
+    revertedOn DATETIME(3) NULL,
+    PRIMARY KEY (user, changedOn),
+    FOREIGN KEY (user) REFERENCES users (id) ON DELETE CASCADE
 );
 
 DROP TABLE IF EXISTS jin;
 CREATE TABLE jin (
     user BINARY(16) NOT NULL,
-    val VARBINARY(10000) NOT NULL,
+    rev BIGINT UNSIGNED NOT NULL,
+    val VARBINARY(10000) NULL,
     PRIMARY KEY user (user),
     FOREIGN KEY (user) REFERENCES users (id) ON DELETE CASCADE
 );
 
+DROP TABLE IF EXISTS profileFields;
+CREATE TABLE profileFields (
+    user BINARY(16) NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    # json of 2000 runes each escaped to 6 bytes, e.g. "<" is "\u003c", plus quotes
+    val VARBINARY(12002) NOT NULL,
+    PRIMARY KEY (user, name),
+    FOREIGN KEY (user) REFERENCES users (id) ON DELETE CASCADE
+);
+
 # cleanup old registrations that have not been activated in a week
 SET GLOBAL event_scheduler=ON;
 DROP EVENT IF EXISTS userRegistrationCleanup;